@@ -0,0 +1,162 @@
+package changesets
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nwidger/lighthouse/changesets/keywords"
+)
+
+// FileStat is the number of lines added to and deleted from a file.
+type FileStat struct {
+	Path      string `json:"path"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+type FileStats []*FileStat
+
+var (
+	// the default titles of the commit hooks' changesets, such as
+	// 'alice committed changeset [1a2b3c]' or 'alice pushed 30
+	// commits which updated branch main'
+	hookTitleRE = regexp.MustCompile(`(?:committed changeset \[[^\]]+\]|pushed \d+ commits)(?: (?:on|which \w+) branch (\S+))?$`)
+	// ' path/to/file.go | 12 ++++++++----'
+	diffStatRE = regexp.MustCompile(`^\s*(.+?)\s+\|\s+(\d+)\s*(\+*)(-*)\s*$`)
+)
+
+// Trailer returns the lines ParseBody reads c's branch and parents
+// from, or an empty string if neither is set.  The commit hooks append
+// it to the body of the changesets they post, since Lighthouse
+// doesn't store either.
+func (c *Changeset) Trailer() string {
+	lines := []string{}
+	if len(c.Branch) > 0 {
+		lines = append(lines, "Branch: "+c.Branch)
+	}
+	if len(c.Parents) > 0 {
+		parents := make([]string, 0, len(c.Parents))
+		for _, parent := range c.Parents {
+			// brackets link to the parent's changeset
+			parents = append(parents, "["+parent+"]")
+		}
+		lines = append(lines, "Parents: "+strings.Join(parents, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseTrailer returns the branch and parents in the lines added by
+// Trailer at the end of body, and whether there were any.
+func parseTrailer(body string) (string, []string, bool) {
+	var (
+		branch  string
+		parents []string
+		found   bool
+	)
+
+	lines := strings.Split(strings.TrimRight(body, "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(line, "Branch: ") && len(branch) == 0:
+			branch = strings.TrimSpace(strings.TrimPrefix(line, "Branch: "))
+		case strings.HasPrefix(line, "Parents: ") && len(parents) == 0:
+			for _, parent := range strings.Fields(strings.TrimPrefix(line, "Parents: ")) {
+				parent = strings.Trim(parent, "[]")
+				if len(parent) > 0 {
+					parents = append(parents, parent)
+				}
+			}
+		default:
+			return branch, parents, found
+		}
+		found = true
+	}
+
+	return branch, parents, found
+}
+
+// ParseBody sets whichever of c's Branch, Parents, Stats and Tickets
+// are empty from its title and body.  The branch and parents are read
+// from the lines added by Trailer at the end of the body, falling back
+// to the branch named by a commit hook's default title.  The stats are
+// read from a diffstat between @@@ lines, as printed by 'git diff
+// --stat', but only if the changeset was posted by a commit hook, i.e.
+// it has a trailer or a hook's default title.  The tickets are
+// TicketID followed by each ticket referenced as [#N].
+func (c *Changeset) ParseBody() {
+	branch, parents, hasTrailer := parseTrailer(c.Body)
+	titleMatch := hookTitleRE.FindStringSubmatch(c.Title)
+	if len(branch) == 0 && titleMatch != nil {
+		branch = titleMatch[1]
+	}
+
+	if len(c.Branch) == 0 {
+		c.Branch = branch
+	}
+
+	if len(c.Parents) == 0 {
+		c.Parents = parents
+	}
+
+	if len(c.Stats) == 0 && (hasTrailer || titleMatch != nil) {
+		block, inBlock := []string{}, false
+		for _, line := range strings.Split(c.Body, "\n") {
+			if strings.TrimSpace(line) == "@@@" {
+				inBlock = !inBlock
+				continue
+			}
+			if inBlock {
+				block = append(block, line)
+			}
+		}
+		c.Stats = ParseDiffStat(strings.Join(block, "\n"))
+	}
+
+	if len(c.Tickets) == 0 {
+		seen := map[int]bool{}
+		if c.TicketID > 0 {
+			c.Tickets = append(c.Tickets, c.TicketID)
+			seen[c.TicketID] = true
+		}
+		for _, number := range keywords.Parse(c.Title + "\n" + c.Body).Numbers() {
+			if !seen[number] {
+				c.Tickets = append(c.Tickets, number)
+				seen[number] = true
+			}
+		}
+	}
+}
+
+// ParseDiffStat parses the per-file lines of a diffstat as printed by
+// 'git diff --stat' or 'hg diff --stat', ignoring any other lines.
+// The printed graph is scaled down for large changes, in which case
+// the additions and deletions are estimated from its proportions.
+func ParseDiffStat(diffStat string) FileStats {
+	var stats FileStats
+
+	for _, line := range strings.Split(diffStat, "\n") {
+		m := diffStatRE.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		total, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		plus, minus := len(m[3]), len(m[4])
+
+		st := &FileStat{Path: m[1]}
+		switch {
+		case plus+minus == total:
+			st.Additions, st.Deletions = plus, minus
+		case plus+minus > 0:
+			st.Additions = (total*plus + (plus+minus)/2) / (plus + minus)
+			st.Deletions = total - st.Additions
+		}
+		stats = append(stats, st)
+	}
+
+	return stats
+}
@@ -0,0 +1,183 @@
+package changesets
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       *Changeset
+		branch  string
+		parents []string
+		stats   FileStats
+		tickets []int
+	}{
+		{
+			name: "hook changeset",
+			c: &Changeset{
+				Title: "alice committed changeset [1a2b3c] on branch main",
+				Body: "Fix crash [#12 state:resolved]\n\n@@@\n" +
+					" main.go | 4 +++-\n" +
+					" 1 file changed, 3 insertions(+), 1 deletion(-)\n@@@\n\n" +
+					"Branch: main\nParents: [0a1b2c] [9f8e7d]\n",
+				TicketID: 12,
+			},
+			branch:  "main",
+			parents: []string{"0a1b2c", "9f8e7d"},
+			stats:   FileStats{{Path: "main.go", Additions: 3, Deletions: 1}},
+			tickets: []int{12},
+		},
+		{
+			name: "push title without trailer",
+			c: &Changeset{
+				Title: "alice pushed 30 commits which updated branch release-1.0",
+				Body:  "@@@\n a.go | 2 ++\n b.go | 1 -\n@@@",
+			},
+			branch: "release-1.0",
+			stats: FileStats{
+				{Path: "a.go", Additions: 2},
+				{Path: "b.go", Deletions: 1},
+			},
+		},
+		{
+			name: "trailer overrides title",
+			c: &Changeset{
+				Title: "alice committed changeset [1a2b3c] on branch main",
+				Body:  "Branch: feature",
+			},
+			branch: "feature",
+		},
+		{
+			name: "hook title without branch",
+			c: &Changeset{
+				Title: "alice committed changeset [42]",
+				Body:  "See [#3] and [#4]",
+			},
+			tickets: []int{3, 4},
+		},
+		{
+			name: "branch in a custom title",
+			c: &Changeset{
+				Title: "Fix branch handling",
+				Body:  "Something about branch main",
+			},
+		},
+		{
+			name: "trailer lines before other text",
+			c: &Changeset{
+				Title: "Fix parsing",
+				Body:  "Branch: main\nParents: [0a1b2c]\n\nNot a trailer",
+			},
+		},
+		{
+			name: "diffstat in a custom changeset",
+			c: &Changeset{
+				Title: "Document diffstats",
+				Body:  "@@@\n a.go | 2 ++\n@@@",
+			},
+		},
+		{
+			name: "fields already set",
+			c: &Changeset{
+				Title:   "alice committed changeset [1a2b3c] on branch main",
+				Body:    "[#5]\n@@@\n a.go | 2 ++\n@@@\nBranch: main",
+				Branch:  "other",
+				Parents: []string{"abc"},
+				Stats:   FileStats{{Path: "b.go", Additions: 1}},
+				Tickets: []int{6},
+			},
+			branch:  "other",
+			parents: []string{"abc"},
+			stats:   FileStats{{Path: "b.go", Additions: 1}},
+			tickets: []int{6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.c
+			c.ParseBody()
+			if c.Branch != tt.branch {
+				t.Errorf("Branch = %q, want %q", c.Branch, tt.branch)
+			}
+			if !reflect.DeepEqual(c.Parents, tt.parents) {
+				t.Errorf("Parents = %q, want %q", c.Parents, tt.parents)
+			}
+			if !reflect.DeepEqual(c.Stats, tt.stats) {
+				t.Errorf("Stats = %v, want %v", formatStats(c.Stats), formatStats(tt.stats))
+			}
+			if !reflect.DeepEqual(c.Tickets, tt.tickets) {
+				t.Errorf("Tickets = %v, want %v", c.Tickets, tt.tickets)
+			}
+		})
+	}
+}
+
+func TestParseDiffStat(t *testing.T) {
+	tests := []struct {
+		name     string
+		diffStat string
+		want     FileStats
+	}{
+		{
+			name:     "empty",
+			diffStat: "",
+			want:     nil,
+		},
+		{
+			name: "exact graph",
+			diffStat: " cmd/main.go | 12 ++++++++----\n" +
+				" README.md   |  1 +\n" +
+				" 2 files changed, 9 insertions(+), 4 deletions(-)",
+			want: FileStats{
+				{Path: "cmd/main.go", Additions: 8, Deletions: 4},
+				{Path: "README.md", Additions: 1},
+			},
+		},
+		{
+			name:     "scaled graph",
+			diffStat: " big.go | 300 +++++++++++++++---------------",
+			want:     FileStats{{Path: "big.go", Additions: 150, Deletions: 150}},
+		},
+		{
+			name:     "scaled graph rounds",
+			diffStat: " big.go | 100 ++--",
+			want:     FileStats{{Path: "big.go", Additions: 50, Deletions: 50}},
+		},
+		{
+			name:     "path with spaces",
+			diffStat: " docs/read me.txt | 3 ---",
+			want:     FileStats{{Path: "docs/read me.txt", Deletions: 3}},
+		},
+		{
+			name:     "binary file",
+			diffStat: " logo.png | Bin 0 -> 1234 bytes",
+			want:     nil,
+		},
+		{
+			name:     "mode change only",
+			diffStat: " run.sh | 0",
+			want:     FileStats{{Path: "run.sh"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseDiffStat(tt.diffStat)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDiffStat(%q) = %v, want %v", tt.diffStat, formatStats(got), formatStats(tt.want))
+			}
+		})
+	}
+}
+
+// formatStats returns stats' values for error messages.
+func formatStats(stats FileStats) []FileStat {
+	vs := []FileStat{}
+	for _, st := range stats {
+		vs = append(vs, *st)
+	}
+	return vs
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nwidger/lighthouse"
@@ -96,6 +97,20 @@ type Changeset struct {
 	TicketID  int        `json:"ticket_id"`
 	Title     string     `json:"title"`
 	UserID    int        `json:"user_id"`
+
+	// The following fields aren't stored by Lighthouse.  The
+	// commit hooks set them when posting a changeset, otherwise
+	// they're parsed from its title and body by ParseBody.
+
+	// Branch is the branch or ref the changeset was committed to.
+	Branch string `json:"branch,omitempty"`
+	// Parents are the revisions of the changeset's parents.
+	Parents []string `json:"parents,omitempty"`
+	// Stats are the lines added and deleted in each changed file.
+	Stats FileStats `json:"stats,omitempty"`
+	// Tickets are the numbers of the tickets the changeset
+	// references, starting with TicketID.
+	Tickets []int `json:"tickets,omitempty"`
 }
 
 type Changesets []*Changeset
@@ -106,6 +121,7 @@ type ChangesetCreate struct {
 	ChangedAt *time.Time `json:"changed_at"`
 	Changes   Changes    `json:"changes"`
 	Revision  string     `json:"revision"`
+	TicketID  int        `json:"ticket_id,omitempty"`
 	Title     string     `json:"title"`
 	UserID    int        `json:"user_id"`
 }
@@ -140,6 +156,7 @@ func (csr *changesetsResponse) decode(r io.Reader) error {
 func (csr *changesetsResponse) changesets() Changesets {
 	cs := make(Changesets, 0, len(csr.ChangesetResponse))
 	for _, c := range csr.ChangesetResponse {
+		c.Changeset.ParseBody()
 		cs = append(cs, c.Changeset)
 	}
 
@@ -149,9 +166,100 @@ func (csr *changesetsResponse) changesets() Changesets {
 type ListOptions struct {
 	// Undocumented.  If non-zero, the page to return.
 	Page int
+
+	// The API can't filter changesets, so the following filters
+	// are applied to each page after it is fetched.  List may
+	// therefore return fewer changesets than a full page, use
+	// ListAll to search all of a project's changesets.
+
+	// If set, only changesets by this committer are returned,
+	// compared case-insensitively.
+	Committer string
+	// If non-zero, only changesets changed at or after Since and
+	// before Until are returned.
+	Since time.Time
+	Until time.Time
+	// If set, only changesets changing a path starting with Path
+	// are returned.  Leading slashes are ignored.
+	Path string
+	// If non-zero, only changesets referencing this ticket number
+	// are returned, see Changeset.Tickets.
+	Ticket int
+}
+
+// match returns whether c passes the filters in opts.
+func (opts *ListOptions) match(c *Changeset) bool {
+	if opts == nil {
+		return true
+	}
+
+	if len(opts.Committer) > 0 && !strings.EqualFold(c.Committer, opts.Committer) {
+		return false
+	}
+
+	if !opts.Since.IsZero() || !opts.Until.IsZero() {
+		if c.ChangedAt == nil {
+			return false
+		}
+		if !opts.Since.IsZero() && c.ChangedAt.Before(opts.Since) {
+			return false
+		}
+		if !opts.Until.IsZero() && !c.ChangedAt.Before(opts.Until) {
+			return false
+		}
+	}
+
+	if len(opts.Path) > 0 {
+		prefix := strings.TrimLeft(opts.Path, "/")
+		found := false
+		for _, change := range c.Changes {
+			if strings.HasPrefix(strings.TrimLeft(change.Path, "/"), prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if opts.Ticket > 0 {
+		found := false
+		for _, number := range c.Tickets {
+			if number == opts.Ticket {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filter returns the changesets in cs passing the filters in opts.
+func (opts *ListOptions) filter(cs Changesets) Changesets {
+	filtered := make(Changesets, 0, len(cs))
+	for _, c := range cs {
+		if opts.match(c) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
 }
 
 func (s *Service) List(opts *ListOptions) (Changesets, error) {
+	cs, err := s.list(opts)
+	if err != nil {
+		return nil, err
+	}
+	return opts.filter(cs), nil
+}
+
+// list returns a page of changesets without filtering them.
+func (s *Service) list(opts *ListOptions) (Changesets, error) {
 	path := s.basePath + ".json"
 	if opts != nil {
 		u, err := url.Parse(path)
@@ -186,8 +294,8 @@ func (s *Service) List(opts *ListOptions) (Changesets, error) {
 	return csresp.changesets(), nil
 }
 
-// ListAll repeatedly calls List and returns all pages.  ListAll
-// ignores opts.Page.
+// ListAll repeatedly fetches pages and returns all of them, then
+// applies the filters in opts.  ListAll ignores opts.Page.
 func (s *Service) ListAll(opts *ListOptions) (Changesets, error) {
 	realOpts := ListOptions{}
 	if opts != nil {
@@ -197,7 +305,9 @@ func (s *Service) ListAll(opts *ListOptions) (Changesets, error) {
 	cs := Changesets{}
 
 	for realOpts.Page = 1; ; realOpts.Page++ {
-		p, err := s.List(&realOpts)
+		// filtering a page could empty it, so filter once all
+		// pages are fetched
+		p, err := s.list(&realOpts)
 		if err != nil {
 			return nil, err
 		}
@@ -208,7 +318,7 @@ func (s *Service) ListAll(opts *ListOptions) (Changesets, error) {
 		cs = append(cs, p...)
 	}
 
-	return cs, nil
+	return realOpts.filter(cs), nil
 }
 
 func (s *Service) New() (*Changeset, error) {
@@ -232,6 +342,7 @@ func (s *Service) Get(revision string) (*Changeset, error) {
 	if err != nil {
 		return nil, err
 	}
+	cresp.Changeset.ParseBody()
 
 	return cresp.Changeset, nil
 }
@@ -245,6 +356,7 @@ func (s *Service) Create(c *Changeset) (*Changeset, error) {
 			ChangedAt: c.ChangedAt,
 			Changes:   c.Changes,
 			Revision:  c.Revision,
+			TicketID:  c.TicketID,
 			Title:     c.Title,
 			UserID:    c.UserID,
 		},
@@ -274,6 +386,7 @@ func (s *Service) Create(c *Changeset) (*Changeset, error) {
 	if err != nil {
 		return nil, err
 	}
+	c.ParseBody()
 
 	return c, nil
 }
@@ -0,0 +1,246 @@
+// Package keywords parses ticket references and keyword commands from
+// commit messages and applies them to tickets.
+//
+// A reference is one or more ticket numbers in square brackets,
+// optionally followed by keyword commands using the same keywords as
+// ticket searches:
+//
+//	Fix crash when saving [#123 state:resolved responsible:alice]
+//	Update docs [#124 #125 tagged:docs milestone:"Version 1.0"]
+//	See also [#126]
+//
+// See
+// https://lighthouse.tenderapp.com/kb/ticket-workflow/how-do-i-update-tickets-with-keywords.
+package keywords
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+// Keyword is a keyword command such as state:resolved.
+type Keyword struct {
+	Name  string
+	Value string
+}
+
+func (k *Keyword) String() string {
+	value := k.Value
+	if len(value) == 0 || strings.IndexFunc(value, unicode.IsSpace) != -1 {
+		value = strconv.Quote(value)
+	}
+	return k.Name + ":" + value
+}
+
+type Keywords []*Keyword
+
+// String returns the keywords as a command suitable for
+// tickets.BulkEditOptions.
+func (ks Keywords) String() string {
+	ss := make([]string, 0, len(ks))
+	for _, k := range ks {
+		ss = append(ss, k.String())
+	}
+	return strings.Join(ss, " ")
+}
+
+// Reference is a reference to a ticket in a commit message.
+type Reference struct {
+	// Number is the referenced ticket's number.
+	Number int
+	// Keywords are the keyword commands to apply to the ticket,
+	// empty if the ticket is only mentioned.
+	Keywords Keywords
+}
+
+type References []*Reference
+
+// Numbers returns the referenced ticket numbers.
+func (rs References) Numbers() []int {
+	numbers := make([]int, 0, len(rs))
+	for _, r := range rs {
+		numbers = append(numbers, r.Number)
+	}
+	return numbers
+}
+
+// Parse returns the ticket references in message in the order they
+// first appear.  A ticket referenced more than once has a single
+// reference with all of its keywords.  Brackets which don't start with
+// a ticket number, such as revision references, are ignored.
+func Parse(message string) References {
+	refs := References{}
+	byNumber := map[int]*Reference{}
+
+	for {
+		idx := strings.Index(message, "[#")
+		if idx == -1 {
+			break
+		}
+		message = message[idx+1:]
+
+		end := closingBracket(message)
+		if end == -1 {
+			continue
+		}
+		numbers, ks, ok := parseReference(message[:end])
+		if !ok {
+			continue
+		}
+		message = message[end+1:]
+
+		for _, number := range numbers {
+			r, ok := byNumber[number]
+			if !ok {
+				r = &Reference{Number: number, Keywords: Keywords{}}
+				byNumber[number] = r
+				refs = append(refs, r)
+			}
+			r.Keywords = append(r.Keywords, ks...)
+		}
+	}
+
+	return refs
+}
+
+// closingBracket returns the index of the bracket closing s, skipping
+// quoted keyword values, or -1 if there is none.
+func closingBracket(s string) int {
+	quote := rune(0)
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ']':
+			return i
+		case r == '\n' || r == '[':
+			return -1
+		}
+	}
+	return -1
+}
+
+// parseReference parses the inside of a reference's brackets, e.g.
+// '#123 #124 state:resolved'.
+func parseReference(s string) ([]int, Keywords, bool) {
+	numbers := []int{}
+	ks := Keywords{}
+
+	for _, field := range splitFields(s) {
+		if strings.HasPrefix(field, "#") && len(ks) == 0 {
+			number, err := strconv.Atoi(strings.TrimRight(field[1:], ","))
+			if err != nil || number <= 0 {
+				return nil, nil, false
+			}
+			numbers = append(numbers, number)
+			continue
+		}
+		idx := strings.Index(field, ":")
+		if idx <= 0 || idx == len(field)-1 {
+			return nil, nil, false
+		}
+		value := field[idx+1:]
+		if unquoted, err := unquote(value); err == nil {
+			value = unquoted
+		}
+		ks = append(ks, &Keyword{
+			Name:  strings.ToLower(field[:idx]),
+			Value: value,
+		})
+	}
+
+	if len(numbers) == 0 {
+		return nil, nil, false
+	}
+	return numbers, ks, true
+}
+
+// splitFields splits s around spaces outside of quotes.
+func splitFields(s string) []string {
+	fields := []string{}
+	quote := rune(0)
+	start := -1
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			continue
+		case r == '"' || r == '\'':
+			quote = r
+		case unicode.IsSpace(r):
+			if start != -1 {
+				fields = append(fields, s[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start == -1 {
+			start = i
+		}
+	}
+	if start != -1 {
+		fields = append(fields, s[start:])
+	}
+	return fields
+}
+
+func unquote(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1], nil
+	}
+	return "", fmt.Errorf("not quoted")
+}
+
+// Apply applies each reference's keywords to its ticket with
+// tickets.Service.BulkEdit, so they are interpreted by Lighthouse
+// exactly as in the web interface, then adds comment to the ticket.
+// All references are applied even if some fail, the first error is
+// returned.
+func Apply(t *tickets.Service, refs References, comment string) error {
+	var firstErr error
+
+	for _, r := range refs {
+		err := apply(t, r, comment)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("ticket #%d: %v", r.Number, err)
+		}
+	}
+
+	return firstErr
+}
+
+func apply(t *tickets.Service, r *Reference, comment string) error {
+	if len(r.Keywords) > 0 {
+		err := t.BulkEdit(&tickets.BulkEditOptions{
+			Query:   strconv.Itoa(r.Number),
+			Command: r.Keywords.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(comment) == 0 {
+		return nil
+	}
+
+	tkt, err := t.GetByNumber(r.Number)
+	if err != nil {
+		return err
+	}
+	tkt.Body = comment
+	return t.Update(tkt)
+}
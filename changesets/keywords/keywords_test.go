@@ -0,0 +1,140 @@
+package keywords
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// format returns refs as '#N keywords', one per reference.
+func format(refs References) []string {
+	ss := []string{}
+	for _, r := range refs {
+		s := "#" + strconv.Itoa(r.Number)
+		if len(r.Keywords) > 0 {
+			s += " " + r.Keywords.String()
+		}
+		ss = append(ss, s)
+	}
+	return ss
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []string
+	}{
+		{
+			name:    "no references",
+			message: "Fix crash when saving",
+			want:    []string{},
+		},
+		{
+			name:    "mention",
+			message: "See also [#126]",
+			want:    []string{"#126"},
+		},
+		{
+			name:    "keywords",
+			message: "Fix crash when saving [#123 state:resolved responsible:alice]",
+			want:    []string{"#123 state:resolved responsible:alice"},
+		},
+		{
+			name:    "several tickets share keywords",
+			message: "Update docs [#124 #125 tagged:docs]",
+			want:    []string{"#124 tagged:docs", "#125 tagged:docs"},
+		},
+		{
+			name:    "comma separated tickets",
+			message: "Update docs [#124, #125]",
+			want:    []string{"#124", "#125"},
+		},
+		{
+			name:    "double quoted value",
+			message: `Update docs [#124 milestone:"Version 1.0"]`,
+			want:    []string{`#124 milestone:"Version 1.0"`},
+		},
+		{
+			name:    "single quoted value",
+			message: `Update docs [#124 milestone:'Version 1.0']`,
+			want:    []string{`#124 milestone:"Version 1.0"`},
+		},
+		{
+			name:    "quoted bracket",
+			message: `Update docs [#124 tagged:"a]b"]`,
+			want:    []string{"#124 tagged:a]b"},
+		},
+		{
+			name:    "keyword names are lowercased",
+			message: "Fix [#123 State:resolved]",
+			want:    []string{"#123 state:resolved"},
+		},
+		{
+			name:    "repeated ticket merges keywords",
+			message: "Fix [#123 state:resolved] and [#124], see [#123 tagged:crash]",
+			want:    []string{"#123 state:resolved tagged:crash", "#124"},
+		},
+		{
+			name:    "references across lines",
+			message: "Fix crash\n\nCloses [#1 state:resolved]\nSee [#2]",
+			want:    []string{"#1 state:resolved", "#2"},
+		},
+		{
+			name:    "revision reference ignored",
+			message: "Revert [1a2b3c] for [#5]",
+			want:    []string{"#5"},
+		},
+		{
+			name:    "not a number",
+			message: "Fix [#abc] and [#0]",
+			want:    []string{},
+		},
+		{
+			name:    "number after keyword",
+			message: "Fix [#1 state:resolved #2]",
+			want:    []string{},
+		},
+		{
+			name:    "keyword without value",
+			message: "Fix [#1 state:]",
+			want:    []string{},
+		},
+		{
+			name:    "unclosed bracket",
+			message: "Fix [#1 state:resolved\n[#2]",
+			want:    []string{"#2"},
+		},
+		{
+			name:    "nested bracket",
+			message: "Fix [#1 [#2]",
+			want:    []string{"#2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := format(Parse(tt.message))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeywordString(t *testing.T) {
+	tests := []struct {
+		keyword *Keyword
+		want    string
+	}{
+		{&Keyword{Name: "state", Value: "resolved"}, "state:resolved"},
+		{&Keyword{Name: "milestone", Value: "Version 1.0"}, `milestone:"Version 1.0"`},
+		{&Keyword{Name: "responsible", Value: ""}, `responsible:""`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.keyword.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
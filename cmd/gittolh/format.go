@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/hooks"
+)
+
+const (
+	defaultTitleTemplate = `{{.Author}} committed changeset [{{.Revision}}] which {{.Change}} {{.RefType}} {{.RefName}}`
+	defaultBodyTemplate  = `{{title .Change}} {{.RefType}} {{.RefName}}:
+
+{{.Log}}
+
+@@@
+{{.DiffStat}}
+@@@`
+)
+
+// templateData is the data available to lighthouse.titleTemplate and
+// lighthouse.bodyTemplate.
+type templateData struct {
+	Author   string
+	Email    string
+	Revision string
+	// Log is the full commit message, Subject its first line and
+	// Body the rest.
+	Log      string
+	Subject  string
+	Body     string
+	DiffStat string
+	// Files are the paths changed by the commit.
+	Files []string
+	// Change is created or updated.
+	Change string
+	// Ref is the full name of the updated ref, RefType its type,
+	// e.g. branch, and RefName its short name.
+	Ref     string
+	RefType string
+	RefName string
+	// URL is the repository's web URL set by lighthouse.webURL.
+	URL string
+}
+
+var templateFuncs = template.FuncMap{
+	"title": strings.Title,
+	"join":  strings.Join,
+}
+
+func getBoolConfig(name string, def bool) bool {
+	value, err := runGit("config", "--bool", "--get", name)
+	if err != nil {
+		return def
+	}
+	return strings.TrimSpace(value) == "true"
+}
+
+func getIntConfig(name string, def int) int {
+	value, err := runGit("config", "--int", "--get", name)
+	if err != nil {
+		return def
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func getWebURL() string {
+	webURL, _ := runGit("config", "--get", "lighthouse.webURL")
+	return strings.TrimRight(strings.TrimSpace(webURL), "/")
+}
+
+// getTemplates returns the title and body templates set with
+// lighthouse.titleTemplate and lighthouse.bodyTemplate, or the
+// defaults.
+func getTemplates() (*template.Template, *template.Template, error) {
+	tmpls := []*template.Template{}
+	for _, t := range []struct{ name, def string }{
+		{"titleTemplate", defaultTitleTemplate},
+		{"bodyTemplate", defaultBodyTemplate},
+	} {
+		text, err := runGit("config", "--get", "lighthouse."+t.name)
+		if err != nil {
+			text = t.def
+		}
+		text = strings.TrimSuffix(text, "\n")
+		tmpl, err := template.New(t.name).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, nil, fmt.Errorf("lighthouse.%s: %v", t.name, err)
+		}
+		tmpls = append(tmpls, tmpl)
+	}
+	return tmpls[0], tmpls[1], nil
+}
+
+func executeTemplate(tmpl *template.Template, data *templateData) (string, error) {
+	buf := &bytes.Buffer{}
+	err := tmpl.Execute(buf, data)
+	if err != nil {
+		return "", fmt.Errorf("lighthouse.%s: %v", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// splitLog splits a commit message into its subject and body.
+func splitLog(commitLog string) (string, string) {
+	commitLog = strings.TrimSpace(commitLog)
+	idx := strings.Index(commitLog, "\n")
+	if idx == -1 {
+		return commitLog, ""
+	}
+	return strings.TrimSpace(commitLog[:idx]), strings.TrimSpace(commitLog[idx+1:])
+}
+
+// refIncluded returns whether updates to a ref should be posted,
+// according to the glob patterns in lighthouse.includeRef and
+// lighthouse.excludeRef.  Patterns starting with refs/ are matched
+// against the full ref name, others against its short name, e.g.
+// main or release/*.  If no include patterns are set, all refs are
+// included.
+func refIncluded(refname, shortName string) bool {
+	matches := func(key string) (bool, bool) {
+		patterns, _ := runGit("config", "--get-all", key)
+		fields := strings.Fields(patterns)
+		for _, pattern := range fields {
+			name := shortName
+			if strings.HasPrefix(pattern, "refs/") {
+				name = refname
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				return true, true
+			}
+		}
+		return false, len(fields) > 0
+	}
+
+	if excluded, _ := matches("lighthouse.excludeRef"); excluded {
+		return false
+	}
+	included, any := matches("lighthouse.includeRef")
+	return included || !any
+}
+
+// createTagChangeset returns a changeset announcing a new tag, posted
+// with the tag name as its revision.
+func createTagChangeset(newrev, refType, tagName, footer string) (*hooks.Changeset, error) {
+	target := strings.TrimSpace(mustRunGit("rev-parse", newrev+"^{commit}"))
+
+	var author, email, message, date string
+	if refType == "annotated tag" {
+		author = strings.TrimSpace(mustRunGit("for-each-ref", "--format=%(taggername)", "refs/tags/"+tagName))
+		email = strings.TrimSpace(mustRunGit("for-each-ref", "--format=%(taggeremail)", "refs/tags/"+tagName))
+		message = strings.TrimSpace(mustRunGit("for-each-ref", "--format=%(contents)", "refs/tags/"+tagName))
+		date = mustRunGit("for-each-ref", "--format=%(taggerdate:unix)", "refs/tags/"+tagName)
+	} else {
+		author = strings.TrimSpace(mustRunGit("show", "-s", "--format=%an", target))
+		email = strings.TrimSpace(mustRunGit("show", "-s", "--format=%ae", target))
+		date = mustRunGit("show", "-s", "--format=%at", target)
+	}
+	email = strings.Trim(email, "<>")
+
+	sec, err := strconv.ParseInt(strings.TrimSpace(date), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	tagTime := time.Unix(sec, 0)
+
+	body := fmt.Sprintf("Created %s %s at [%s].", refType, tagName, target)
+	if len(message) > 0 {
+		body += "\n\n" + message
+	}
+	if ftr := hooks.ExpandFooter(footer, target); len(ftr) > 0 {
+		body += "\n\n" + ftr
+	}
+
+	return &hooks.Changeset{
+		Changeset: &changesets.Changeset{
+			Title:     fmt.Sprintf("%s tagged [%s] as %s", author, target, tagName),
+			Body:      body,
+			Committer: email,
+			Revision:  tagName,
+			ChangedAt: &tagTime,
+			Changes:   changesets.Changes{},
+		},
+		Commit: &hooks.Commit{
+			Revision: tagName,
+			Author:   author,
+			Email:    email,
+			Date:     tagTime,
+			Log:      message,
+		},
+		Ref: tagName,
+	}, nil
+}
+
+// createSummaryChangeset returns a single changeset summarizing a push
+// of more than lighthouse.maxCommits commits, posted as the push's
+// newest revision by its author.  Keywords in all of the commit
+// messages are applied.
+func createSummaryChangeset(from, newrev, change, refType, refShortName string, commits []*hooks.Commit, footer string) (*hooks.Changeset, error) {
+	newest := commits[len(commits)-1]
+
+	oneline := []string{}
+	logs := []string{}
+	// newest first, like 'git log'
+	for i := len(commits) - 1; i >= 0; i-- {
+		subject, _ := splitLog(commits[i].Log)
+		oneline = append(oneline, fmt.Sprintf("[%s] %s", commits[i].Revision, subject))
+		logs = append(logs, commits[i].Log)
+	}
+
+	// diff from where the pushed commits branched off
+	diffSpec := from + "..." + newrev
+	diffStat := mustRunGit("diff", "--stat", diffSpec)
+	changed := mustRunGit("diff", "--name-status", diffSpec)
+
+	title := fmt.Sprintf("%s pushed %d commits which %s %s %s", newest.Author, len(commits), change, refType, refShortName)
+	body := fmt.Sprintf(`%s %s %s:
+
+%s
+
+@@@
+%s
+@@@`, strings.Title(change), refType, refShortName, strings.Join(oneline, "\n"), diffStat)
+	ftr := hooks.ExpandFooter(footer, newrev)
+	if len(ftr) > 0 {
+		body += "\n\n" + ftr
+	}
+
+	summary := &hooks.Commit{
+		Revision: newest.Revision,
+		Author:   newest.Author,
+		Email:    newest.Email,
+		Date:     newest.Date,
+		Branch:   refShortName,
+		Log:      strings.Join(logs, "\n"),
+		Changes:  hooks.ParseChanges(changed),
+		DiffStat: diffStat,
+		Stats:    changesets.ParseDiffStat(diffStat),
+	}
+
+	c := hooks.NewChangeset(summary, title, body, ftr)
+	c.Comment = fmt.Sprintf("(from [%s]) %d commits pushed to %s %s", newrev, len(commits), refType, refShortName)
+	if len(ftr) > 0 {
+		c.Comment += "\n\n" + ftr
+	}
+
+	return c, nil
+}
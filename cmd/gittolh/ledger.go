@@ -0,0 +1,18 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/nwidger/lighthouse/hooks"
+)
+
+// readLedger reads the ledger of revisions posted from this
+// repository, kept in the file lighthouse-posted in the git directory.
+func readLedger() (*hooks.Ledger, error) {
+	gitDir, err := runGit("rev-parse", "--git-dir")
+	if err != nil {
+		return nil, err
+	}
+	return hooks.ReadLedger(filepath.Join(strings.TrimSpace(gitDir), "lighthouse-posted"))
+}
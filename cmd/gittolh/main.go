@@ -1,18 +1,16 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/nwidger/lighthouse"
-	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/credentials"
+	"github.com/nwidger/lighthouse/hooks"
 )
 
 func getAccountAndProject() (string, int, error) {
@@ -36,21 +34,63 @@ func getAccountAndProject() (string, int, error) {
 	return account, projectID, nil
 }
 
-func getToken(commitEmail string) (string, error) {
-	// use name portion of email as git config key
-	name := commitEmail
-	if idx := strings.Index(commitEmail, "@"); idx != -1 {
-		name = commitEmail[:idx]
+// getCredentialStore returns the credential store configured with
+// lighthouse.credentialStore, or nil if none is configured.
+func getCredentialStore() (credentials.Store, error) {
+	store, _ := runGit("config", "--get", "lighthouse.credentialStore")
+	store = strings.TrimSpace(store)
+	if len(store) == 0 {
+		return nil, nil
 	}
 
-	token, _ := runGit("config", "--get", fmt.Sprintf("lighthouse.keys.%s", name))
-	token = strings.TrimSpace(token)
-	if len(token) == 0 {
-		log.Printf("gittolh: unable to find Lighthouse token for %s, please run 'git config lighthouse.keys.%s <token>' on remote repository", name, name)
-		return "", fmt.Errorf("unable to find token for %q", name)
+	file, _ := runGit("config", "--get", "lighthouse.credentialFile")
+	identity, _ := runGit("config", "--get", "lighthouse.credentialIdentity")
+	helper, _ := runGit("config", "--get", "lighthouse.credentialHelper")
+	recipients, _ := runGit("config", "--get-all", "lighthouse.credentialRecipient")
+
+	return credentials.New(&credentials.Config{
+		Store:      store,
+		File:       strings.TrimSpace(file),
+		Recipients: strings.Fields(recipients),
+		Identity:   strings.TrimSpace(identity),
+		Helper:     strings.TrimSpace(helper),
+	})
+}
+
+// getConfig returns the hook's Lighthouse configuration.  Tokens are
+// stored under the name portion of the committer's email, in the
+// credential store or as lighthouse.keys.NAME.
+func getConfig() (*hooks.Config, error) {
+	account, projectID, err := getAccountAndProject()
+	if err != nil {
+		return nil, err
 	}
 
-	return token, nil
+	store, err := getCredentialStore()
+	if err != nil {
+		log.Printf("gittolh: %s", err)
+	}
+
+	return &hooks.Config{
+		Account:   account,
+		ProjectID: projectID,
+		Store:     store,
+		Keys: func(name string) (string, error) {
+			token, _ := runGit("config", "--get", fmt.Sprintf("lighthouse.keys.%s", name))
+			token = strings.TrimSpace(token)
+			if len(token) == 0 {
+				return "", hooks.ErrNoToken
+			}
+			return token, nil
+		},
+		User: func(c *hooks.Commit) string {
+			name := c.Email
+			if idx := strings.Index(name, "@"); idx != -1 {
+				name = name[:idx]
+			}
+			return name
+		},
+	}, nil
 }
 
 func getFooter() string {
@@ -69,14 +109,15 @@ func mustRunGit(args ...string) string {
 	return output
 }
 
+// repo is the repository the hook runs in.
+var repo = &hooks.Git{}
+
 func runGit(args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	output, err := cmd.Output()
-	return string(output), err
+	return repo.Run(args...)
 }
 
-func createChangesets(oldrev, newrev, refname string) ([]*changesets.Changeset, error) {
-	var change, revType, refType, refShortName, revSpec string
+func createChangesets(oldrev, newrev, refname string) ([]*hooks.Changeset, error) {
+	var change, revType, refType, refShortName string
 
 	oldrev = strings.TrimSpace(mustRunGit("rev-parse", oldrev))
 	newrev = strings.TrimSpace(mustRunGit("rev-parse", newrev))
@@ -114,146 +155,234 @@ func createChangesets(oldrev, newrev, refname string) ([]*changesets.Changeset,
 		return nil, nil
 	}
 
-	if change == "deleted" || refType != "branch" {
+	if change == "deleted" || !refIncluded(refname, refShortName) {
 		return nil, nil
 	}
 
-	if change == "created" {
-		revSpec = fmt.Sprintf("HEAD..%s", newrev)
-	} else {
-		revSpec = fmt.Sprintf("%s..%s", oldrev, newrev)
-	}
-
 	footer := getFooter()
 
-	cc := []*changesets.Changeset{}
-
-	commits := strings.TrimSpace(mustRunGit("log", "-s", "--format=%H", revSpec))
-
-	for _, revision := range strings.Split(commits, "\n") {
-		commitAuthor := strings.TrimSpace(mustRunGit("show", "-s", "--format=%an", revision))
-		commitEmail := strings.TrimSpace(mustRunGit("show", "-s", "--format=%ae", revision))
-		commitLog := mustRunGit("show", "-s", "--format=%s%n%n%b", revision)
-		commitDiffStat := mustRunGit("diff", "--stat", fmt.Sprintf("%s^..%s", revision, revision))
-		commitDate := mustRunGit("show", "-s", "--format=%at", revision)
-		commitChanged := mustRunGit("diff-tree", "-r", "--name-status", "--no-commit-id", revision)
-
-		sec, err := strconv.ParseInt(strings.TrimSpace(commitDate), 10, 64)
+	if refType == "tag" || refType == "annotated tag" {
+		if change != "created" || !getBoolConfig("lighthouse.announceTags", false) {
+			return nil, nil
+		}
+		c, err := createTagChangeset(newrev, refType, refShortName, footer)
 		if err != nil {
 			return nil, err
 		}
-		commitTime := time.Unix(sec, 0)
+		return []*hooks.Changeset{c}, nil
+	}
 
-		title := fmt.Sprintf("%s committed changeset [%s] which %s %s %s", commitAuthor, revision, change, refType, refShortName)
-		body := fmt.Sprintf(`%s %s %s:
+	if refType != "branch" {
+		return nil, nil
+	}
 
-%s
+	from := oldrev
+	if change == "created" {
+		from = "HEAD"
+	}
 
-@@@
-%s
-@@@`, strings.Title(change), refType, refShortName, commitLog, commitDiffStat)
-		if len(footer) > 0 {
-			ftr := footer
-			if strings.Contains(ftr, "%s") {
-				ftr = strings.Replace(ftr, "%s", revision, 1)
-			}
-			body += "\n\n" + ftr
+	commits, err := repo.Commits(from, newrev)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, nil
+	}
+
+	if max := getIntConfig("lighthouse.maxCommits", 0); max > 0 && len(commits) > max {
+		c, err := createSummaryChangeset(from, newrev, change, refType, refShortName, commits, footer)
+		if err != nil {
+			return nil, err
 		}
+		return []*hooks.Changeset{c}, nil
+	}
 
-		c := &changesets.Changeset{
-			Title:     title,
-			Body:      body,
-			Committer: commitEmail,
-			Revision:  revision,
-			ChangedAt: &commitTime,
-			Changes:   changesets.Changes{},
+	titleTmpl, bodyTmpl, err := getTemplates()
+	if err != nil {
+		return nil, err
+	}
+	webURL := getWebURL()
+
+	cc := []*hooks.Changeset{}
+
+	for _, commit := range commits {
+		data := &templateData{
+			Author:   commit.Author,
+			Email:    commit.Email,
+			Revision: commit.Revision,
+			Log:      commit.Log,
+			DiffStat: commit.DiffStat,
+			Change:   change,
+			Ref:      refname,
+			RefType:  refType,
+			RefName:  refShortName,
+			URL:      webURL,
+		}
+		data.Subject, data.Body = splitLog(commit.Log)
+		for _, ch := range commit.Changes {
+			data.Files = append(data.Files, ch.Path)
 		}
 
-		for _, line := range strings.Split(commitChanged, "\n") {
-			if len(line) == 0 {
-				continue
-			}
-			idx := strings.IndexAny(line, " \t\f")
-			if idx == -1 {
-				continue
-			}
-			op, field := strings.TrimSpace(line[:idx]),
-				strings.TrimSpace(line[idx:])
-			if len(op) == 0 || len(field) == 0 {
-				continue
-			}
-			c.Changes = append(c.Changes, &changesets.Change{
-				Operation: op,
-				Path:      field,
-			})
+		title, err := executeTemplate(titleTmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		body, err := executeTemplate(bodyTmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		ftr := hooks.ExpandFooter(footer, commit.Revision)
+		if len(ftr) > 0 {
+			body += "\n\n" + ftr
 		}
 
+		commit.Branch = refShortName
+		c := hooks.NewChangeset(commit, strings.TrimSpace(title), body, ftr)
 		cc = append(cc, c)
 	}
 
 	return cc, nil
 }
 
-func gatherAndPost(oldrev, newrev, refname string) error {
-	var ok bool
+// deliverer posts changesets, skipping those which were already
+// posted.
+type deliverer struct {
+	cfg    *hooks.Config
+	poster *hooks.Poster
+	ledger *hooks.Ledger
+}
 
-	account, projectID, err := getAccountAndProject()
-	if err != nil {
-		return err
+func newDeliverer(cfg *hooks.Config) (*deliverer, error) {
+	d := &deliverer{
+		cfg:    cfg,
+		poster: hooks.NewPoster(cfg),
+	}
+	d.poster.Logf = func(format string, v ...interface{}) {
+		log.Printf("gittolh: "+format, v...)
 	}
 
-	cc, err := createChangesets(oldrev, newrev, refname)
-	if err != nil {
-		return err
+	if getBoolConfig("lighthouse.skipPosted", true) {
+		l, err := readLedger()
+		if err != nil {
+			return nil, err
+		}
+		d.ledger = l
 	}
-	if len(cc) == 0 {
-		return nil
+
+	return d, nil
+}
+
+// deliver posts c unless it was already posted, in which case only
+// c's branch is recorded in the ledger.  Existing changesets are never
+// rewritten.  Missing tokens are reported as permanent errors.
+func (d *deliverer) deliver(c *hooks.Changeset) error {
+	if err := d.poster.As(c.Commit); err != nil {
+		name := d.cfg.UserName(c.Commit)
+		log.Printf("gittolh: %s, please run 'lh auth login --account %s --user %s' or 'git config lighthouse.keys.%s <token>' on remote repository", err, d.cfg.Account, name, name)
+		return hooks.Permanent(err)
 	}
+	cs := d.poster.Changesets()
 
-	lt := &lighthouse.Transport{
-		TokenAsBasicAuth: true,
+	if d.ledger != nil {
+		existing, posted, err := d.ledger.AlreadyPosted(cs, c)
+		if err != nil {
+			log.Printf("gittolh: unable to check whether %s was already posted: %s", c.Revision, err)
+		}
+		if posted {
+			if existing != nil {
+				if lerr := d.ledger.Record(c.Revision, c.Ref); lerr != nil {
+					log.Printf("gittolh: %s", lerr)
+				}
+			}
+			return nil
+		}
+	}
+
+	err := d.poster.Post(c)
+	if err != nil {
+		return err
 	}
 
-	client := &http.Client{
-		Transport: lt,
+	if d.ledger != nil {
+		if lerr := d.ledger.Record(c.Revision, c.Ref); lerr != nil {
+			log.Printf("gittolh: %s", lerr)
+		}
 	}
 
-	s := lighthouse.NewService(account, client)
-	cs := changesets.NewService(s, projectID)
+	return nil
+}
 
-	tokens := map[string]string{}
+// gatherAndPost posts the changesets for a ref update, or queues them
+// in the spool if lighthouse.spool is set, in which case it returns
+// true.
+func gatherAndPost(oldrev, newrev, refname string) (bool, error) {
+	cfg, err := getConfig()
+	if err != nil {
+		return false, err
+	}
 
-	for _, c := range cc {
-		if _, ok = tokens[c.Committer]; ok {
-			continue
-		}
-		token, err := getToken(c.Committer)
+	cc, err := createChangesets(oldrev, newrev, refname)
+	if err != nil {
+		return false, err
+	}
+	if len(cc) == 0 {
+		return false, nil
+	}
+
+	if getBoolConfig("lighthouse.spool", false) {
+		spool, err := getSpool()
 		if err != nil {
-			continue
+			return false, err
 		}
-		tokens[c.Committer] = token
+		return true, spool.Enqueue(cc...)
 	}
 
-	err = nil
+	d, err := newDeliverer(cfg)
+	if err != nil {
+		return false, err
+	}
 
-	// iterate list in reverse so older changes are posted first
-	for i := len(cc) - 1; i >= 0; i = i - 1 {
-		c := cc[i]
-		lt.Token = tokens[c.Committer]
-		if len(lt.Token) == 0 {
-			continue
+	// changesets are in commit order so older changes are posted
+	// first
+	for _, c := range cc {
+		if derr := d.deliver(c); derr != nil {
+			err = derr
 		}
-		c, err = cs.Create(c)
 	}
 
-	return err
+	return false, err
 }
 
 func main() {
-	usage := "<oldrev> <newrev> <refname>"
+	drain := flag.Bool("drain", false, "deliver the changesets queued in the spool")
+	list := flag.Bool("list", false, "list the queued and dead changesets in the spool")
+	replay := flag.Bool("replay", false, "queue the dead changesets with the given IDs, or all of them, again")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [<oldrev> <newrev> <refname>]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s --drain | --list | --replay [<id>...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
 
-	if len(os.Args) != 1 && len(os.Args) != 4 {
-		fmt.Fprintf(os.Stderr, "%s\n", usage)
+	switch {
+	case *list:
+		err := listSpool()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case *replay:
+		err := replaySpool(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *drain && len(args) != 0 || len(args) != 0 && len(args) != 3 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
@@ -266,11 +395,21 @@ func main() {
 	mw := io.MultiWriter(os.Stdout, f)
 	log.SetOutput(mw)
 
-	if len(os.Args) == 4 {
-		oldrev, newrev, refname := os.Args[1], os.Args[2], os.Args[3]
+	if *drain {
+		err = drainSpool()
+		if err != nil {
+			fmt.Fprintf(f, "drain: %s\n", err.Error())
+		}
+		return
+	}
+
+	spooled := false
+
+	if len(args) == 3 {
+		oldrev, newrev, refname := args[0], args[1], args[2]
 
 		fmt.Fprintln(f, oldrev, newrev, refname)
-		err = gatherAndPost(oldrev, newrev, refname)
+		spooled, err = gatherAndPost(oldrev, newrev, refname)
 		if err != nil {
 			fmt.Fprintf(f, "%s %s %s: %s\n", oldrev, newrev, refname, err.Error())
 		}
@@ -284,11 +423,18 @@ func main() {
 			}
 
 			fmt.Fprintln(f, oldrev, newrev, refname)
-			err = gatherAndPost(oldrev, newrev, refname)
+			queued, err := gatherAndPost(oldrev, newrev, refname)
 			if err != nil {
 				fmt.Fprintf(f, "%s %s %s: %s\n", oldrev, newrev, refname, err.Error())
 			}
+			spooled = spooled || queued
 		}
 	}
 
+	if spooled && getBoolConfig("lighthouse.drainOnPush", true) {
+		err = startDrain()
+		if err != nil {
+			fmt.Fprintf(f, "drain: %s\n", err.Error())
+		}
+	}
 }
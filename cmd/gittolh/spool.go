@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/hooks"
+)
+
+func getDurationConfig(name string, def time.Duration) time.Duration {
+	value, err := runGit("config", "--get", name)
+	if err != nil {
+		return def
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		log.Printf("gittolh: %s: %s", name, err)
+		return def
+	}
+	return d
+}
+
+// getSpool returns the spool set with lighthouse.spoolDir, by default
+// lighthouse-spool in the git directory.
+func getSpool() (*hooks.Spool, error) {
+	dir, _ := runGit("config", "--get", "lighthouse.spoolDir")
+	dir = strings.TrimSpace(dir)
+	if len(dir) == 0 {
+		gitDir, err := runGit("rev-parse", "--git-dir")
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(strings.TrimSpace(gitDir), "lighthouse-spool")
+	}
+
+	return &hooks.Spool{
+		Dir:         dir,
+		MaxAttempts: getIntConfig("lighthouse.maxAttempts", hooks.DefaultMaxAttempts),
+		Backoff:     getDurationConfig("lighthouse.backoff", hooks.DefaultBackoff),
+		MaxBackoff:  getDurationConfig("lighthouse.maxBackoff", hooks.DefaultMaxBackoff),
+		Logf: func(format string, v ...interface{}) {
+			log.Printf("gittolh: "+format, v...)
+		},
+	}, nil
+}
+
+// startDrain starts 'gittolh --drain' in the background so the hook
+// can return without waiting for Lighthouse.
+func startDrain() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// the drain's output goes to the log file rather than the
+	// hook's output, which git waits on
+	cmd := exec.Command(exe, "--drain")
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	return cmd.Process.Release()
+}
+
+// drainSpool delivers the changesets queued in the spool, unless
+// another drain is already doing so.
+func drainSpool() error {
+	cfg, err := getConfig()
+	if err != nil {
+		return err
+	}
+	cfg.RateLimitInterval = getDurationConfig("lighthouse.rateLimitInterval", lighthouse.DefaultRateLimitInterval)
+
+	spool, err := getSpool()
+	if err != nil {
+		return err
+	}
+
+	d, err := newDeliverer(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = spool.Drain(d.deliver)
+	if err == hooks.ErrSpoolLocked {
+		return nil
+	}
+	return err
+}
+
+func listSpool() error {
+	spool, err := getSpool()
+	if err != nil {
+		return err
+	}
+
+	queued, err := spool.Queued()
+	if err != nil {
+		return err
+	}
+	dead, err := spool.Dead()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tREVISION\tATTEMPTS\tLAST ERROR")
+	for _, ee := range []struct {
+		state   string
+		entries []*hooks.SpoolEntry
+	}{
+		{"queued", queued},
+		{"dead", dead},
+	} {
+		for _, e := range ee.entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", e.ID, ee.state, e.Changeset.Revision, e.Attempts, e.LastError)
+		}
+	}
+	return w.Flush()
+}
+
+func replaySpool(ids []string) error {
+	spool, err := getSpool()
+	if err != nil {
+		return err
+	}
+
+	n, err := spool.Replay(ids...)
+	fmt.Fprintf(os.Stderr, "queued %d dead changesets again\n", n)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 && getBoolConfig("lighthouse.drainOnPush", true) {
+		return startDrain()
+	}
+	return nil
+}
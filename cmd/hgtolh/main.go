@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nwidger/lighthouse/credentials"
+	"github.com/nwidger/lighthouse/hooks"
+)
+
+// repo is the repository the hook runs in.
+var repo = &hooks.Hg{}
+
+// getConfig returns the value of name from the repository's
+// configuration, including .hg/hgrc, or the empty string if it isn't
+// set.
+func getConfig(name string) string {
+	value, err := repo.Run("config", name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+func getAccountAndProject() (string, int, error) {
+	account := getConfig("lighthouse.account")
+	projectStr := getConfig("lighthouse.project")
+
+	if len(account) == 0 {
+		log.Printf("hgtolh: unable to find Lighthouse account name, please set account in the [lighthouse] section of .hg/hgrc")
+		return "", 0, fmt.Errorf("empty account name %q", account)
+	}
+
+	projectID, err := strconv.Atoi(projectStr)
+	if err != nil {
+		log.Printf("hgtolh: unable to find Lighthouse project ID, please set project in the [lighthouse] section of .hg/hgrc")
+		return "", 0, fmt.Errorf("unable to parse project ID %q", projectStr)
+	}
+
+	return account, projectID, nil
+}
+
+// getCredentialStore returns the credential store configured with
+// credentialStore in the [lighthouse] section, or nil if none is
+// configured.
+func getCredentialStore() (credentials.Store, error) {
+	store := getConfig("lighthouse.credentialStore")
+	if len(store) == 0 {
+		return nil, nil
+	}
+
+	return credentials.New(&credentials.Config{
+		Store:      store,
+		File:       getConfig("lighthouse.credentialFile"),
+		Recipients: strings.FieldsFunc(getConfig("lighthouse.credentialRecipients"), isListSeparator),
+		Identity:   getConfig("lighthouse.credentialIdentity"),
+		Helper:     getConfig("lighthouse.credentialHelper"),
+	})
+}
+
+// isListSeparator reports whether r separates the values of a list in
+// an hgrc file.
+func isListSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t' || r == '\n'
+}
+
+// getKeys looks up name in the [lighthouse.keys] section.
+func getKeys(name string) (string, error) {
+	token := getConfig(fmt.Sprintf("lighthouse.keys.%s", name))
+	if len(token) == 0 {
+		return "", hooks.ErrNoToken
+	}
+	return token, nil
+}
+
+// getUser returns the name the token for c's author is stored under,
+// the name portion of their email if they have one, otherwise their
+// name.
+func getUser(c *hooks.Commit) string {
+	name := c.Email
+	if idx := strings.Index(name, "@"); idx != -1 {
+		name = name[:idx]
+	}
+	if len(name) == 0 {
+		name = c.Author
+	}
+	return name
+}
+
+// getRevset returns the changesets the hook was run for.  A
+// changegroup hook is passed the first changeset added in HG_NODE and
+// the last in HG_NODE_LAST, an incoming hook a single changeset in
+// HG_NODE.
+func getRevset() (string, error) {
+	node, last := os.Getenv("HG_NODE"), os.Getenv("HG_NODE_LAST")
+	hookType := os.Getenv("HG_HOOKTYPE")
+
+	switch {
+	case len(node) == 0:
+		return "", fmt.Errorf("HG_NODE is not set, %s must be run as a changegroup or incoming hook", os.Args[0])
+	case len(last) > 0:
+		return fmt.Sprintf("%s:%s", node, last), nil
+	case hookType == "changegroup":
+		// older versions of Mercurial don't set HG_NODE_LAST
+		return fmt.Sprintf("%s:tip", node), nil
+	default:
+		return node, nil
+	}
+}
+
+func createChangesets(revset string) ([]*hooks.Changeset, error) {
+	commits, err := repo.Log(revset)
+	if err != nil {
+		return nil, err
+	}
+
+	footer := getConfig("lighthouse.footer")
+
+	cc := []*hooks.Changeset{}
+
+	for _, commit := range commits {
+		title := fmt.Sprintf("%s committed changeset [%s] on branch %s", commit.Author, commit.Revision, commit.Branch)
+		body := fmt.Sprintf(`Commit log:
+
+%s
+
+@@@
+%s
+@@@`, strings.TrimSpace(commit.Log), commit.DiffStat)
+		ftr := hooks.ExpandFooter(footer, commit.Revision)
+		if len(ftr) > 0 {
+			body += "\n\n" + ftr
+		}
+
+		c := hooks.NewChangeset(commit, title, body, ftr)
+		cc = append(cc, c)
+	}
+
+	return cc, nil
+}
+
+func gatherAndPost(revset string) error {
+	account, projectID, err := getAccountAndProject()
+	if err != nil {
+		return err
+	}
+
+	store, err := getCredentialStore()
+	if err != nil {
+		log.Printf("hgtolh: %s", err)
+	}
+
+	cfg := &hooks.Config{
+		Account:   account,
+		ProjectID: projectID,
+		Store:     store,
+		Keys:      getKeys,
+		User:      getUser,
+	}
+
+	cc, err := createChangesets(revset)
+	if err != nil {
+		return err
+	}
+
+	poster := hooks.NewPoster(cfg)
+	poster.Logf = func(format string, v ...interface{}) {
+		log.Printf("hgtolh: "+format, v...)
+	}
+
+	// the first error is returned, but every changeset is still
+	// attempted so one failure doesn't hold up the rest
+	var firstErr error
+
+	// changesets are in revision order so older changes are posted
+	// first
+	for _, c := range cc {
+		if err := poster.As(c.Commit); err != nil {
+			name := cfg.UserName(c.Commit)
+			log.Printf("hgtolh: %s, please run 'lh auth login --account %s --user %s' or set %s in the [lighthouse.keys] section of .hg/hgrc", err, account, name, name)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %s", c.Revision, err)
+			}
+			continue
+		}
+		if err := poster.Post(c); err != nil {
+			log.Printf("hgtolh: %s: %s", c.Revision, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %s", c.Revision, err)
+			}
+		}
+	}
+
+	return firstErr
+}
+
+func main() {
+	f, err := os.OpenFile("/tmp/hg-hooks.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	mw := io.MultiWriter(os.Stdout, f)
+	log.SetOutput(mw)
+
+	revset, err := getRevset()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Fprintln(f, revset)
+	err = gatherAndPost(revset)
+	if err != nil {
+		fmt.Fprintf(f, "%s: %s\n", revset, err.Error())
+	}
+}
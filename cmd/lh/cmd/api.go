@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type apiCmdOpts struct {
+	data     string
+	fields   []string
+	paginate bool
+}
+
+var apiCmdFlags apiCmdOpts
+
+// apiCmd represents the api command
+var apiCmd = &cobra.Command{
+	Use:   "api METHOD PATH",
+	Short: "Make an authenticated Lighthouse API request",
+	Long: `Make an authenticated Lighthouse API request
+
+Sends a request to an arbitrary Lighthouse API endpoint using the
+configured account, credentials, rate limiting and retries, which is
+useful for endpoints this library doesn't wrap.  PATH is relative to
+the account's URL, for example projects/1234/tickets/56/watchers.json.
+
+The request body is given with --data, either as JSON, @FILE to read
+it from FILE or @- to read it from stdin.  Alternatively, --field
+KEY=VALUE sets a field of a JSON request body, where dots in KEY
+create nested objects, e.g. ticket.title=Hello.  VALUE is sent as a
+number, true, false or null if it parses as one, otherwise as a
+string.  For GET requests, fields are instead sent as query
+parameters.
+
+JSON responses are printed using --output, other responses are
+written to stdout unchanged.  With --paginate, GET requests are
+repeated with page=2, page=3 and so on until a page has no results,
+and the results are combined into a single response.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := apiCmdFlags
+		if len(args) != 2 {
+			FatalUsage(cmd, "must supply method and path")
+		}
+		method, path := strings.ToUpper(args[0]), args[1]
+		if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+			path = service.BasePath + "/" + strings.TrimPrefix(path, "/")
+		}
+		u, err := url.Parse(path)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		var body []byte
+		switch {
+		case len(flags.data) > 0 && len(flags.fields) > 0 && method != "GET":
+			FatalUsage(cmd, "--data and --field cannot be used together")
+		case len(flags.data) > 0:
+			body, err = apiData(flags.data)
+		case len(flags.fields) > 0 && method == "GET":
+			err = apiQuery(u, flags.fields)
+		case len(flags.fields) > 0:
+			body, err = apiFields(flags.fields)
+		}
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		if !flags.paginate || method != "GET" {
+			_, err = apiRequest(method, u.String(), body, true)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			return
+		}
+
+		err = apiPaginate(u)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+// apiData returns the request body given by --data.
+func apiData(data string) ([]byte, error) {
+	switch {
+	case data == "@-":
+		return ioutil.ReadAll(os.Stdin)
+	case strings.HasPrefix(data, "@"):
+		return ioutil.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
+
+func apiFieldValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return json.Number(value)
+	}
+	return value
+}
+
+func splitField(field string) (string, string, error) {
+	idx := strings.Index(field, "=")
+	if idx <= 0 {
+		return "", "", fmt.Errorf("invalid field %q, must be KEY=VALUE", field)
+	}
+	return field[:idx], field[idx+1:], nil
+}
+
+// apiFields returns a JSON request body built from --field values.
+func apiFields(fields []string) ([]byte, error) {
+	obj := map[string]interface{}{}
+	for _, field := range fields {
+		key, value, err := splitField(field)
+		if err != nil {
+			return nil, err
+		}
+		keys := strings.Split(key, ".")
+		m := obj
+		for _, k := range keys[:len(keys)-1] {
+			next, ok := m[k].(map[string]interface{})
+			if !ok {
+				if _, exists := m[k]; exists {
+					return nil, fmt.Errorf("field %q conflicts with another field", key)
+				}
+				next = map[string]interface{}{}
+				m[k] = next
+			}
+			m = next
+		}
+		m[keys[len(keys)-1]] = apiFieldValue(value)
+	}
+	return json.Marshal(obj)
+}
+
+// apiQuery adds --field values to u's query parameters.
+func apiQuery(u *url.URL, fields []string) error {
+	values := u.Query()
+	for _, field := range fields {
+		key, value, err := splitField(field)
+		if err != nil {
+			return err
+		}
+		values.Add(key, value)
+	}
+	u.RawQuery = values.Encode()
+	return nil
+}
+
+// apiRequest sends a request and returns the response body.  If print
+// is true, the response is also printed.
+func apiRequest(method, path string, body []byte, print bool) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	resp, err := service.RoundTrip(method, path, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s: %s\n%s", method, path, resp.Status, strings.TrimSpace(string(buf)))
+	}
+
+	if print && len(bytes.TrimSpace(buf)) > 0 {
+		if !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+			_, err = os.Stdout.Write(buf)
+			return buf, err
+		}
+		v, err := apiDecode(buf)
+		if err != nil {
+			return nil, err
+		}
+		apiRender(v)
+	}
+
+	return buf, nil
+}
+
+func apiDecode(buf []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// apiPaginate requests successive pages of u, combining the results.
+// Lighthouse list responses are an object with a single array field,
+// e.g. {"tickets": [...]}.  Paging stops at the first empty page, if
+// the response isn't a list or if a page repeats the previous page,
+// as happens with endpoints which ignore the page parameter.
+func apiPaginate(u *url.URL) error {
+	var (
+		key      string
+		results  []interface{}
+		previous []byte
+		pages    int
+	)
+
+	values := u.Query()
+	page := 1
+	if p, err := strconv.Atoi(values.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+
+	for ; ; page++ {
+		values.Set("page", strconv.Itoa(page))
+		u.RawQuery = values.Encode()
+
+		buf, err := apiRequest("GET", u.String(), nil, false)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(buf, previous) {
+			break
+		}
+		previous = buf
+
+		v, err := apiDecode(buf)
+		if err != nil {
+			return err
+		}
+		k, items, ok := apiList(v)
+		if !ok {
+			if pages == 0 {
+				apiRender(v)
+				return nil
+			}
+			break
+		}
+		pages++
+		key = k
+		if len(items) == 0 {
+			break
+		}
+		results = append(results, items...)
+	}
+
+	if results == nil {
+		results = []interface{}{}
+	}
+	if len(key) == 0 {
+		apiRender(results)
+		return nil
+	}
+	apiRender(map[string]interface{}{key: results})
+	return nil
+}
+
+// apiRender prints a response.  For the csv and table formats,
+// Lighthouse's response envelopes such as {"tickets": [{"ticket":
+// {...}}]} are removed first so there are fields to print.
+func apiRender(v interface{}) {
+	if output := Output(); output == "csv" || output == "table" {
+		v = apiUnwrap(v)
+		if items, ok := v.([]interface{}); ok {
+			for i := range items {
+				items[i] = apiUnwrap(items[i])
+			}
+		}
+	}
+	Render(v)
+}
+
+// apiUnwrap returns the value of an object with a single object or
+// array field, otherwise v.
+func apiUnwrap(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return v
+	}
+	for _, value := range m {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return value
+		}
+	}
+	return v
+}
+
+// apiList returns the array of a list response, which is either an
+// array or an object with a single array field.
+func apiList(v interface{}) (string, []interface{}, bool) {
+	switch v := v.(type) {
+	case []interface{}:
+		return "", v, true
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return "", nil, false
+		}
+		for key, value := range v {
+			items, ok := value.([]interface{})
+			return key, items, ok
+		}
+	}
+	return "", nil, false
+}
+
+func init() {
+	RootCmd.AddCommand(apiCmd)
+	apiCmd.Flags().StringVar(&apiCmdFlags.data, "data", "", "Request body as JSON, @FILE or @- for stdin")
+	apiCmd.Flags().StringArrayVar(&apiCmdFlags.fields, "field", nil, "Set a request body field or GET query parameter as KEY=VALUE (repeatable)")
+	apiCmd.Flags().BoolVar(&apiCmdFlags.paginate, "paginate", false, "Follow page parameters and combine the results of GET requests")
+}
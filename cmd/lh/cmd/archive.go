@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/profiles"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/nwidger/lighthouse/users"
+)
+
+// archive is the in-memory representation of an archive written by
+// 'lh export'.
+type archive struct {
+	account  string
+	plan     *lighthouse.Plan
+	profile  *profiles.User
+	projects []*archiveProject
+	users    []*archiveUser
+}
+
+type archiveProject struct {
+	*projects.Project
+
+	memberships projects.Memberships
+	bins        bins.Bins
+	changesets  changesets.Changesets
+	messages    messages.Messages
+	milestones  milestones.Milestones
+	tickets     []*archiveTicket
+}
+
+type archiveTicket struct {
+	*tickets.Ticket
+
+	attachments []*archiveAttachment
+}
+
+type archiveAttachment struct {
+	*tickets.Attachment
+
+	data []byte
+}
+
+type archiveUser struct {
+	*users.User
+
+	memberships users.Memberships
+	avatar      *archiveFile
+}
+
+type archiveFile struct {
+	filename string
+	data     []byte
+}
+
+func (a *archive) project(id int) *archiveProject {
+	for _, p := range a.projects {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (a *archive) user(id int) *archiveUser {
+	for _, u := range a.users {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+func (p *archiveProject) milestone(id int) *milestones.Milestone {
+	for _, m := range p.milestones {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func (p *archiveProject) ticket(number int) *archiveTicket {
+	for _, t := range p.tickets {
+		if t.Number == number {
+			return t
+		}
+	}
+	return nil
+}
+
+// readArchive reads the gzipped tar archive at filename.  The whole
+// archive, including attachments and avatars, is held in memory.
+func readArchive(filename string) (*archive, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	z, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	// read every regular file first, the archive layout is
+	// assembled afterwards so we don't depend on the order
+	// entries were written in
+	files := map[string][]byte{}
+	tr := tar.NewReader(z)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		buf, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(hdr.Name)] = buf
+	}
+
+	return newArchive(files)
+}
+
+func newArchive(files map[string][]byte) (*archive, error) {
+	a := &archive{}
+
+	projectsMap := map[string]*archiveProject{}
+	ticketsMap := map[string]*archiveTicket{}
+	usersMap := map[string]*archiveUser{}
+
+	decode := func(name string, v interface{}) error {
+		err := json.Unmarshal(files[name], v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// pass one: projects, tickets and users, which everything
+	// else hangs off of
+	for _, name := range names {
+		parts := strings.Split(name, "/")
+		if len(a.account) == 0 {
+			a.account = parts[0]
+		}
+		switch {
+		case len(parts) == 2 && parts[1] == "plan.json":
+			a.plan = &lighthouse.Plan{}
+			if err := decode(name, a.plan); err != nil {
+				return nil, err
+			}
+		case len(parts) == 2 && parts[1] == "profile.json":
+			a.profile = &profiles.User{}
+			if err := decode(name, a.profile); err != nil {
+				return nil, err
+			}
+		case len(parts) == 4 && parts[1] == "projects" && parts[3] == "project.json":
+			p := &archiveProject{Project: &projects.Project{}}
+			if err := decode(name, p.Project); err != nil {
+				return nil, err
+			}
+			projectsMap[parts[2]] = p
+			a.projects = append(a.projects, p)
+		case len(parts) == 6 && parts[1] == "projects" && parts[3] == "tickets" && parts[5] == "ticket.json":
+			t := &archiveTicket{Ticket: &tickets.Ticket{}}
+			if err := decode(name, t.Ticket); err != nil {
+				return nil, err
+			}
+			ticketsMap[path.Dir(name)] = t
+		case len(parts) == 4 && parts[1] == "users" && parts[3] == "user.json":
+			u := &archiveUser{User: &users.User{}}
+			if err := decode(name, u.User); err != nil {
+				return nil, err
+			}
+			usersMap[parts[2]] = u
+			a.users = append(a.users, u)
+		}
+	}
+
+	// pass two: everything belonging to a project, ticket or
+	// user
+	for _, name := range names {
+		parts := strings.Split(name, "/")
+		switch {
+		case len(parts) >= 4 && parts[1] == "projects":
+			p, ok := projectsMap[parts[2]]
+			if !ok {
+				continue
+			}
+			switch {
+			case len(parts) == 4 && parts[3] == "memberships.json":
+				if err := decode(name, &p.memberships); err != nil {
+					return nil, err
+				}
+			case len(parts) == 5 && parts[3] == "bins":
+				b := &bins.Bin{}
+				if err := decode(name, b); err != nil {
+					return nil, err
+				}
+				p.bins = append(p.bins, b)
+			case len(parts) == 5 && parts[3] == "changesets":
+				c := &changesets.Changeset{}
+				if err := decode(name, c); err != nil {
+					return nil, err
+				}
+				p.changesets = append(p.changesets, c)
+			case len(parts) == 5 && parts[3] == "messages":
+				m := &messages.Message{}
+				if err := decode(name, m); err != nil {
+					return nil, err
+				}
+				p.messages = append(p.messages, m)
+			case len(parts) == 5 && parts[3] == "milestones":
+				m := &milestones.Milestone{}
+				if err := decode(name, m); err != nil {
+					return nil, err
+				}
+				p.milestones = append(p.milestones, m)
+			case len(parts) == 6 && parts[3] == "tickets":
+				t, ok := ticketsMap[path.Dir(name)]
+				if !ok {
+					continue
+				}
+				if parts[5] == "ticket.json" {
+					p.tickets = append(p.tickets, t)
+					continue
+				}
+				for _, ar := range t.Attachments {
+					if ar.Attachment != nil && ar.Attachment.Filename == parts[5] {
+						t.attachments = append(t.attachments, &archiveAttachment{
+							Attachment: ar.Attachment,
+							data:       files[name],
+						})
+						break
+					}
+				}
+			}
+		case len(parts) == 4 && parts[1] == "users":
+			u, ok := usersMap[parts[2]]
+			if !ok {
+				continue
+			}
+			switch {
+			case parts[3] == "memberships.json":
+				if err := decode(name, &u.memberships); err != nil {
+					return nil, err
+				}
+			case strings.HasPrefix(parts[3], "avatar."):
+				u.avatar = &archiveFile{
+					filename: parts[3],
+					data:     files[name],
+				}
+			}
+		}
+	}
+
+	if len(a.account) == 0 {
+		return nil, fmt.Errorf("empty archive")
+	}
+
+	sort.Slice(a.projects, func(i, j int) bool { return a.projects[i].ID < a.projects[j].ID })
+	sort.Slice(a.users, func(i, j int) bool { return a.users[i].ID < a.users[j].ID })
+	for _, p := range a.projects {
+		sort.Slice(p.bins, func(i, j int) bool { return p.bins[i].ID < p.bins[j].ID })
+		sort.Slice(p.changesets, func(i, j int) bool {
+			ci, cj := p.changesets[i].ChangedAt, p.changesets[j].ChangedAt
+			if ci == nil || cj == nil {
+				return p.changesets[i].Revision < p.changesets[j].Revision
+			}
+			return ci.Before(*cj)
+		})
+		sort.Slice(p.messages, func(i, j int) bool { return p.messages[i].ID < p.messages[j].ID })
+		sort.Slice(p.milestones, func(i, j int) bool { return p.milestones[i].ID < p.milestones[j].ID })
+		sort.Slice(p.tickets, func(i, j int) bool { return p.tickets[i].Number < p.tickets[j].Number })
+	}
+
+	return a, nil
+}
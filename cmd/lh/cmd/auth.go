@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nwidger/lighthouse/credentials"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// CredentialStore returns the credential store selected by the
+// credential-* settings.
+func CredentialStore() (credentials.Store, error) {
+	recipients := []string{}
+	for _, r := range viper.GetStringSlice("credential-recipients") {
+		for _, rr := range strings.Split(r, ",") {
+			if rr = strings.TrimSpace(rr); len(rr) > 0 {
+				recipients = append(recipients, rr)
+			}
+		}
+	}
+	return credentials.New(&credentials.Config{
+		Store:      viper.GetString("credential-store"),
+		File:       expandHome(viper.GetString("credential-file")),
+		Recipients: recipients,
+		Identity:   expandHome(viper.GetString("credential-identity")),
+		Helper:     viper.GetString("credential-helper"),
+	})
+}
+
+// StoredToken returns the token for user in account from the
+// credential store.  An empty user is the account's default token.
+func StoredToken(account, user string) (string, error) {
+	store, err := CredentialStore()
+	if err != nil {
+		return "", err
+	}
+	return store.Get(account, user)
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// authCmd represents the auth command
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage Lighthouse API tokens in a credential store",
+	Long: `Manage Lighthouse API tokens in a credential store
+
+Rather than keeping API tokens in plaintext in the config file, they
+can be kept in a credential store selected with the credential-store
+setting:
+
+  keyring  The Secret Service (GNOME Keyring, KWallet) via secret-tool,
+           or the macOS login keychain.
+  gpg      A file encrypted with gpg, set with credential-file.  The
+           file is encrypted to credential-recipients, or your own
+           key by default.
+  age      A file encrypted with age, set with credential-file.  The
+           file is encrypted to credential-recipients and decrypted
+           with the identity file credential-identity.
+  helper   An external credential helper speaking git's credential
+           helper protocol, set with credential-helper, for example
+           'osxkeychain' or '!pass-lighthouse'.
+
+For example:
+
+  credential-store: gpg
+  credential-file: ~/.lh-credentials.gpg
+
+If no token or email/password is given, lh uses the account's token
+from the credential store.  Tokens for other users, such as those
+used by the gittolh and svntolh commit hooks, can be stored with
+--user.
+
+`,
+	// API requests are made with the token being logged in, don't
+	// require existing credentials
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if contextErr != nil {
+			FatalUsage(cmd, contextErr)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(authCmd)
+}
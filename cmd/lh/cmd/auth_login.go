@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/profiles"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type authLoginCmdOpts struct {
+	user string
+}
+
+var authLoginCmdFlags authLoginCmdOpts
+
+// authLoginCmd represents the auth login command
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Save an API token in the credential store",
+	Long: `Save an API token in the credential store
+
+The token is taken from -t, --token or LH_TOKEN if given, otherwise it
+is read from standard input.  The token is checked by fetching the
+token owner's profile before it is saved.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := authLoginCmdFlags
+		account := Account()
+		store, err := CredentialStore()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		token := viper.GetString("token")
+		if len(token) == 0 {
+			fmt.Fprintf(os.Stderr, "Lighthouse API token for %s: ", account)
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && len(line) == 0 {
+				FatalUsage(cmd, err)
+			}
+			token = strings.TrimSpace(line)
+		}
+		if len(token) == 0 {
+			FatalUsage(cmd, "Please specify a token")
+		}
+		s := newService(account, &lighthouse.Transport{
+			Token:            token,
+			TokenAsBasicAuth: true,
+		})
+		u, err := profiles.NewService(s).Get()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = store.Set(account, flags.user, token)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		fmt.Fprintf(os.Stderr, "Logged in to %s as %s\n", account, u.Name)
+	},
+}
+
+func init() {
+	authCmd.AddCommand(authLoginCmd)
+	authLoginCmd.Flags().StringVar(&authLoginCmdFlags.user, "user", "", "Save the token for a commit hook user instead of as lh's token")
+}
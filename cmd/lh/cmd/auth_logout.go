@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+type authLogoutCmdOpts struct {
+	user string
+}
+
+var authLogoutCmdFlags authLogoutCmdOpts
+
+// authLogoutCmd represents the auth logout command
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove an API token from the credential store",
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := authLogoutCmdFlags
+		account := Account()
+		store, err := CredentialStore()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = store.Delete(account, flags.user)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		fmt.Fprintf(os.Stderr, "Logged out of %s\n", account)
+	},
+}
+
+func init() {
+	authCmd.AddCommand(authLogoutCmd)
+	authLogoutCmd.Flags().StringVar(&authLogoutCmdFlags.user, "user", "", "Remove the token of a commit hook user instead of lh's token")
+}
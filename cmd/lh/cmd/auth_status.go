@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/credentials"
+	"github.com/nwidger/lighthouse/profiles"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type authStatusCmdOpts struct {
+	user string
+}
+
+var authStatusCmdFlags authStatusCmdOpts
+
+// authStatus describes the token stored for an account.  The token
+// itself is never printed.
+type authStatus struct {
+	Account  string `json:"account"`
+	Store    string `json:"store"`
+	User     string `json:"user,omitempty"`
+	LoggedIn bool   `json:"logged_in"`
+	Name     string `json:"name,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// authStatusCmd represents the auth status command
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check the API token in the credential store",
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := authStatusCmdFlags
+		account := Account()
+		st := &authStatus{
+			Account: account,
+			Store:   viper.GetString("credential-store"),
+			User:    flags.user,
+		}
+		token, err := StoredToken(account, flags.user)
+		if err == nil {
+			s := newService(account, &lighthouse.Transport{
+				Token:            token,
+				TokenAsBasicAuth: true,
+			})
+			var u *profiles.User
+			u, err = profiles.NewService(s).Get()
+			if err == nil {
+				st.LoggedIn, st.Name = true, u.Name
+			}
+		}
+		if err != nil && err != credentials.ErrNotFound {
+			st.Error = err.Error()
+		}
+		Render(st)
+	},
+}
+
+func init() {
+	authCmd.AddCommand(authStatusCmd)
+	authStatusCmd.Flags().StringVar(&authStatusCmdFlags.user, "user", "", "Check the token of a commit hook user instead of lh's token")
+}
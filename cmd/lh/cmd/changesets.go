@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// changesetsGroupCmd represents the changesets command
+var changesetsGroupCmd = &cobra.Command{
+	Use:   "changesets",
+	Short: "Manage a project's changesets",
+}
+
+func init() {
+	RootCmd.AddCommand(changesetsGroupCmd)
+}
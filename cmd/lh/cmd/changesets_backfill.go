@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/hooks"
+	"github.com/spf13/cobra"
+)
+
+type changesetsBackfillCmdOpts struct {
+	repo       string
+	since      string
+	committers []string
+	state      string
+	dryRun     bool
+}
+
+var changesetsBackfillCmdFlags changesetsBackfillCmdOpts
+
+// backfilledChangeset is a changeset created by 'lh changesets
+// backfill'.
+type backfilledChangeset struct {
+	Revision  string    `json:"revision"`
+	Title     string    `json:"title"`
+	ChangedAt time.Time `json:"changed_at"`
+	Committer string    `json:"committer"`
+	UserID    int       `json:"user_id,omitempty"`
+	// Resumed is set if the changeset was created by an earlier
+	// run.
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// backfillState records the changesets created by a backfill so an
+// interrupted run can be resumed where it left off.
+type backfillState struct {
+	resumeState
+
+	Created map[string]*backfilledChangeset `json:"created"`
+}
+
+func readBackfillState(filename string) (*backfillState, error) {
+	st := &backfillState{}
+	err := readState(filename, st)
+	if err != nil {
+		return nil, err
+	}
+	if st.Created == nil {
+		st.Created = map[string]*backfilledChangeset{}
+	}
+	return st, nil
+}
+
+// openBackfillRepository returns the git or Subversion repository at
+// path and its newest revision.
+func openBackfillRepository(path string) (hooks.Repository, string, error) {
+	g := &hooks.Git{Dir: path}
+	if _, err := g.Run("rev-parse", "--git-dir"); err == nil {
+		return g, "HEAD", nil
+	}
+
+	s := &hooks.SVN{Path: path}
+	if youngest, err := s.Run("youngest"); err == nil {
+		return s, strings.TrimSpace(youngest), nil
+	}
+
+	return nil, "", fmt.Errorf("%s is not a git or Subversion repository", path)
+}
+
+// svnRevisionBefore returns the newest revision of s committed before
+// since, or the empty string if there is none, by binary search since
+// Subversion revisions are in date order.
+func svnRevisionBefore(s *hooks.SVN, youngest string, since time.Time) (string, error) {
+	n, err := strconv.Atoi(youngest)
+	if err != nil {
+		return "", fmt.Errorf("invalid revision %q", youngest)
+	}
+
+	var searchErr error
+	first := sort.Search(n, func(i int) bool {
+		date, err := s.Date(strconv.Itoa(i + 1))
+		if err != nil && searchErr == nil {
+			searchErr = err
+		}
+		return !date.Before(since)
+	}) + 1
+	if searchErr != nil {
+		return "", searchErr
+	}
+
+	if first <= 1 {
+		return "", nil
+	}
+	return strconv.Itoa(first - 1), nil
+}
+
+// backfillCommits returns the commits in repo after since, a date or
+// revision, up to head.
+func backfillCommits(repo hooks.Repository, head, since string) ([]*hooks.Commit, error) {
+	if len(since) == 0 {
+		return repo.Commits("", head)
+	}
+
+	date, err := parseDate(since)
+	if err != nil {
+		// not a date, so a revision
+		return repo.Commits(since, head)
+	}
+
+	if s, ok := repo.(*hooks.SVN); ok {
+		from, err := svnRevisionBefore(s, head, date)
+		if err != nil {
+			return nil, err
+		}
+		return repo.Commits(from, head)
+	}
+
+	all, err := repo.Commits("", head)
+	if err != nil {
+		return nil, err
+	}
+	commits := []*hooks.Commit{}
+	for _, c := range all {
+		if !c.Date.Before(date) {
+			commits = append(commits, c)
+		}
+	}
+	return commits, nil
+}
+
+// resolveCommitters resolves the Lighthouse users given by --committer
+// AUTHOR=USER to user IDs.
+func resolveCommitters(committers []string) (map[string]int, error) {
+	m, err := parseVars(committers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid committer, must be AUTHOR=USER: %v", err)
+	}
+
+	ids := map[string]int{}
+	byUser := map[string]int{}
+	for author, user := range m {
+		id, ok := byUser[user]
+		if !ok {
+			id, err = UserID(user)
+			if err != nil {
+				return nil, fmt.Errorf("committer %s: user %s: %v", author, user, err)
+			}
+			byUser[user] = id
+		}
+		ids[author] = id
+	}
+	return ids, nil
+}
+
+// backfillChangeset returns the changeset created for c.
+func backfillChangeset(c *hooks.Commit) *hooks.Changeset {
+	title := fmt.Sprintf("%s committed changeset [%s]", c.Author, c.Revision)
+	body := fmt.Sprintf("Commit log:\n\n%s", strings.TrimSpace(c.Log))
+	if len(c.DiffStat) > 0 {
+		body += fmt.Sprintf("\n\n@@@\n%s\n@@@", c.DiffStat)
+	}
+	return hooks.NewChangeset(c, title, body, "")
+}
+
+// changesetsBackfillCmd represents the changesets backfill command
+var changesetsBackfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Create changesets for a repository's existing history (requires -p)",
+	Long: `Create changesets for a repository's existing history (requires -p)
+
+Walks the git or Subversion repository at --repo, oldest commit first,
+and creates a changeset for each commit, dated when it was committed.
+For Subversion, --repo is the repository's path on disk as used by
+svnlook.  By default the whole history is backfilled; --since limits
+it to commits on or after a date (YYYY-MM-DD) or after a revision.
+
+Changesets are created with your token.  To attribute them to the
+committers' Lighthouse users, map each commit author's email (git) or
+username (Subversion) to a user with --committer:
+
+  lh changesets backfill -p 1234 --repo . --since v1.0 \
+    --committer alice@example.com=alice --committer bob@example.com=bob
+
+Revisions which already have a changeset in the project are skipped,
+so a backfill may overlap commits already posted by gittolh or
+svntolh.  Ticket references in commit messages set the changeset's
+ticket, but their keywords aren't applied to the tickets.  Requests
+are throttled by --rate-limit-interval.
+
+The created changesets are recorded in the file given by --state-file
+(default REPO.ACCOUNT.PROJECT.backfill.json in the current directory)
+after each one is created.  If the backfill is interrupted, re-running
+the command with the same state file resumes where it left off.  A
+state file can only be resumed in the account and project it was
+created for.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := changesetsBackfillCmdFlags
+		if len(flags.repo) == 0 {
+			FatalUsage(cmd, "must supply --repo path")
+		}
+		path, err := filepath.Abs(flags.repo)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		projectID := Project()
+		committers, err := resolveCommitters(flags.committers)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		repo, head, err := openBackfillRepository(path)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		commits, err := backfillCommits(repo, head, flags.since)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		stateFilename := flags.state
+		if len(stateFilename) == 0 {
+			stateFilename = fmt.Sprintf("%s.%s.%d.backfill.json", filepath.Base(path), Account(), projectID)
+		}
+		st, err := readBackfillState(stateFilename)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = st.scope(stateFilename, Account(), projectID)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		// one listing is far fewer requests than looking up each
+		// revision
+		cs := changesets.NewService(service, projectID)
+		existing, err := cs.ListAll(nil)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		posted := map[string]bool{}
+		for _, c := range existing {
+			posted[c.Revision] = true
+		}
+
+		created := []*backfilledChangeset{}
+		for _, commit := range commits {
+			if b, ok := st.Created[commit.Revision]; ok {
+				resumed := *b
+				resumed.Resumed = true
+				created = append(created, &resumed)
+				continue
+			}
+			if posted[commit.Revision] {
+				fmt.Fprintf(os.Stderr, "Skipping [%s], already in project\n", commit.Revision)
+				continue
+			}
+
+			c := backfillChangeset(commit)
+			userID, ok := committers[commit.Email]
+			if !ok {
+				userID = committers[commit.Author]
+			}
+			c.UserID = userID
+
+			if flags.dryRun {
+				fmt.Fprintf(os.Stderr, "Would create [%s] %s\n", c.Revision, c.Title)
+				continue
+			}
+			_, err = cs.Create(c.Changeset)
+			if err != nil {
+				Render(created)
+				FatalUsage(cmd, resumeError(fmt.Errorf("[%s]: %v", commit.Revision, err), "created changesets", stateFilename))
+			}
+			b := &backfilledChangeset{
+				Revision:  c.Revision,
+				Title:     c.Title,
+				ChangedAt: commit.Date,
+				Committer: c.Committer,
+				UserID:    userID,
+			}
+			st.Created[commit.Revision] = b
+			err = writeState(stateFilename, st)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			fmt.Fprintf(os.Stderr, "Created [%s] %s\n", c.Revision, c.Title)
+			created = append(created, b)
+		}
+
+		Render(created)
+	},
+}
+
+func init() {
+	changesetsGroupCmd.AddCommand(changesetsBackfillCmd)
+	changesetsBackfillCmd.Flags().StringVar(&changesetsBackfillCmdFlags.repo, "repo", "", "Path to the git or Subversion repository (required)")
+	changesetsBackfillCmd.Flags().StringVar(&changesetsBackfillCmdFlags.since, "since", "", "Only backfill commits on or after DATE (YYYY-MM-DD) or after REV")
+	changesetsBackfillCmd.Flags().StringArrayVar(&changesetsBackfillCmdFlags.committers, "committer", nil, "Attribute a commit author's changesets to a Lighthouse user as AUTHOR=USER (repeatable)")
+	changesetsBackfillCmd.Flags().StringVar(&changesetsBackfillCmdFlags.state, "state-file", "", "File recording the created changesets, used to resume (default REPO.ACCOUNT.PROJECT.backfill.json)")
+	changesetsBackfillCmd.Flags().BoolVar(&changesetsBackfillCmdFlags.dryRun, "dry-run", false, "Show the changesets which would be created without creating them")
+}
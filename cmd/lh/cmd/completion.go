@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// completionCacheTTL is how long completions fetched from the API
+// are reused before being fetched again.
+const completionCacheTTL = 5 * time.Minute
+
+// completionCmd represents the completion command
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish",
+	Short: "Print a shell completion script",
+	Long: `Print a shell completion script
+
+Prints a script which completes lh's commands and flags for the given
+shell.  Project names, milestone titles, bin names, message titles,
+user names and ticket numbers are also completed, for example for
+--project, --milestone, --assigned and 'lh get ticket'.  These are
+fetched from the Lighthouse API using the configured account and
+credentials and cached for a few minutes under the user's cache
+directory, so pressing tab doesn't make an API request every time.
+
+To load completions in the current shell:
+
+  bash: source <(lh completion bash)
+  zsh:  source <(lh completion zsh)
+  fish: lh completion fish | source
+
+To load completions in every shell, add the above to ~/.bashrc or
+~/.zshrc, or for fish write them to
+~/.config/fish/completions/lh.fish.
+
+`,
+	// no API requests are made, don't require an account or
+	// credentials
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	ValidArgs:        []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			FatalUsage(cmd, "must supply shell")
+		}
+		var err error
+		switch args[0] {
+		case "bash":
+			err = RootCmd.GenBashCompletion(os.Stdout)
+		case "zsh":
+			err = genZshCompletion(os.Stdout)
+		case "fish":
+			err = RootCmd.GenFishCompletion(os.Stdout, true)
+		default:
+			FatalUsage(cmd, fmt.Sprintf("unsupported shell %q, must be bash, zsh or fish", args[0]))
+		}
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+// genZshCompletion writes a zsh completion script.  cobra's zsh
+// script doesn't support dynamic completions, so this one asks lh for
+// them instead, the same way the bash and fish scripts do.
+func genZshCompletion(w io.Writer) error {
+	_, err := io.WriteString(w, `#compdef lh
+
+_lh() {
+	local -a out completions
+	local directive
+	out=("${(@f)$(lh __completeNoDesc "${(@)words[2,CURRENT-1]}" "${words[CURRENT]}" 2>/dev/null)}")
+	directive=${${out[-1]}#:}
+	completions=("${(@)out[1,-2]}")
+	[[ $directive == <-> ]] || return 1
+	(( directive & 1 )) && return 1
+	if (( ${#completions} == 0 )); then
+		(( directive & 4 )) || _files
+		return
+	fi
+	if (( directive & 2 )); then
+		compadd -S '' -a completions
+	else
+		compadd -a completions
+	fi
+}
+
+compdef _lh lh
+`)
+	return err
+}
+
+// completions returns the cached completions named key, calling fetch
+// to get them from the API if they are missing or stale.  Errors are
+// ignored since there is nowhere to report them, the user just gets
+// no completions.
+func completions(key string, fetch func() ([]string, error)) []string {
+	account := viper.GetString("account")
+	if len(account) == 0 {
+		return nil
+	}
+
+	var path string
+	if dir, err := os.UserCacheDir(); err == nil {
+		path = filepath.Join(dir, "lh", "completion", url.PathEscape(account), url.PathEscape(key)+".json")
+	}
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < completionCacheTTL {
+		var comps []string
+		if buf, err := ioutil.ReadFile(path); err == nil && json.Unmarshal(buf, &comps) == nil {
+			return comps
+		}
+	}
+
+	if service == nil {
+		s, err := configService()
+		if err != nil {
+			cobra.CompDebugln(err.Error(), false)
+			return nil
+		}
+		service = s
+	}
+	comps, err := fetch()
+	if err != nil {
+		cobra.CompDebugln(err.Error(), false)
+		return nil
+	}
+
+	if len(path) > 0 && os.MkdirAll(filepath.Dir(path), 0700) == nil {
+		if buf, err := json.Marshal(comps); err == nil {
+			ioutil.WriteFile(path, buf, 0600)
+		}
+	}
+
+	return comps
+}
+
+// projectCompletions returns the completions named key for the
+// project selected by --project, or nil if no project is selected.
+func projectCompletions(key string, fetch func(projectID int) ([]string, error)) []string {
+	projectStr := viper.GetString("project")
+	if len(projectStr) == 0 {
+		return nil
+	}
+	return completions(key+"-"+projectStr, func() ([]string, error) {
+		projectID, err := ProjectID(projectStr)
+		if err != nil {
+			return nil, err
+		}
+		return fetch(projectID)
+	})
+}
+
+// completion returns a completion of value described by desc, which
+// shells supporting descriptions show alongside it.
+func completion(value string, desc string) string {
+	desc = strings.Join(strings.Fields(desc), " ")
+	if len(desc) == 0 {
+		return value
+	}
+	return value + "\t" + desc
+}
+
+// filterCompletions returns the completions starting with toComplete.
+func filterCompletions(comps []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	filtered := []string{}
+	for _, comp := range comps {
+		if strings.HasPrefix(comp, toComplete) {
+			filtered = append(filtered, comp)
+		}
+	}
+	return filtered, cobra.ShellCompDirectiveNoFileComp
+}
+
+// firstArg completes a command's first argument using f and nothing
+// after it.
+func firstArg(f func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective)) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return f(cmd, args, toComplete)
+	}
+}
+
+func completeProjects(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	comps := completions("projects", func() ([]string, error) {
+		ps, err := projects.NewService(service).List()
+		if err != nil {
+			return nil, err
+		}
+		comps := []string{}
+		for _, p := range ps {
+			comps = append(comps, completion(p.Name, p.Description))
+		}
+		return comps, nil
+	})
+	return filterCompletions(comps, toComplete)
+}
+
+// completeUsers completes the names of the members of all projects,
+// which are the names users.Service.GetByName accepts.
+func completeUsers(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	comps := completions("users", func() ([]string, error) {
+		p := projects.NewService(service)
+		ps, err := p.List()
+		if err != nil {
+			return nil, err
+		}
+		seen := map[int]bool{}
+		comps := []string{}
+		for _, project := range ps {
+			ms, err := p.MembershipsByID(project.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range ms {
+				if m.User == nil || seen[m.User.ID] {
+					continue
+				}
+				seen[m.User.ID] = true
+				comps = append(comps, completion(m.User.Name, m.User.Job))
+			}
+		}
+		return comps, nil
+	})
+	return filterCompletions(comps, toComplete)
+}
+
+func completeMilestones(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	comps := projectCompletions("milestones", func(projectID int) ([]string, error) {
+		ms, err := milestones.NewService(service, projectID).ListAll(nil)
+		if err != nil {
+			return nil, err
+		}
+		comps := []string{}
+		for _, m := range ms {
+			desc := ""
+			if m.DueOn != nil {
+				desc = "due " + m.DueOn.Format("2006-01-02")
+			}
+			comps = append(comps, completion(m.Title, desc))
+		}
+		return comps, nil
+	})
+	return filterCompletions(comps, toComplete)
+}
+
+func completeBins(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	comps := projectCompletions("bins", func(projectID int) ([]string, error) {
+		bs, err := bins.NewService(service, projectID).List()
+		if err != nil {
+			return nil, err
+		}
+		comps := []string{}
+		for _, b := range bs {
+			comps = append(comps, completion(b.Name, b.Query))
+		}
+		return comps, nil
+	})
+	return filterCompletions(comps, toComplete)
+}
+
+func completeMessages(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	comps := projectCompletions("messages", func(projectID int) ([]string, error) {
+		ms, err := messages.NewService(service, projectID).List()
+		if err != nil {
+			return nil, err
+		}
+		comps := []string{}
+		for _, m := range ms {
+			comps = append(comps, completion(m.Title, m.UserName))
+		}
+		return comps, nil
+	})
+	return filterCompletions(comps, toComplete)
+}
+
+// completeTickets completes the numbers of the project's most
+// recently updated tickets.
+func completeTickets(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	comps := projectCompletions("tickets", func(projectID int) ([]string, error) {
+		ts, err := tickets.NewService(service, projectID).List(&tickets.ListOptions{
+			Limit: tickets.MaxLimit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		comps := []string{}
+		for _, t := range ts {
+			comps = append(comps, completion(strconv.Itoa(t.Number), t.Title))
+		}
+		return comps, nil
+	})
+	return filterCompletions(comps, toComplete)
+}
+
+func init() {
+	RootCmd.AddCommand(completionCmd)
+}
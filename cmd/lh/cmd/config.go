@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// configKeys are the settings which may be set per context.
+var configKeys = []string{
+	"account",
+	"token",
+	"email",
+	"password",
+	"credential-store",
+	"credential-file",
+	"credential-recipients",
+	"credential-identity",
+	"credential-helper",
+	"project",
+	"monochrome",
+	"output",
+	"template",
+	"ticket-template-dir",
+	"rate-limit-interval",
+	"rate-limit-burst-size",
+}
+
+// contextErr is set by initContext if the selected context does not
+// exist.  It is reported by commands which need an account.
+var contextErr error
+
+// Context returns the name of the selected context, either from
+// --context, LH_CONTEXT or current-context in the config file.
+func Context() string {
+	if context := viper.GetString("context"); len(context) > 0 {
+		return context
+	}
+	return viper.GetString("current-context")
+}
+
+// initContext merges the selected context's settings over the
+// top-level settings in the config file.  Flags and environment
+// variables still take precedence.
+func initContext() {
+	name := Context()
+	if len(name) == 0 {
+		return
+	}
+	for key, value := range viper.GetStringMap("contexts") {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			contextErr = fmt.Errorf("context %q in config file must be a map", name)
+			return
+		}
+		viper.MergeConfigMap(settings)
+		return
+	}
+	contextErr = fmt.Errorf("context %q not found in config file", name)
+}
+
+// configFilename returns the config file to be modified by the config
+// subcommands.
+func configFilename() (string, error) {
+	if filename := viper.ConfigFileUsed(); len(filename) > 0 {
+		return filename, nil
+	}
+	if len(cfgFile) > 0 {
+		return cfgFile, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".lh.yaml"), nil
+}
+
+// lhConfig is the config file as parsed YAML.  yaml.MapSlice is used
+// rather than viper so that the order of settings is preserved and
+// flags and environment variables aren't written out.
+type lhConfig struct {
+	filename string
+	settings yaml.MapSlice
+}
+
+func readConfig() (*lhConfig, error) {
+	filename, err := configFilename()
+	if err != nil {
+		return nil, err
+	}
+	if ext := filepath.Ext(filename); ext != ".yaml" && ext != ".yml" {
+		return nil, fmt.Errorf("%s: only YAML config files can be modified", filename)
+	}
+	c := &lhConfig{
+		filename: filename,
+		settings: yaml.MapSlice{},
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(buf, &c.settings)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return c, nil
+}
+
+// write saves the config file.  The file holds credentials, so it is
+// only readable by the user.
+func (c *lhConfig) write() error {
+	buf, err := yaml.Marshal(c.settings)
+	if err != nil {
+		return err
+	}
+	tmp := c.filename + ".tmp"
+	err = ioutil.WriteFile(tmp, buf, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.filename)
+}
+
+func mapSliceGet(ms yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range ms {
+		if k, ok := item.Key.(string); ok && k == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func mapSliceSet(ms yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range ms {
+		if k, ok := item.Key.(string); ok && k == key {
+			ms[i].Value = value
+			return ms
+		}
+	}
+	return append(ms, yaml.MapItem{Key: key, Value: value})
+}
+
+// contexts returns the names of the contexts in the config file.
+func (c *lhConfig) contexts() []string {
+	names := []string{}
+	v, _ := mapSliceGet(c.settings, "contexts")
+	contexts, _ := v.(yaml.MapSlice)
+	for _, item := range contexts {
+		if name, ok := item.Key.(string); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// context returns the settings of context name, if it exists.
+func (c *lhConfig) context(name string) (yaml.MapSlice, bool) {
+	v, _ := mapSliceGet(c.settings, "contexts")
+	contexts, _ := v.(yaml.MapSlice)
+	for _, item := range contexts {
+		if k, ok := item.Key.(string); ok && strings.EqualFold(k, name) {
+			settings, _ := item.Value.(yaml.MapSlice)
+			return settings, true
+		}
+	}
+	return nil, false
+}
+
+// setContext replaces the settings of context name, creating it if
+// necessary.
+func (c *lhConfig) setContext(name string, settings yaml.MapSlice) {
+	v, _ := mapSliceGet(c.settings, "contexts")
+	contexts, _ := v.(yaml.MapSlice)
+	for _, item := range contexts {
+		if k, ok := item.Key.(string); ok && strings.EqualFold(k, name) {
+			name = k
+			break
+		}
+	}
+	contexts = mapSliceSet(contexts, name, settings)
+	c.settings = mapSliceSet(c.settings, "contexts", contexts)
+}
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage lh config file contexts and settings",
+	Long: `Manage lh config file contexts and settings
+
+Contexts are named groups of settings in the config file, allowing
+several Lighthouse accounts to be used without swapping environment
+variables:
+
+  current-context: work
+  contexts:
+    work:
+      account: work-account
+      token: deadbeef...
+      project: web
+    oss:
+      account: oss-account
+      token: cafebabe...
+      rate-limit-interval: 2s
+
+The selected context's settings override the top-level settings in
+the config file.  Use --context or LH_CONTEXT to select a context for
+a single command.  Flags and environment variables always take
+precedence over the config file.
+
+`,
+	// no API requests are made, don't require an account or
+	// credentials
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// configContext describes a context in the config file.  Credentials
+// are never printed.
+type configContext struct {
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+	Account string `json:"account"`
+	Project string `json:"project"`
+}
+
+// getContextsCmd represents the config get-contexts command
+var getContextsCmd = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "List the contexts in the config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := readConfig()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		current := Context()
+		contexts := []*configContext{}
+		for _, name := range c.contexts() {
+			settings, _ := c.context(name)
+			cc := &configContext{
+				Name:    name,
+				Current: strings.EqualFold(name, current),
+			}
+			if v, ok := mapSliceGet(settings, "account"); ok {
+				cc.Account = fmt.Sprint(v)
+			}
+			if v, ok := mapSliceGet(settings, "project"); ok {
+				cc.Project = fmt.Sprint(v)
+			}
+			contexts = append(contexts, cc)
+		}
+		Render(contexts)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(getContextsCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Set a setting in the config file",
+	Long: `Set a setting in the config file
+
+Sets KEY to VALUE in the context selected by --context, LH_CONTEXT or
+current-context, creating the context if it doesn't exist.  If no
+context is selected, the top-level setting is changed.  An empty VALUE
+removes the setting.  KEY must be one of:
+
+  ` + strings.Join(configKeys, "\n  ") + `
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			FatalUsage(cmd, "must supply key and value")
+		}
+		key, value := args[0], args[1]
+		valid := false
+		for _, k := range configKeys {
+			valid = valid || k == key
+		}
+		if !valid {
+			FatalUsage(cmd, fmt.Errorf("invalid key %q", key))
+		}
+		c, err := readConfig()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		set := func(ms yaml.MapSlice) yaml.MapSlice {
+			if len(value) > 0 {
+				return mapSliceSet(ms, key, value)
+			}
+			settings := yaml.MapSlice{}
+			for _, item := range ms {
+				if k, ok := item.Key.(string); !ok || k != key {
+					settings = append(settings, item)
+				}
+			}
+			return settings
+		}
+		if name := Context(); len(name) > 0 {
+			settings, _ := c.context(name)
+			c.setContext(name, set(settings))
+		} else {
+			c.settings = set(c.settings)
+		}
+		err = c.write()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configSetCmd)
+}
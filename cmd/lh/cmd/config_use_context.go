@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// useContextCmd represents the config use-context command
+var useContextCmd = &cobra.Command{
+	Use:   "use-context NAME",
+	Short: "Set the current context in the config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			FatalUsage(cmd, "must supply context name")
+		}
+		c, err := readConfig()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		if _, ok := c.context(args[0]); !ok {
+			FatalUsage(cmd, fmt.Errorf("context %q not found in %s", args[0], c.filename))
+		}
+		c.settings = mapSliceSet(c.settings, "current-context", args[0])
+		err = c.write()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		fmt.Printf("Switched to context %q\n", args[0])
+	},
+}
+
+func init() {
+	configCmd.AddCommand(useContextCmd)
+}
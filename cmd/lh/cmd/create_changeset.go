@@ -75,7 +75,7 @@ var createChangesetCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(nm)
+		Render(nm)
 	},
 }
 
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/nwidger/lighthouse/messages"
 	"github.com/spf13/cobra"
 )
@@ -8,6 +10,7 @@ import (
 type createMessagesCmdOpts struct {
 	title string
 	body  string
+	edit  bool
 }
 
 var createMessagesCmdFlags createMessagesCmdOpts
@@ -21,6 +24,16 @@ var createMessageCmd = &cobra.Command{
 		flags := createMessagesCmdFlags
 		projectID := Project()
 		m := messages.NewService(service, projectID)
+		var d *draft
+		if flags.edit {
+			d = newDraft(fmt.Sprintf("message-%d-new", projectID),
+				[]string{"title"}, map[string]string{"title": flags.title}, flags.body)
+			err = d.edit()
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			flags.title, flags.body = d.changed("title", ""), d.Body
+		}
 		message := &messages.Message{
 			Title: flags.title,
 			Body:  flags.body,
@@ -35,7 +48,8 @@ var createMessageCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(nm)
+		d.done()
+		Render(nm)
 	},
 }
 
@@ -43,4 +57,5 @@ func init() {
 	createCmd.AddCommand(createMessageCmd)
 	createMessageCmd.Flags().StringVar(&createMessagesCmdFlags.title, "title", "", "Message title (required)")
 	createMessageCmd.Flags().StringVar(&createMessagesCmdFlags.body, "body", "", "Message body (required)")
+	createMessageCmd.Flags().BoolVar(&createMessagesCmdFlags.edit, "edit", false, "Write the message in $EDITOR")
 }
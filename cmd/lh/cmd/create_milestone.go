@@ -42,7 +42,7 @@ var createMilestoneCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(nm)
+		Render(nm)
 	},
 }
 
@@ -33,7 +33,7 @@ var createProjectCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(np)
+		Render(np)
 	},
 }
 
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/nwidger/lighthouse/tickets"
 	"github.com/spf13/cobra"
 )
@@ -12,6 +14,9 @@ type createTicketsCmdOpts struct {
 	assigned  string
 	milestone string
 	tags      string
+	edit      bool
+	template  string
+	vars      []string
 }
 
 var createTicketsCmdFlags createTicketsCmdOpts
@@ -20,11 +25,69 @@ var createTicketsCmdFlags createTicketsCmdOpts
 var createTicketCmd = &cobra.Command{
 	Use:   "ticket",
 	Short: "Create a ticket (requires -p)",
+	Long: `Create a ticket (requires -p)
+
+Use --ticket-template to start from the fields of a ticket template,
+defined under ticket-templates in the config file or as NAME.md files
+in ticket-template-dir (default $HOME/.lh/templates).  Fields given as
+flags override the template's, and the template's fields may use
+variables given with --var, e.g. 'Release {{.version}}'.
+
+Note that --template is the global flag giving a Go text/template used
+to print the created ticket, not a ticket template.
+`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 		flags := createTicketsCmdFlags
 		projectID := Project()
 		t := tickets.NewService(service, projectID)
+		if len(flags.template) > 0 {
+			tf, err := ticketTemplate(flags.template)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			vars, err := parseVars(flags.vars)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			tf, err = tf.expand(vars)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			// flags override the template's fields
+			given := &ticketFields{
+				Title:     flags.title,
+				Body:      flags.body,
+				State:     flags.state,
+				Assigned:  flags.assigned,
+				Milestone: flags.milestone,
+				Tags:      flags.tags,
+			}
+			given.merge(tf)
+			flags.title, flags.body, flags.state = given.Title, given.Body, given.State
+			flags.assigned, flags.milestone, flags.tags = given.Assigned, given.Milestone, given.Tags
+		} else if len(flags.vars) > 0 {
+			FatalUsage(cmd, "--var requires --ticket-template")
+		}
+		var d *draft
+		if flags.edit {
+			d = newDraft(fmt.Sprintf("ticket-%d-new", projectID),
+				[]string{"title", "state", "assigned", "milestone", "tags"},
+				map[string]string{
+					"title":     flags.title,
+					"state":     flags.state,
+					"assigned":  flags.assigned,
+					"milestone": flags.milestone,
+					"tags":      flags.tags,
+				}, flags.body)
+			err = d.edit()
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			flags.title, flags.state, flags.tags = d.changed("title", ""), d.changed("state", ""), d.changed("tags", "")
+			flags.assigned, flags.milestone = d.changed("assigned", ""), d.changed("milestone", "")
+			flags.body = d.Body
+		}
 		tc := &tickets.Ticket{
 			Title: flags.title,
 			Body:  flags.body,
@@ -50,7 +113,8 @@ var createTicketCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(nt)
+		d.done()
+		Render(nt)
 	},
 }
 
@@ -62,4 +126,10 @@ func init() {
 	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.assigned, "assigned", "", "Assign ticket to a user (optional)")
 	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.milestone, "milestone", "", "Assign ticket to a milestone (optional)")
 	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.tags, "tags", "", "Comma-separated tags (optional)")
+	createTicketCmd.Flags().BoolVar(&createTicketsCmdFlags.edit, "edit", false, "Write the ticket in $EDITOR (optional)")
+	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.template, "ticket-template", "", "Fill in the ticket from a ticket template (optional)")
+	createTicketCmd.Flags().StringArrayVar(&createTicketsCmdFlags.vars, "var", nil, "Set a ticket template variable as KEY=VALUE (repeatable)")
+	createTicketCmd.RegisterFlagCompletionFunc("ticket-template", completeTicketTemplates)
+	createTicketCmd.RegisterFlagCompletionFunc("assigned", completeUsers)
+	createTicketCmd.RegisterFlagCompletionFunc("milestone", completeMilestones)
 }
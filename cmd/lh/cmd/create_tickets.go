@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type createTicketsFromCmdOpts struct {
+	from   string
+	vars   []string
+	state  string
+	dryRun bool
+}
+
+var createTicketsFromCmdFlags createTicketsFromCmdOpts
+
+// ticketRow is a ticket to be created by 'lh create tickets'.
+type ticketRow struct {
+	ticketFields `yaml:",inline"`
+	Template     string `yaml:"template"`
+
+	// Row is the row's position in the file, starting at 1.
+	Row int `yaml:"-"`
+}
+
+// key identifies the row in the state file by its position and its
+// fields after templates and variables are applied, so a file run
+// again with different variables, e.g. for each release, creates its
+// tickets again rather than resuming.
+func (r *ticketRow) key() string {
+	fields := make([]string, 0, len(ticketFieldKeys))
+	for _, key := range ticketFieldKeys {
+		fields = append(fields, *r.field(key))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return fmt.Sprintf("%d %x", r.Row, sum[:8])
+}
+
+// createdTicket is a ticket created from a row, as reported by 'lh
+// create tickets'.
+type createdTicket struct {
+	Row    int    `json:"row"`
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	// Resumed is true if the ticket was created by an earlier run.
+	Resumed bool `json:"resumed"`
+}
+
+// createTicketsState records the tickets created from a file so an
+// interrupted run can be resumed without creating duplicates.
+type createTicketsState struct {
+	resumeState
+
+	Created map[string]*createdTicket `json:"created"`
+}
+
+func readCreateTicketsState(filename string) (*createTicketsState, error) {
+	st := &createTicketsState{}
+	err := readState(filename, st)
+	if err != nil {
+		return nil, err
+	}
+	if st.Created == nil {
+		st.Created = map[string]*createdTicket{}
+	}
+	return st, nil
+}
+
+// createTicketsFromCmd represents the create tickets command
+var createTicketsFromCmd = &cobra.Command{
+	Use:   "tickets",
+	Short: "Create tickets from a CSV or YAML file (requires -p)",
+	Long: `Create tickets from a CSV or YAML file (requires -p)
+
+Creates one ticket per row of the file given by --from.  A CSV file
+must start with a header naming its columns, a YAML file is a list of
+tickets:
+
+  title,assigned,milestone,tags
+  Update changelog,alice,v1.4,release
+  Tag release,bob,v1.4,release
+
+  - title: Update changelog
+    assigned: alice
+    milestone: v1.4
+    tags: release
+    body: |
+      Summarize the changes since the last release.
+
+The fields are title, body, state, assigned, milestone, tags and
+template.  A row naming a ticket template starts from the template's
+fields, see 'lh create ticket --help'.  Every field may use variables
+given with --var, e.g. 'Release {{.version}}'.
+
+All rows are checked before any ticket is created: each must have a
+title and all assigned users and milestones must exist.
+
+The created tickets are recorded in the file given by --state-file
+(default FILE.created.json) and reported once all have been created.
+If creating a ticket fails, re-running the command with the same
+state file skips the rows which were already created.  A row is only
+skipped if it's unchanged after applying templates and variables, and
+a state file can only be resumed in the project it was created for,
+so running the same file again with different variables creates new
+tickets.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := createTicketsFromCmdFlags
+		if len(flags.from) == 0 {
+			FatalUsage(cmd, "must supply --from file")
+		}
+		vars, err := parseVars(flags.vars)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		rows, err := readTicketRows(flags.from)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		if len(rows) == 0 {
+			FatalUsage(cmd, fmt.Sprintf("%s: no tickets to create", flags.from))
+		}
+
+		projectID := Project()
+		tcs, err := validateTicketRows(rows, vars)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		stateFilename := flags.state
+		if len(stateFilename) == 0 {
+			stateFilename = flags.from + ".created.json"
+		}
+		st, err := readCreateTicketsState(stateFilename)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = st.scope(stateFilename, Account(), projectID)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		t := tickets.NewService(service, projectID)
+		created := []*createdTicket{}
+		for i, row := range rows {
+			if c, ok := st.Created[row.key()]; ok {
+				resumed := *c
+				resumed.Resumed = true
+				created = append(created, &resumed)
+				continue
+			}
+			if flags.dryRun {
+				fmt.Fprintf(os.Stderr, "Would create row %d: %s\n", row.Row, row.Title)
+				continue
+			}
+			nt, err := t.Create(tcs[i])
+			if err != nil {
+				Render(created)
+				FatalUsage(cmd, resumeError(fmt.Errorf("row %d: %v", row.Row, err), "created tickets", stateFilename))
+			}
+			c := &createdTicket{
+				Row:    row.Row,
+				Number: nt.Number,
+				Title:  nt.Title,
+				URL:    nt.URL,
+			}
+			st.Created[row.key()] = c
+			err = writeState(stateFilename, st)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			fmt.Fprintf(os.Stderr, "Created #%d %s\n", nt.Number, nt.Title)
+			created = append(created, c)
+		}
+
+		Render(created)
+	},
+}
+
+// readTicketRows reads the rows of a CSV or YAML file, depending on
+// its extension.
+func readTicketRows(filename string) ([]*ticketRow, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []*ticketRow
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".csv":
+		rows, err = readTicketRowsCSV(f)
+	case ".yaml", ".yml":
+		rows, err = readTicketRowsYAML(f)
+	default:
+		return nil, fmt.Errorf("%s: unknown file type %q, must be .csv, .yaml or .yml", filename, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return rows, nil
+}
+
+func readTicketRowsCSV(r io.Reader) ([]*ticketRow, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		if header[i] != "template" && (&ticketFields{}).field(header[i]) == nil {
+			return nil, fmt.Errorf("unknown column %q, must be one of %s, template", header[i], strings.Join(ticketFieldKeys, ", "))
+		}
+	}
+
+	rows := []*ticketRow{}
+	for i, record := range records[1:] {
+		row := &ticketRow{Row: i + 1}
+		for j, value := range record {
+			if header[j] == "template" {
+				row.Template = value
+				continue
+			}
+			*row.field(header[j]) = value
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func readTicketRowsYAML(r io.Reader) ([]*ticketRow, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	rows := []*ticketRow{}
+	err = yaml.UnmarshalStrict(buf, &rows)
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		row.Row = i + 1
+	}
+	return rows, nil
+}
+
+// validateTicketRows applies templates and variables to rows and
+// checks that every ticket can be created, returning the tickets to
+// create.  All problems are reported together so they can be fixed in
+// one go.
+func validateTicketRows(rows []*ticketRow, vars map[string]string) ([]*tickets.Ticket, error) {
+	var problems []string
+	userIDs, milestoneIDs := map[string]int{}, map[string]int{}
+	tcs := make([]*tickets.Ticket, len(rows))
+
+	for i, row := range rows {
+		fail := func(err interface{}) {
+			problems = append(problems, fmt.Sprintf("row %d: %v", row.Row, err))
+		}
+
+		if len(row.Template) > 0 {
+			tf, err := ticketTemplate(row.Template)
+			if err != nil {
+				fail(err)
+				continue
+			}
+			row.merge(tf)
+		}
+		tf, err := row.expand(vars)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		row.ticketFields = *tf
+
+		if len(strings.TrimSpace(row.Title)) == 0 {
+			fail("missing title")
+			continue
+		}
+		tc := &tickets.Ticket{
+			Title: row.Title,
+			Body:  row.Body,
+			State: row.State,
+			Tag:   row.Tags,
+		}
+		if len(row.Assigned) > 0 {
+			id, ok := userIDs[row.Assigned]
+			if !ok {
+				id, err = UserID(row.Assigned)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				userIDs[row.Assigned] = id
+			}
+			tc.AssignedUserID = id
+		}
+		if len(row.Milestone) > 0 {
+			id, ok := milestoneIDs[row.Milestone]
+			if !ok {
+				id, err = MilestoneID(row.Milestone)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				milestoneIDs[row.Milestone] = id
+			}
+			tc.MilestoneID = id
+		}
+		tcs[i] = tc
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("no tickets were created:\n%s", strings.Join(problems, "\n"))
+	}
+	return tcs, nil
+}
+
+func init() {
+	createCmd.AddCommand(createTicketsFromCmd)
+	createTicketsFromCmd.Flags().StringVar(&createTicketsFromCmdFlags.from, "from", "", "CSV or YAML file of tickets to create (required)")
+	createTicketsFromCmd.Flags().StringArrayVar(&createTicketsFromCmdFlags.vars, "var", nil, "Set a variable as KEY=VALUE (repeatable)")
+	createTicketsFromCmd.Flags().StringVar(&createTicketsFromCmdFlags.state, "state-file", "", "File recording created tickets, used to resume (default FILE.created.json)")
+	createTicketsFromCmd.Flags().BoolVar(&createTicketsFromCmdFlags.dryRun, "dry-run", false, "Check the file and print what would be created without creating anything")
+}
@@ -7,8 +7,9 @@ import (
 
 // binCmd represents the bin command
 var deleteBinCmd = &cobra.Command{
-	Use:   "bin [id-or-name]",
-	Short: "Delete a bin (requires -p)",
+	Use:               "bin [id-or-name]",
+	Short:             "Delete a bin (requires -p)",
+	ValidArgsFunction: firstArg(completeBins),
 	Run: func(cmd *cobra.Command, args []string) {
 		projectID := Project()
 		b := bins.NewService(service, projectID)
@@ -7,8 +7,9 @@ import (
 
 // messageCmd represents the message command
 var deleteMessageCmd = &cobra.Command{
-	Use:   "message [id-or-title]",
-	Short: "Delete a message (requires -p)",
+	Use:               "message [id-or-title]",
+	Short:             "Delete a message (requires -p)",
+	ValidArgsFunction: firstArg(completeMessages),
 	Run: func(cmd *cobra.Command, args []string) {
 		projectID := Project()
 		m := messages.NewService(service, projectID)
@@ -7,8 +7,9 @@ import (
 
 // milestoneCmd represents the milestone command
 var deleteMilestoneCmd = &cobra.Command{
-	Use:   "milestone [id-or-title]",
-	Short: "Delete a milestone (requires -p)",
+	Use:               "milestone [id-or-title]",
+	Short:             "Delete a milestone (requires -p)",
+	ValidArgsFunction: firstArg(completeMilestones),
 	Run: func(cmd *cobra.Command, args []string) {
 		projectID := Project()
 		m := milestones.NewService(service, projectID)
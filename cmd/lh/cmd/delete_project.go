@@ -7,8 +7,9 @@ import (
 
 // projectCmd represents the project command
 var deleteProjectCmd = &cobra.Command{
-	Use:   "project [id-or-name]",
-	Short: "Delete a project (requires -p)",
+	Use:               "project [id-or-name]",
+	Short:             "Delete a project (requires -p)",
+	ValidArgsFunction: firstArg(completeProjects),
 	Run: func(cmd *cobra.Command, args []string) {
 		p := projects.NewService(service)
 		if len(args) == 0 {
@@ -7,8 +7,9 @@ import (
 
 // ticketCmd represents the ticket command
 var deleteTicketCmd = &cobra.Command{
-	Use:   "ticket [number]",
-	Short: "Delete a ticket (requires -p)",
+	Use:               "ticket [number]",
+	Short:             "Delete a ticket (requires -p)",
+	ValidArgsFunction: firstArg(completeTickets),
 	Run: func(cmd *cobra.Command, args []string) {
 		projectID := Project()
 		t := tickets.NewService(service, projectID)
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pendingDraft is the draft opened by --edit which has not yet been
+// successfully submitted.  FatalUsage reports where it was saved.
+var pendingDraft *draft
+
+// draft is text edited with --edit, modelled on 'git commit'.  The
+// file starts with front matter holding the draft's fields
+// followed by the body:
+//
+//	---
+//	title: Crash on startup
+//	state: new
+//	---
+//	Body text...
+//
+// Drafts are saved in the user's own lh/drafts cache directory, see
+// draftsDir, and are only removed once they have been successfully
+// submitted, so a failed request can be retried without losing the
+// text.
+type draft struct {
+	name string
+	// path is set by edit.
+	path string
+	// keys are the names of the front matter fields, in order.
+	keys   []string
+	Fields map[string]string
+	Body   string
+}
+
+// newDraft returns a draft named name, e.g. ticket-123-new, with the
+// given front matter fields and initial values.
+func newDraft(name string, keys []string, fields map[string]string, body string) *draft {
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	return &draft{
+		name:   name,
+		keys:   keys,
+		Fields: fields,
+		Body:   body,
+	}
+}
+
+// editor returns the user's preferred editor command.
+func editor() []string {
+	for _, env := range []string{"LH_EDITOR", "VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// draftsDir returns the directory drafts are saved in, creating it if
+// needed.  It is private to the user, unlike the shared temp
+// directory, so other users can't read drafts or replace them with
+// symlinks.
+func draftsDir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cache, "lh", "drafts")
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		err = os.Chmod(dir, 0700)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+// writeDraftFile creates path with contents, failing if it already
+// exists rather than following a symlink.
+func writeDraftFile(path string, contents []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(contents)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// edit opens the draft in the user's editor and parses the result.
+// If a draft of the same name was left behind by a failed request, it
+// is edited instead of starting over.  An empty file aborts, as does
+// leaving a new draft's template unchanged.
+func (d *draft) edit() error {
+	dir, err := draftsDir()
+	if err != nil {
+		return err
+	}
+	d.path = filepath.Join(dir, d.name+".md")
+
+	var initial []byte
+	if fi, err := os.Lstat(d.path); err == nil {
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("draft %s is not a regular file", d.path)
+		}
+		fmt.Fprintf(os.Stderr, "Resuming draft %s\n", d.path)
+	} else {
+		initial = d.template()
+		err = writeDraftFile(d.path, initial)
+		if err != nil {
+			return err
+		}
+	}
+
+	args := editor()
+	cmd := exec.Command(args[0], append(args[1:], d.path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("editor failed, draft saved to %s: %v", d.path, err)
+	}
+
+	buf, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(buf)) == 0 {
+		os.Remove(d.path)
+		return fmt.Errorf("Aborting due to empty file")
+	}
+	if initial != nil && bytes.Equal(buf, initial) {
+		os.Remove(d.path)
+		return fmt.Errorf("Aborting, the draft was not edited")
+	}
+	err = d.parse(buf)
+	if err != nil {
+		return fmt.Errorf("%v, draft saved to %s", err, d.path)
+	}
+
+	pendingDraft = d
+
+	return nil
+}
+
+func (d *draft) template() []byte {
+	buf := &bytes.Buffer{}
+	if len(d.keys) > 0 {
+		fmt.Fprintln(buf, "---")
+		fmt.Fprintln(buf, "# Text after the closing --- is the body.  Empty fields are")
+		fmt.Fprintln(buf, "# left unchanged.  An empty or unedited file aborts.")
+		for _, key := range d.keys {
+			value := strings.Join(strings.Fields(d.Fields[key]), " ")
+			if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+				value = strconv.Quote(value)
+			}
+			fmt.Fprintf(buf, "%s: %s\n", key, value)
+		}
+		fmt.Fprintln(buf, "---")
+	}
+	buf.WriteString(d.Body)
+	if !strings.HasSuffix(d.Body, "\n") {
+		fmt.Fprintln(buf)
+	}
+	return buf.Bytes()
+}
+
+func (d *draft) parse(buf []byte) error {
+	text := strings.Replace(string(buf), "\r\n", "\n", -1)
+
+	if len(d.keys) > 0 && strings.HasPrefix(text, "---\n") {
+		end := strings.Index(text[len("---\n"):], "\n---")
+		if end == -1 {
+			return fmt.Errorf("front matter is missing closing ---")
+		}
+		fm := text[len("---\n") : len("---\n")+end]
+		text = text[len("---\n")+end+len("\n---"):]
+		if idx := strings.Index(text, "\n"); idx != -1 {
+			text = text[idx+1:]
+		} else {
+			text = ""
+		}
+
+		fields, err := d.parseFrontMatter(fm)
+		if err != nil {
+			return err
+		}
+		d.Fields = fields
+	}
+
+	d.Body = strings.TrimRight(strings.TrimLeft(text, "\n"), " \t\n")
+
+	return nil
+}
+
+// parseFrontMatter parses lines of the form "key: value", ignoring
+// blank lines and lines starting with #.  Values may be quoted.
+func (d *draft) parseFrontMatter(fm string) (map[string]string, error) {
+	allowed := map[string]bool{}
+	for _, key := range d.keys {
+		allowed[key] = true
+	}
+
+	fields := map[string]string{}
+	for _, line := range strings.Split(fm, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx == -1 {
+			return nil, fmt.Errorf("invalid front matter line %q, must be key: value", line)
+		}
+		key, value := strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])
+		if !allowed[key] {
+			return nil, fmt.Errorf("unknown front matter field %q, must be one of %s", key, strings.Join(d.keys, ", "))
+		}
+		switch {
+		case len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`):
+			uq, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid front matter value %s: %v", value, err)
+			}
+			value = uq
+		case len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'"):
+			value = strings.Replace(value[1:len(value)-1], "''", "'", -1)
+		}
+		fields[key] = value
+	}
+
+	return fields, nil
+}
+
+// changed returns the value of field key if it was changed from
+// initial, otherwise the empty string.
+func (d *draft) changed(key, initial string) string {
+	if v := strings.TrimSpace(d.Fields[key]); v != initial {
+		return v
+	}
+	return ""
+}
+
+// done removes a successfully submitted draft.
+func (d *draft) done() {
+	if d == nil {
+		return
+	}
+	os.Remove(d.path)
+	if pendingDraft == d {
+		pendingDraft = nil
+	}
+}
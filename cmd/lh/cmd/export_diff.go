@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// exportDiff is the list of changes between two export archives.
+type exportDiff struct {
+	Old     string          `json:"old"`
+	New     string          `json:"new"`
+	Changes []*exportChange `json:"changes"`
+}
+
+type exportChange struct {
+	// Kind is one of project, milestone, ticket, bin, message or
+	// user.
+	Kind string `json:"kind"`
+	// Change is one of added, removed or modified.
+	Change  string         `json:"change"`
+	Project string         `json:"project,omitempty"`
+	ID      string         `json:"id"`
+	Name    string         `json:"name"`
+	Fields  []*fieldChange `json:"fields,omitempty"`
+}
+
+type fieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// diffIgnoredFields lists the JSON fields of each kind which change
+// too often to be interesting or which duplicate other fields.
+// Fields ending in _html are always ignored.
+var diffIgnoredFields = map[string]map[string]bool{
+	"project": {
+		"updated_at": true,
+	},
+	"milestone": {
+		"updated_at": true,
+	},
+	"ticket": {
+		"updated_at":        true,
+		"versions":          true,
+		"raw_data":          true,
+		"latest_body":       true,
+		"tags":              true,
+		"alphabetical_tags": true,
+		"attachments":       true,
+	},
+	"bin": {
+		"updated_at": true,
+	},
+	"message": {
+		"updated_at": true,
+		"comments":   true,
+	},
+	"user": {
+		"active_tickets": true,
+	},
+}
+
+// diffItem is a resource of a given kind identified by a key unique
+// within its archive.  Resources belonging to a project are keyed by
+// the project's ID, so renaming a project doesn't change their keys,
+// while project is its name for display.
+type diffItem struct {
+	project string
+	id      string
+	name    string
+	v       interface{}
+}
+
+func diffItems(a *archive) map[string]map[string]*diffItem {
+	items := map[string]map[string]*diffItem{}
+	add := func(kind, projectID, project, id, name string, v interface{}) {
+		if items[kind] == nil {
+			items[kind] = map[string]*diffItem{}
+		}
+		items[kind][projectID+"/"+id] = &diffItem{
+			project: project,
+			id:      id,
+			name:    name,
+			v:       v,
+		}
+	}
+	for _, p := range a.projects {
+		pid := strconv.Itoa(p.ID)
+		add("project", "", "", pid, p.Name, p.Project)
+		for _, m := range p.milestones {
+			add("milestone", pid, p.Name, strconv.Itoa(m.ID), m.Title, m)
+		}
+		for _, t := range p.tickets {
+			add("ticket", pid, p.Name, "#"+strconv.Itoa(t.Number), t.Title, t.Ticket)
+		}
+		for _, b := range p.bins {
+			add("bin", pid, p.Name, strconv.Itoa(b.ID), b.Name, b)
+		}
+		for _, m := range p.messages {
+			add("message", pid, p.Name, strconv.Itoa(m.ID), m.Title, m)
+		}
+	}
+	for _, u := range a.users {
+		add("user", "", "", strconv.Itoa(u.ID), u.Name, u.User)
+	}
+	return items
+}
+
+// diffArchives compares the archives old and new.
+func diffArchives(old, new *archive) (*exportDiff, error) {
+	d := &exportDiff{
+		Changes: []*exportChange{},
+	}
+
+	oldItems, newItems := diffItems(old), diffItems(new)
+
+	for _, kind := range []string{"project", "milestone", "ticket", "bin", "message", "user"} {
+		keys := []string{}
+		for key := range oldItems[kind] {
+			keys = append(keys, key)
+		}
+		for key := range newItems[kind] {
+			if _, ok := oldItems[kind][key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return diffKeyLess(keys[i], keys[j]) })
+
+		for _, key := range keys {
+			o, n := oldItems[kind][key], newItems[kind][key]
+			switch {
+			case o == nil:
+				d.Changes = append(d.Changes, &exportChange{
+					Kind: kind, Change: "added", Project: n.project, ID: n.id, Name: n.name,
+				})
+			case n == nil:
+				d.Changes = append(d.Changes, &exportChange{
+					Kind: kind, Change: "removed", Project: o.project, ID: o.id, Name: o.name,
+				})
+			default:
+				fields, err := diffFields(o.v, n.v, diffIgnoredFields[kind])
+				if err != nil {
+					return nil, err
+				}
+				if len(fields) == 0 {
+					continue
+				}
+				d.Changes = append(d.Changes, &exportChange{
+					Kind: kind, Change: "modified", Project: n.project, ID: n.id, Name: n.name, Fields: fields,
+				})
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// diffKeyLess orders keys of the form PROJECTID/ID numerically by
+// project ID and then by ID.
+func diffKeyLess(a, b string) bool {
+	ai, bi := strings.LastIndex(a, "/"), strings.LastIndex(b, "/")
+	if a[:ai] != b[:bi] {
+		return numericLess(a[:ai], b[:bi])
+	}
+	return numericLess(strings.TrimPrefix(a[ai+1:], "#"), strings.TrimPrefix(b[bi+1:], "#"))
+}
+
+// numericLess compares a and b as numbers if both are, otherwise as
+// strings.
+func numericLess(a, b string) bool {
+	an, aerr := strconv.Atoi(a)
+	bn, berr := strconv.Atoi(b)
+	if aerr != nil || berr != nil {
+		return a < b
+	}
+	return an < bn
+}
+
+// diffFields compares the top-level JSON fields of old and new.
+func diffFields(old, new interface{}, ignored map[string]bool) ([]*fieldChange, error) {
+	om, err := jsonFields(old)
+	if err != nil {
+		return nil, err
+	}
+	nm, err := jsonFields(new)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range om {
+		names = append(names, name)
+	}
+	for name := range nm {
+		if _, ok := om[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fields := []*fieldChange{}
+	for _, name := range names {
+		if ignored[name] || strings.HasSuffix(name, "_html") {
+			continue
+		}
+		if reflect.DeepEqual(om[name], nm[name]) {
+			continue
+		}
+		fields = append(fields, &fieldChange{
+			Field: name,
+			Old:   om[name],
+			New:   nm[name],
+		})
+	}
+
+	return fields, nil
+}
+
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	err = json.Unmarshal(buf, &m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (d *exportDiff) writeText(w io.Writer) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", d.Old, d.New)
+	for _, c := range d.Changes {
+		sign := "~"
+		switch c.Change {
+		case "added":
+			sign = "+"
+		case "removed":
+			sign = "-"
+		}
+		what := c.ID
+		if len(c.Project) > 0 {
+			sep := " "
+			if !strings.HasPrefix(c.ID, "#") {
+				sep = "/"
+			}
+			what = c.Project + sep + c.ID
+		}
+		fmt.Fprintf(w, "%s %s %s %q\n", sign, c.Kind, what, c.Name)
+		for _, f := range c.Fields {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", f.Field, diffValue(f.Old), diffValue(f.New))
+		}
+	}
+}
+
+func diffValue(v interface{}) string {
+	const max = 60
+
+	if v == nil {
+		return "(none)"
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	s := string(buf)
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	return s
+}
+
+// exportDiffCmd represents the export diff command
+var exportDiffCmd = &cobra.Command{
+	Use:   "diff OLD NEW",
+	Short: "Report changes between two export archives",
+	Long: `Report changes between two export archives
+
+Compares two archives written by 'lh export' and reports projects,
+milestones, tickets, bins, messages and users that were added,
+removed or modified between them.  For modified resources, each
+changed field is listed with its old and new value.  No API requests
+are made.
+
+The report is printed as text unless an output format is chosen with
+--output or --template.
+
+`,
+	// no API requests are made, don't require an account or
+	// credentials
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			FatalUsage(cmd, "must supply old and new archive filenames")
+		}
+		old, err := readArchive(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		new, err := readArchive(args[1])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		d, err := diffArchives(old, new)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		d.Old, d.New = args[0], args[1]
+		if OutputSet() {
+			Render(d)
+		} else {
+			d.writeText(os.Stdout)
+		}
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportDiffCmd)
+}
@@ -0,0 +1,597 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+// exportHTMLCmd represents the export html command
+var exportHTMLCmd = &cobra.Command{
+	Use:   "html ARCHIVE OUT",
+	Short: "Generate a static HTML site from an export archive",
+	Long: `Generate a static HTML site from an export archive
+
+Writes a read-only, browsable copy of an archive written by 'lh export'
+to the directory OUT.  The site contains an index of each project's
+tickets, milestones and messages, a page per ticket with its full
+version history and attachments, a page per milestone listing its
+tickets and a page per message thread.  The index page includes a
+search box which searches ticket and message text without a server.
+No API requests are made.
+
+`,
+	// no API requests are made, don't require an account or
+	// credentials
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			FatalUsage(cmd, "must supply archive filename and output directory")
+		}
+		a, err := readArchive(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = writeHTMLSite(a, args[1])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+var lhCodeSpanRegexp = regexp.MustCompile(`@([^@\s][^@\r\n]*[^@\s]|[^@\s])@`)
+
+// lighthouseToHTML converts text using Lighthouse's body syntax to
+// HTML.  Lines between @@@ markers are code blocks, text between
+// single @ characters is a code span and blank lines separate
+// paragraphs.  Everything else is escaped.
+func lighthouseToHTML(text string) template.HTML {
+	buf := &bytes.Buffer{}
+	para := []string{}
+
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		buf.WriteString("<p>")
+		for i, line := range para {
+			if i > 0 {
+				buf.WriteString("<br>\n")
+			}
+			buf.WriteString(codeSpansToHTML(line))
+		}
+		buf.WriteString("</p>\n")
+		para = para[:0]
+	}
+
+	inCode := false
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "@@@") {
+			if inCode {
+				buf.WriteString("</code></pre>\n")
+				inCode = false
+				continue
+			}
+			flush()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "@@@"))
+			if len(lang) > 0 {
+				fmt.Fprintf(buf, `<pre><code class="language-%s">`, html.EscapeString(lang))
+			} else {
+				buf.WriteString("<pre><code>")
+			}
+			inCode = true
+			continue
+		}
+		if inCode {
+			buf.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+		if len(trimmed) == 0 {
+			flush()
+			continue
+		}
+		para = append(para, line)
+	}
+	if inCode {
+		buf.WriteString("</code></pre>\n")
+	}
+	flush()
+
+	return template.HTML(buf.String())
+}
+
+func codeSpansToHTML(line string) string {
+	buf := &bytes.Buffer{}
+	prev := 0
+	for _, m := range lhCodeSpanRegexp.FindAllStringSubmatchIndex(line, -1) {
+		buf.WriteString(html.EscapeString(line[prev:m[0]]))
+		buf.WriteString("<code>" + html.EscapeString(line[m[2]:m[3]]) + "</code>")
+		prev = m[1]
+	}
+	buf.WriteString(html.EscapeString(line[prev:]))
+	return buf.String()
+}
+
+type htmlSearchEntry struct {
+	Project string `json:"project"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Text    string `json:"text"`
+}
+
+// htmlPage is the data passed to each page template.
+type htmlPage struct {
+	// Root is the relative path from the page to the top of the
+	// site.
+	Root  string
+	Title string
+
+	Account  string
+	Projects []*htmlProjectSummary
+
+	Project     *projects.Project
+	ProjectDir  string
+	TicketsPath string
+	Milestones  milestones.Milestones
+	Bins        bins.Bins
+	Messages    messages.Messages
+	Tickets     tickets.Tickets
+
+	Milestone   *milestones.Milestone
+	Message     *messages.Message
+	Ticket      *tickets.Ticket
+	Versions    []*htmlVersion
+	Attachments []*tickets.Attachment
+}
+
+type htmlProjectSummary struct {
+	Name       string
+	Dir        string
+	Archived   bool
+	Tickets    int
+	Open       int
+	Milestones int
+	Messages   int
+}
+
+type htmlVersion struct {
+	*tickets.TicketVersion
+
+	Changes []string
+}
+
+type htmlSite struct {
+	archive *archive
+	out     string
+	search  []*htmlSearchEntry
+}
+
+func writeHTMLSite(a *archive, out string) error {
+	site := &htmlSite{
+		archive: a,
+		out:     out,
+		search:  []*htmlSearchEntry{},
+	}
+
+	err := site.writeFile("style.css", []byte(htmlStyle))
+	if err != nil {
+		return err
+	}
+
+	index := &htmlPage{
+		Title:   a.account,
+		Account: a.account,
+	}
+	for _, p := range a.projects {
+		index.Projects = append(index.Projects, &htmlProjectSummary{
+			Name:       p.Name,
+			Dir:        site.projectDir(p),
+			Archived:   p.Archived,
+			Tickets:    len(p.tickets),
+			Open:       site.openTickets(p),
+			Milestones: len(p.milestones),
+			Messages:   len(p.messages),
+		})
+	}
+	err = site.render("index.html", "index", index)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range a.projects {
+		err = site.project(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	buf, err := json.Marshal(site.search)
+	if err != nil {
+		return err
+	}
+	return site.writeFile("search.js", []byte("var searchIndex = "+string(buf)+";\n"+htmlSearchJS))
+}
+
+func (site *htmlSite) projectDir(p *archiveProject) string {
+	return filename(fmt.Sprintf("%d-%s", p.ID, p.Permalink))
+}
+
+func (site *htmlSite) userName(id int) string {
+	if id == 0 {
+		return ""
+	}
+	if u := site.archive.user(id); u != nil {
+		return u.Name
+	}
+	return "user " + strconv.Itoa(id)
+}
+
+func (site *htmlSite) project(p *archiveProject) error {
+	dir := site.projectDir(p)
+
+	ts := make(tickets.Tickets, 0, len(p.tickets))
+	for _, t := range p.tickets {
+		ts = append(ts, t.Ticket)
+	}
+
+	err := site.render(filepath.Join(dir, "index.html"), "project", &htmlPage{
+		Root:        "../",
+		Title:       p.Name,
+		Project:     p.Project,
+		ProjectDir:  dir,
+		TicketsPath: "tickets/",
+		Milestones:  sortedMilestones(p.milestones),
+		Bins:        p.bins,
+		Messages:    p.messages,
+		Tickets:     ts,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range p.milestones {
+		mts := tickets.Tickets{}
+		for _, t := range ts {
+			if t.MilestoneID == m.ID {
+				mts = append(mts, t)
+			}
+		}
+		err = site.render(filepath.Join(dir, "milestones", strconv.Itoa(m.ID)+".html"), "milestone", &htmlPage{
+			Root:        "../../",
+			Title:       m.Title,
+			Project:     p.Project,
+			ProjectDir:  dir,
+			TicketsPath: "../tickets/",
+			Milestone:   m,
+			Tickets:     mts,
+		})
+		if err != nil {
+			return err
+		}
+		site.search = append(site.search, &htmlSearchEntry{
+			Project: p.Name,
+			Title:   "Milestone " + m.Title,
+			URL:     dir + "/milestones/" + strconv.Itoa(m.ID) + ".html",
+			Text:    m.Goals,
+		})
+	}
+
+	for _, m := range p.messages {
+		err = site.render(filepath.Join(dir, "messages", strconv.Itoa(m.ID)+".html"), "message", &htmlPage{
+			Root:       "../../",
+			Title:      m.Title,
+			Project:    p.Project,
+			ProjectDir: dir,
+			Message:    m,
+		})
+		if err != nil {
+			return err
+		}
+		text := []string{m.Body}
+		for _, c := range m.Comments {
+			text = append(text, c.Body)
+		}
+		site.search = append(site.search, &htmlSearchEntry{
+			Project: p.Name,
+			Title:   m.Title,
+			URL:     dir + "/messages/" + strconv.Itoa(m.ID) + ".html",
+			Text:    strings.Join(text, "\n"),
+		})
+	}
+
+	for _, t := range p.tickets {
+		attachmentsDir := filepath.Join(dir, "tickets", strconv.Itoa(t.Number))
+		for _, a := range t.attachments {
+			err = site.writeFile(filepath.Join(attachmentsDir, filepath.Base(a.Filename)), a.data)
+			if err != nil {
+				return err
+			}
+		}
+		page := &htmlPage{
+			Root:       "../../",
+			Title:      fmt.Sprintf("#%d %s", t.Number, t.Title),
+			Project:    p.Project,
+			ProjectDir: dir,
+			Ticket:     t.Ticket,
+			Milestone:  p.milestone(t.MilestoneID),
+		}
+		for _, a := range t.attachments {
+			page.Attachments = append(page.Attachments, a.Attachment)
+		}
+		text := []string{}
+		for _, v := range t.Versions {
+			page.Versions = append(page.Versions, &htmlVersion{
+				TicketVersion: v,
+				Changes:       site.versionChanges(p, v),
+			})
+			text = append(text, v.Body)
+		}
+		err = site.render(filepath.Join(dir, "tickets", strconv.Itoa(t.Number)+".html"), "ticket", page)
+		if err != nil {
+			return err
+		}
+		site.search = append(site.search, &htmlSearchEntry{
+			Project: p.Name,
+			Title:   page.Title,
+			URL:     dir + "/tickets/" + strconv.Itoa(t.Number) + ".html",
+			Text:    strings.Join(text, "\n"),
+		})
+	}
+
+	return nil
+}
+
+func (site *htmlSite) render(name, tmpl string, page *htmlPage) error {
+	buf := &bytes.Buffer{}
+	err := htmlTemplates.ExecuteTemplate(buf, tmpl, page)
+	if err != nil {
+		return err
+	}
+	return site.writeFile(name, buf.Bytes())
+}
+
+func (site *htmlSite) writeFile(name string, data []byte) error {
+	name = filepath.Join(site.out, name)
+	fmt.Fprintln(os.Stderr, name)
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+// versionChanges describes the attributes changed by a ticket
+// version.  Lighthouse records the previous value of each changed
+// attribute in DiffableAttributes.
+func (site *htmlSite) versionChanges(p *archiveProject, v *tickets.TicketVersion) []string {
+	changes := []string{}
+	d := v.DiffableAttributes
+	if d == nil {
+		return changes
+	}
+	if len(d.State) > 0 {
+		changes = append(changes, fmt.Sprintf("State changed from %q to %q", d.State, v.State))
+	}
+	if len(d.Title) > 0 {
+		changes = append(changes, fmt.Sprintf("Title changed from %q to %q", d.Title, v.Title))
+	}
+	if d.AssignedUser != 0 {
+		changes = append(changes, fmt.Sprintf("Assigned user changed from %q to %q",
+			site.userName(d.AssignedUser), site.userName(v.AssignedUserID)))
+	}
+	if d.Milestone != 0 {
+		from, to := strconv.Itoa(d.Milestone), ""
+		if m := p.milestone(d.Milestone); m != nil {
+			from = m.Title
+		}
+		if m := p.milestone(v.MilestoneID); m != nil {
+			to = m.Title
+		}
+		changes = append(changes, fmt.Sprintf("Milestone changed from %q to %q", from, to))
+	}
+	if len(d.Tag) > 0 {
+		changes = append(changes, fmt.Sprintf("Tags changed from %q to %q", d.Tag, v.Tag))
+	}
+	return changes
+}
+
+func (site *htmlSite) openTickets(p *archiveProject) int {
+	n := 0
+	for _, t := range p.tickets {
+		if !t.Closed {
+			n++
+		}
+	}
+	return n
+}
+
+func sortedMilestones(ms milestones.Milestones) milestones.Milestones {
+	sorted := append(milestones.Milestones{}, ms...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		di, dj := sorted[i].DueOn, sorted[j].DueOn
+		if di == nil || dj == nil {
+			return di != nil
+		}
+		return di.Before(*dj)
+	})
+	return sorted
+}
+
+var htmlTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"body": lighthouseToHTML,
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("2006-01-02 15:04")
+	},
+	"day": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	},
+}).Parse(htmlTemplatesText))
+
+const htmlTemplatesText = `
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="{{.Root}}style.css">
+</head>
+<body>
+<nav><a href="{{.Root}}index.html">All projects</a>{{if .Project}} &rsaquo; <a href="{{.Root}}{{.ProjectDir}}/index.html">{{.Project.Name}}</a>{{end}}</nav>
+{{end}}
+
+{{define "foot"}}</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "head" .}}
+<h1>{{.Account}}</h1>
+<form onsubmit="search(); return false;">
+<input id="q" type="search" placeholder="Search tickets, milestones and messages" oninput="search()">
+</form>
+<ul id="results"></ul>
+<h2>Projects</h2>
+<table>
+<tr><th>Project</th><th>Tickets</th><th>Open</th><th>Milestones</th><th>Messages</th></tr>
+{{range .Projects}}<tr><td><a href="{{.Dir}}/index.html">{{.Name}}</a>{{if .Archived}} (archived){{end}}</td><td>{{.Tickets}}</td><td>{{.Open}}</td><td>{{.Milestones}}</td><td>{{.Messages}}</td></tr>
+{{end}}</table>
+<script src="search.js"></script>
+{{template "foot"}}{{end}}
+
+{{define "project"}}{{template "head" .}}
+<h1>{{.Project.Name}}</h1>
+{{body .Project.Description}}
+{{with .Milestones}}<h2>Milestones</h2>
+<ul>
+{{range .}}<li><a href="milestones/{{.ID}}.html">{{.Title}}</a>{{with day .DueOn}} (due {{.}}){{end}}{{if .CompletedAt}} &mdash; completed{{end}}</li>
+{{end}}</ul>{{end}}
+{{with .Bins}}<h2>Bins</h2>
+<ul>
+{{range .}}<li>{{.Name}}: <code>{{.Query}}</code></li>
+{{end}}</ul>{{end}}
+{{with .Messages}}<h2>Messages</h2>
+<ul>
+{{range .}}<li><a href="messages/{{.ID}}.html">{{.Title}}</a> by {{.UserName}}, {{day .CreatedAt}} ({{len .Comments}} comments)</li>
+{{end}}</ul>{{end}}
+<h2>Tickets</h2>
+{{template "tickets" .}}
+{{template "foot"}}{{end}}
+
+{{define "tickets"}}<table>
+<tr><th>#</th><th>Title</th><th>State</th><th>Assigned</th><th>Updated</th></tr>
+{{range .Tickets}}<tr><td>{{.Number}}</td><td><a href="{{$.TicketsPath}}{{.Number}}.html">{{.Title}}</a></td><td>{{.State}}</td><td>{{.AssignedUserName}}</td><td>{{day .UpdatedAt}}</td></tr>
+{{end}}</table>
+{{end}}
+
+{{define "milestone"}}{{template "head" .}}
+<h1>{{.Milestone.Title}}</h1>
+<p>{{with day .Milestone.DueOn}}Due {{.}}. {{end}}{{with day .Milestone.CompletedAt}}Completed {{.}}.{{end}}</p>
+{{body .Milestone.Goals}}
+<h2>Tickets</h2>
+{{template "tickets" .}}
+{{template "foot"}}{{end}}
+
+{{define "message"}}{{template "head" .}}
+<h1>{{.Message.Title}}</h1>
+<div class="entry">
+<div class="meta">{{.Message.UserName}}, {{date .Message.CreatedAt}}</div>
+{{body .Message.Body}}
+</div>
+{{range .Message.Comments}}<div class="entry">
+<div class="meta">{{.UserName}}, {{date .CreatedAt}}</div>
+{{body .Body}}
+</div>
+{{end}}
+{{template "foot"}}{{end}}
+
+{{define "ticket"}}{{template "head" .}}
+<h1>#{{.Ticket.Number}} {{.Ticket.Title}}</h1>
+<table class="attributes">
+<tr><th>State</th><td>{{.Ticket.State}}</td></tr>
+<tr><th>Reported by</th><td>{{.Ticket.CreatorName}}, {{date .Ticket.CreatedAt}}</td></tr>
+<tr><th>Assigned to</th><td>{{.Ticket.AssignedUserName}}</td></tr>
+<tr><th>Milestone</th><td>{{with .Milestone}}<a href="../milestones/{{.ID}}.html">{{.Title}}</a>{{end}}</td></tr>
+<tr><th>Tags</th><td>{{.Ticket.Tag}}</td></tr>
+</table>
+{{with .Attachments}}<h2>Attachments</h2>
+<ul>
+{{range .}}<li><a href="{{$.Ticket.Number}}/{{.Filename}}">{{.Filename}}</a> ({{.Size}} bytes, {{date .CreatedAt}})</li>
+{{end}}</ul>{{end}}
+<h2>History</h2>
+{{range .Versions}}<div class="entry">
+<div class="meta">{{.UserName}}, {{date .CreatedAt}}</div>
+{{with .Changes}}<ul class="changes">
+{{range .}}<li>{{.}}</li>
+{{end}}</ul>{{end}}
+{{body .Body}}
+</div>
+{{end}}
+{{template "foot"}}{{end}}
+`
+
+const htmlStyle = `body { font-family: sans-serif; max-width: 60em; margin: 1em auto; padding: 0 1em; color: #222; }
+nav { margin-bottom: 1em; font-size: 90%; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.2em 0.5em; border-bottom: 1px solid #ddd; vertical-align: top; }
+table.attributes { width: auto; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+code { background: #f4f4f4; }
+.entry { border-top: 1px solid #ccc; padding: 0.5em 0; }
+.meta { color: #666; font-size: 90%; }
+.changes { color: #666; font-size: 90%; }
+#q { width: 100%; font-size: 110%; padding: 0.3em; }
+`
+
+const htmlSearchJS = `function search() {
+  var q = document.getElementById("q").value.toLowerCase().trim();
+  var results = document.getElementById("results");
+  results.innerHTML = "";
+  if (q.length === 0) {
+    return;
+  }
+  var terms = q.split(/\s+/);
+  var n = 0;
+  for (var i = 0; i < searchIndex.length && n < 100; i++) {
+    var e = searchIndex[i];
+    var text = (e.title + "\n" + e.text).toLowerCase();
+    var match = terms.every(function (t) { return text.indexOf(t) !== -1; });
+    if (!match) {
+      continue;
+    }
+    var li = document.createElement("li");
+    var a = document.createElement("a");
+    a.href = e.url;
+    a.textContent = e.project + ": " + e.title;
+    li.appendChild(a);
+    results.appendChild(li);
+    n++;
+  }
+}
+`
+
+func init() {
+	exportCmd.AddCommand(exportHTMLCmd)
+}
@@ -7,8 +7,9 @@ import (
 
 // binCmd represents the bin command
 var binCmd = &cobra.Command{
-	Use:   "bin [id-or-name]",
-	Short: "Get a ticket bin (requires -p)",
+	Use:               "bin [id-or-name]",
+	Short:             "Get a ticket bin (requires -p)",
+	ValidArgsFunction: firstArg(completeBins),
 	Run: func(cmd *cobra.Command, args []string) {
 		projectID := Project()
 		b := bins.NewService(service, projectID)
@@ -19,7 +20,7 @@ var binCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(bin)
+		Render(bin)
 	},
 }
 
@@ -20,7 +20,7 @@ var changesetCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(changeset)
+		Render(changeset)
 	},
 }
 
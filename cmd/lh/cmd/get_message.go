@@ -7,8 +7,9 @@ import (
 
 // messageCmd represents the message command
 var messageCmd = &cobra.Command{
-	Use:   "message [id-or-title]",
-	Short: "Get a message (requires -p)",
+	Use:               "message [id-or-title]",
+	Short:             "Get a message (requires -p)",
+	ValidArgsFunction: firstArg(completeMessages),
 	Run: func(cmd *cobra.Command, args []string) {
 		projectID := Project()
 		m := messages.NewService(service, projectID)
@@ -19,7 +20,7 @@ var messageCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(msg)
+		Render(msg)
 	},
 }
 
@@ -7,8 +7,9 @@ import (
 
 // milestoneCmd represents the milestone command
 var milestoneCmd = &cobra.Command{
-	Use:   "milestone [id-or-title]",
-	Short: "Get a milestone (requires -p)",
+	Use:               "milestone [id-or-title]",
+	Short:             "Get a milestone (requires -p)",
+	ValidArgsFunction: firstArg(completeMilestones),
 	Run: func(cmd *cobra.Command, args []string) {
 		projectID := Project()
 		m := milestones.NewService(service, projectID)
@@ -19,7 +20,7 @@ var milestoneCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(milestone)
+		Render(milestone)
 	},
 }
 
@@ -11,7 +11,7 @@ var planCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(p)
+		Render(p)
 	},
 }
 
@@ -13,8 +13,9 @@ var getProjectCmdFlags getProjectCmdOpts
 
 // projectCmd represents the project command
 var projectCmd = &cobra.Command{
-	Use:   "project [id-or-name]",
-	Short: "Get your Lighthouse project",
+	Use:               "project [id-or-name]",
+	Short:             "Get your Lighthouse project",
+	ValidArgsFunction: firstArg(completeProjects),
 	Run: func(cmd *cobra.Command, args []string) {
 		flags := getProjectCmdFlags
 		p := projects.NewService(service)
@@ -26,13 +27,13 @@ var projectCmd = &cobra.Command{
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			JSON(ms)
+			Render(ms)
 		} else {
 			project, err := p.Get(args[0])
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			JSON(project)
+			Render(project)
 		}
 	},
 }
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/nwidger/lighthouse/changesets"
 	"github.com/nwidger/lighthouse/tickets"
 	"github.com/spf13/cobra"
 )
@@ -17,14 +18,16 @@ type getTicketCmdOpts struct {
 	milestone  string
 	tags       string
 	attachment string
+	changesets bool
 }
 
 var getTicketCmdFlags getTicketCmdOpts
 
 // ticketCmd represents the ticket command
 var ticketCmd = &cobra.Command{
-	Use:   "ticket [number]",
-	Short: "Get a ticket (requires -p)",
+	Use:               "ticket [number]",
+	Short:             "Get a ticket (requires -p)",
+	ValidArgsFunction: firstArg(completeTickets),
 	Run: func(cmd *cobra.Command, args []string) {
 		flags := getTicketCmdFlags
 		projectID := Project()
@@ -36,9 +39,19 @@ var ticketCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		if len(flags.attachment) == 0 {
-			JSON(ticket)
-		} else {
+		switch {
+		case flags.changesets:
+			// the API can't list a ticket's changesets, so
+			// search all of them
+			c := changesets.NewService(service, projectID)
+			cs, err := c.ListAll(&changesets.ListOptions{Ticket: ticket.Number})
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			Render(cs)
+		case len(flags.attachment) == 0:
+			Render(ticket)
+		default:
 			var attachment *tickets.Attachment
 			for _, a := range ticket.Attachments {
 				if a.Attachment.Filename == flags.attachment {
@@ -62,4 +75,5 @@ var ticketCmd = &cobra.Command{
 func init() {
 	getCmd.AddCommand(ticketCmd)
 	ticketCmd.Flags().StringVar(&getTicketCmdFlags.attachment, "attachment", "", "Download ticket attachment by filename (prints attachment to standard out)")
+	ticketCmd.Flags().BoolVar(&getTicketCmdFlags.changesets, "changesets", false, "List the changesets referencing the ticket by ticket ID or [#N] instead")
 }
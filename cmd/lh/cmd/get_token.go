@@ -20,7 +20,7 @@ var tokenCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(t)
+		Render(t)
 	},
 }
 
@@ -17,8 +17,9 @@ var userCmdFlags userCmdOpts
 
 // userCmd represents the user command
 var userCmd = &cobra.Command{
-	Use:   "user [id-or-name]",
-	Short: "Get information about a Lighthouse user",
+	Use:               "user [id-or-name]",
+	Short:             "Get information about a Lighthouse user",
+	ValidArgsFunction: firstArg(completeUsers),
 	Run: func(cmd *cobra.Command, args []string) {
 		flags := userCmdFlags
 		u := users.NewService(service)
@@ -30,7 +31,7 @@ var userCmd = &cobra.Command{
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			JSON(memberships)
+			Render(memberships)
 		} else if flags.avatar {
 			user, err := u.Get(args[0])
 			if err != nil {
@@ -50,7 +51,7 @@ var userCmd = &cobra.Command{
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			JSON(user)
+			Render(user)
 		}
 	},
 }
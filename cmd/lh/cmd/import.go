@@ -0,0 +1,473 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type importCmdOpts struct {
+	users         string
+	state         string
+	dryRun        bool
+	noAttachments bool
+	only          []string
+}
+
+var importCmdFlags importCmdOpts
+
+// importState maps IDs found in the archive to the IDs of the
+// resources created from them.  It is saved after every change so an
+// interrupted import can be re-run without creating duplicates.
+type importState struct {
+	resumeState
+
+	Projects   map[string]int  `json:"projects"`
+	Milestones map[string]int  `json:"milestones"`
+	Bins       map[string]int  `json:"bins"`
+	Messages   map[string]int  `json:"messages"`
+	Tickets    map[string]int  `json:"tickets"`
+	Done       map[string]bool `json:"done"`
+}
+
+func readImportState(filename string) (*importState, error) {
+	st := &importState{}
+	err := readState(filename, st)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range []*map[string]int{&st.Projects, &st.Milestones, &st.Bins, &st.Messages, &st.Tickets} {
+		if *m == nil {
+			*m = map[string]int{}
+		}
+	}
+	if st.Done == nil {
+		st.Done = map[string]bool{}
+	}
+	return st, nil
+}
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import ARCHIVE",
+	Short: "Import an 'lh export' archive into a Lighthouse account",
+	Long: `Import an 'lh export' archive into a Lighthouse account
+
+Projects, milestones, bins, messages with their comments, tickets with
+their latest state and comments, and ticket attachments are recreated
+in the account given by -a, --account.
+
+Lighthouse user IDs differ between accounts, so users referenced by
+the archive are translated using the JSON file given by --users, which
+maps archive user IDs to user IDs or names in the new account:
+
+  {"12345": 67890, "23456": "Jane Doe"}
+
+Users missing from the map are left unassigned.
+
+The IDs of every created resource are recorded in the file given by
+--state-file (default ARCHIVE.import.json).  Re-running an import with the
+same state file skips everything already created, so an import
+interrupted by a failure can safely be resumed.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := importCmdFlags
+		if len(args) != 1 {
+			FatalUsage(cmd, "must supply archive filename")
+		}
+		a, err := readArchive(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		stateFilename := flags.state
+		if len(stateFilename) == 0 {
+			stateFilename = args[0] + ".import.json"
+		}
+		st, err := readImportState(stateFilename)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = st.scope(stateFilename, Account(), 0)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		usersMap, err := readImportUsers(flags.users)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		im := &importer{
+			state:         st,
+			stateFilename: stateFilename,
+			users:         usersMap,
+			dryRun:        flags.dryRun,
+			noAttachments: flags.noAttachments,
+		}
+		only := map[string]bool{}
+		for _, projectStr := range flags.only {
+			only[strings.ToLower(projectStr)] = true
+		}
+		for _, p := range a.projects {
+			if len(only) > 0 && !only[strconv.Itoa(p.ID)] && !only[strings.ToLower(p.Name)] {
+				continue
+			}
+			err = im.project(p)
+			if err != nil {
+				log.Fatal(resumeError(err, "created resources", stateFilename))
+			}
+		}
+		if !flags.dryRun {
+			Render(st)
+		}
+	},
+}
+
+// readImportUsers reads a JSON object mapping archive user IDs to
+// user IDs or names and resolves it to a map of user IDs.
+func readImportUsers(filename string) (map[int]int, error) {
+	usersMap := map[int]int{}
+	if len(filename) == 0 {
+		return usersMap, nil
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]interface{}{}
+	err = json.Unmarshal(buf, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	for k, v := range raw {
+		oldID, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid user ID %q", filename, k)
+		}
+		switch v := v.(type) {
+		case float64:
+			usersMap[oldID] = int(v)
+		case string:
+			newID, err := UserID(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", filename, err)
+			}
+			usersMap[oldID] = newID
+		default:
+			return nil, fmt.Errorf("%s: invalid user %v for user ID %d", filename, v, oldID)
+		}
+	}
+	return usersMap, nil
+}
+
+type importer struct {
+	state         *importState
+	stateFilename string
+	users         map[int]int
+	dryRun        bool
+	noAttachments bool
+}
+
+func (im *importer) logf(format string, v ...interface{}) {
+	if im.dryRun {
+		format = "(dry run) " + format
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", v...)
+}
+
+func (im *importer) save() error {
+	if im.dryRun {
+		return nil
+	}
+	return writeState(im.stateFilename, im.state)
+}
+
+func (im *importer) user(id int) int {
+	return im.users[id]
+}
+
+func (im *importer) project(ap *archiveProject) error {
+	key := strconv.Itoa(ap.ID)
+	projectID, ok := im.state.Projects[key]
+	if !ok {
+		im.logf("creating project %q", ap.Name)
+		if !im.dryRun {
+			p, err := projects.NewService(service).Create(&projects.Project{
+				Name:   ap.Name,
+				Public: ap.Public,
+			})
+			if err != nil {
+				return fmt.Errorf("project %q: %v", ap.Name, err)
+			}
+			projectID = p.ID
+			im.state.Projects[key] = projectID
+			err = im.save()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	m := milestones.NewService(service, projectID)
+	for _, milestone := range ap.milestones {
+		key := strconv.Itoa(milestone.ID)
+		milestoneID, ok := im.state.Milestones[key]
+		if !ok {
+			im.logf("creating milestone %q in project %q", milestone.Title, ap.Name)
+			if im.dryRun {
+				continue
+			}
+			nm, err := m.Create(&milestones.Milestone{
+				Title: milestone.Title,
+				Goals: milestone.Goals,
+				DueOn: milestone.DueOn,
+			})
+			if err != nil {
+				return fmt.Errorf("milestone %q: %v", milestone.Title, err)
+			}
+			milestoneID = nm.ID
+			im.state.Milestones[key] = milestoneID
+			err = im.save()
+			if err != nil {
+				return err
+			}
+		}
+
+		// closing is a separate step so a failure to close doesn't
+		// create the milestone again when re-run
+		doneKey := fmt.Sprintf("milestone/%s/closed", key)
+		if milestone.CompletedAt == nil || im.state.Done[doneKey] {
+			continue
+		}
+		im.logf("closing milestone %q in project %q", milestone.Title, ap.Name)
+		if im.dryRun {
+			continue
+		}
+		err := m.CloseByID(milestoneID)
+		if err != nil {
+			return fmt.Errorf("milestone %q: %v", milestone.Title, err)
+		}
+		im.state.Done[doneKey] = true
+		err = im.save()
+		if err != nil {
+			return err
+		}
+	}
+
+	b := bins.NewService(service, projectID)
+	for _, bin := range ap.bins {
+		key := strconv.Itoa(bin.ID)
+		if _, ok := im.state.Bins[key]; ok {
+			continue
+		}
+		im.logf("creating bin %q in project %q", bin.Name, ap.Name)
+		if im.dryRun {
+			continue
+		}
+		nb, err := b.Create(&bins.Bin{
+			Name:    bin.Name,
+			Query:   bin.Query,
+			Default: bin.Default,
+		})
+		if err != nil {
+			return fmt.Errorf("bin %q: %v", bin.Name, err)
+		}
+		im.state.Bins[key] = nb.ID
+		err = im.save()
+		if err != nil {
+			return err
+		}
+	}
+
+	mg := messages.NewService(service, projectID)
+	for _, message := range ap.messages {
+		err := im.message(mg, ap, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	t := tickets.NewService(service, projectID)
+	for _, ticket := range ap.tickets {
+		err := im.ticket(t, ap, ticket)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (im *importer) message(mg *messages.Service, ap *archiveProject, message *messages.Message) error {
+	key := strconv.Itoa(message.ID)
+	messageID, ok := im.state.Messages[key]
+	if !ok {
+		im.logf("creating message %q in project %q", message.Title, ap.Name)
+		if !im.dryRun {
+			nm, err := mg.Create(&messages.Message{
+				Title: message.Title,
+				Body:  importBody(message.Body, message.UserName, message.CreatedAt),
+			})
+			if err != nil {
+				return fmt.Errorf("message %q: %v", message.Title, err)
+			}
+			messageID = nm.ID
+			im.state.Messages[key] = messageID
+			err = im.save()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, comment := range message.Comments {
+		doneKey := fmt.Sprintf("message/%d/comment/%d", message.ID, comment.ID)
+		if im.state.Done[doneKey] {
+			continue
+		}
+		im.logf("creating comment on message %q in project %q", message.Title, ap.Name)
+		if im.dryRun {
+			continue
+		}
+		_, err := mg.CreateCommentByID(messageID, &messages.Comment{
+			Title: comment.Title,
+			Body:  importBody(comment.Body, comment.UserName, comment.CreatedAt),
+		})
+		if err != nil {
+			return fmt.Errorf("message %q: comment %d: %v", message.Title, comment.ID, err)
+		}
+		im.state.Done[doneKey] = true
+		err = im.save()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (im *importer) ticket(t *tickets.Service, ap *archiveProject, ticket *archiveTicket) error {
+	key := fmt.Sprintf("%d/%d", ap.ID, ticket.Number)
+	number, ok := im.state.Tickets[key]
+	if !ok {
+		im.logf("creating ticket #%d %q in project %q", ticket.Number, ticket.Title, ap.Name)
+		if !im.dryRun {
+			body := ticket.OriginalBody
+			if len(body) == 0 {
+				body = ticket.Body
+			}
+			nt, err := t.Create(&tickets.Ticket{
+				Title:          ticket.Title,
+				Body:           importBody(body, ticket.CreatorName, ticket.CreatedAt),
+				State:          ticket.State,
+				AssignedUserID: im.user(ticket.AssignedUserID),
+				MilestoneID:    im.state.Milestones[strconv.Itoa(ticket.MilestoneID)],
+				Tag:            ticket.Tag,
+			})
+			if err != nil {
+				return fmt.Errorf("ticket #%d: %v", ticket.Number, err)
+			}
+			number = nt.Number
+			im.state.Tickets[key] = number
+			err = im.save()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the first version is the ticket body itself, every later
+	// version with a body is a comment
+	for i, version := range ticket.Versions {
+		if i == 0 || len(strings.TrimSpace(version.Body)) == 0 {
+			continue
+		}
+		doneKey := fmt.Sprintf("ticket/%s/version/%d", key, version.Version)
+		if im.state.Done[doneKey] {
+			continue
+		}
+		im.logf("adding comment to ticket #%d in project %q", ticket.Number, ap.Name)
+		if im.dryRun {
+			continue
+		}
+		nt, err := t.GetByNumber(number)
+		if err != nil {
+			return fmt.Errorf("ticket #%d: %v", ticket.Number, err)
+		}
+		nt.Body = importBody(version.Body, version.UserName, version.CreatedAt)
+		err = t.Update(nt)
+		if err != nil {
+			return fmt.Errorf("ticket #%d: %v", ticket.Number, err)
+		}
+		im.state.Done[doneKey] = true
+		err = im.save()
+		if err != nil {
+			return err
+		}
+	}
+
+	if im.noAttachments {
+		return nil
+	}
+
+	for _, attachment := range ticket.attachments {
+		doneKey := fmt.Sprintf("ticket/%s/attachment/%d", key, attachment.ID)
+		if im.state.Done[doneKey] {
+			continue
+		}
+		im.logf("adding attachment %q to ticket #%d in project %q", attachment.Filename, ticket.Number, ap.Name)
+		if im.dryRun {
+			continue
+		}
+		nt, err := t.GetByNumber(number)
+		if err != nil {
+			return fmt.Errorf("ticket #%d: %v", ticket.Number, err)
+		}
+		nt.Body = ""
+		err = t.AddAttachment(nt, attachment.Filename, bytes.NewReader(attachment.data))
+		if err != nil {
+			return fmt.Errorf("ticket #%d: attachment %q: %v", ticket.Number, attachment.Filename, err)
+		}
+		im.state.Done[doneKey] = true
+		err = im.save()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importBody prefixes body with its original author and date, since
+// everything imported is created as the user owning the API token.
+func importBody(body, userName string, createdAt *time.Time) string {
+	if len(userName) == 0 {
+		return body
+	}
+	byline := "Originally posted by " + userName
+	if createdAt != nil {
+		byline += " on " + createdAt.Format("2006-01-02 15:04:05 MST")
+	}
+	return fmt.Sprintf("_%s_\n\n%s", byline, body)
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&importCmdFlags.users, "users", "", "JSON file mapping archive user IDs to user IDs or names in the new account")
+	importCmd.Flags().StringVar(&importCmdFlags.state, "state-file", "", "File recording created resources, used to resume an import (default ARCHIVE.import.json)")
+	importCmd.Flags().BoolVar(&importCmdFlags.dryRun, "dry-run", false, "Print what would be imported without changing anything")
+	importCmd.Flags().BoolVar(&importCmdFlags.noAttachments, "no-attachments", false, "Don't import ticket attachments")
+	importCmd.Flags().StringSliceVar(&importCmdFlags.only, "only", nil, "Only import the given comma-separated archive project IDs or names")
+}
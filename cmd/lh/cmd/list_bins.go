@@ -16,7 +16,7 @@ var binsCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(bs)
+		Render(bs)
 	},
 }
 
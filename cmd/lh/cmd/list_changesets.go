@@ -1,21 +1,96 @@
 package cmd
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/tickets"
 	"github.com/spf13/cobra"
 )
 
 type changesetsCmdOpts struct {
-	page int
-	all  bool
+	page      int
+	all       bool
+	ticket    string
+	committer string
+	since     string
+	until     string
+	path      string
 }
 
 var changesetsCmdFlags changesetsCmdOpts
 
+// dateLayouts are the layouts accepted by parseDate.
+var dateLayouts = []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339}
+
+// parseDate parses a date given as YYYY-MM-DD, 'YYYY-MM-DD HH:MM:SS'
+// or RFC 3339, in local time unless it includes a zone.
+func parseDate(date string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		t, err := time.ParseInLocation(layout, date, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, must be YYYY-MM-DD, 'YYYY-MM-DD HH:MM:SS' or RFC 3339", date)
+}
+
+// filtered returns whether any of the changeset filters are set.
+func (flags changesetsCmdOpts) filtered() bool {
+	return len(flags.ticket) > 0 || len(flags.committer) > 0 || len(flags.since) > 0 ||
+		len(flags.until) > 0 || len(flags.path) > 0
+}
+
+// listOptions returns the changesets.ListOptions for the flags.
+func (flags changesetsCmdOpts) listOptions() (*changesets.ListOptions, error) {
+	opts := &changesets.ListOptions{
+		Page:      flags.page,
+		Committer: flags.committer,
+		Path:      flags.path,
+	}
+	if len(flags.ticket) > 0 {
+		number, err := tickets.Number(flags.ticket)
+		if err != nil {
+			return nil, err
+		}
+		opts.Ticket = number
+	}
+	if len(flags.since) > 0 {
+		since, err := parseDate(flags.since)
+		if err != nil {
+			return nil, err
+		}
+		opts.Since = since
+	}
+	if len(flags.until) > 0 {
+		until, err := parseDate(flags.until)
+		if err != nil {
+			return nil, err
+		}
+		// --until with only a date includes the whole day
+		if len(flags.until) == len(dateLayouts[0]) {
+			until = until.AddDate(0, 0, 1)
+		}
+		opts.Until = until
+	}
+	return opts, nil
+}
+
 // changesetsCmd represents the changesets command
 var changesetsCmd = &cobra.Command{
 	Use:   "changesets",
 	Short: "List changesets (requires -p)",
+	Long: `List changesets (requires -p)
+
+The Lighthouse API can't filter changesets, so --ticket, --committer,
+--since, --until and --path are applied after fetching them and search
+all of the project's changesets unless --page is given.  --ticket
+matches changesets whose ticket is N or which mention [#N] in their
+title or body.  For example, to list bob's changesets from the first
+week of January:
+
+  lh list changesets --committer bob@example.com --since 2024-01-01 --until 2024-01-07`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var (
 			err error
@@ -24,10 +99,11 @@ var changesetsCmd = &cobra.Command{
 		flags := changesetsCmdFlags
 		projectID := Project()
 		c := changesets.NewService(service, projectID)
-		opts := &changesets.ListOptions{
-			Page: flags.page,
+		opts, err := flags.listOptions()
+		if err != nil {
+			FatalUsage(cmd, err)
 		}
-		if flags.all {
+		if flags.all || (flags.filtered() && flags.page == 0) {
 			cs, err = c.ListAll(opts)
 		} else {
 			cs, err = c.List(opts)
@@ -35,7 +111,7 @@ var changesetsCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(cs)
+		Render(cs)
 	},
 }
 
@@ -43,4 +119,9 @@ func init() {
 	listCmd.AddCommand(changesetsCmd)
 	changesetsCmd.Flags().IntVar(&changesetsCmdFlags.page, "page", 0, "Page to return")
 	changesetsCmd.Flags().BoolVar(&changesetsCmdFlags.all, "all", false, "Return all changesets")
+	changesetsCmd.Flags().StringVar(&changesetsCmdFlags.ticket, "ticket", "", "Only changesets referencing ticket number")
+	changesetsCmd.Flags().StringVar(&changesetsCmdFlags.committer, "committer", "", "Only changesets by committer (name or email, as recorded on the changeset)")
+	changesetsCmd.Flags().StringVar(&changesetsCmdFlags.since, "since", "", "Only changesets changed on or after date")
+	changesetsCmd.Flags().StringVar(&changesetsCmdFlags.until, "until", "", "Only changesets changed before date (a date without a time includes that day)")
+	changesetsCmd.Flags().StringVar(&changesetsCmdFlags.path, "path", "", "Only changesets changing a path starting with prefix")
 }
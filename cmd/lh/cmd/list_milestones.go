@@ -35,7 +35,7 @@ var milestonesCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(ms)
+		Render(ms)
 	},
 }
 
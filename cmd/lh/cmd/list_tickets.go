@@ -39,7 +39,7 @@ var ticketsCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(ts)
+		Render(ts)
 	},
 }
 
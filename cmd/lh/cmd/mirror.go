@@ -0,0 +1,938 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	// register the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/nwidger/lighthouse/users"
+	"github.com/spf13/cobra"
+)
+
+type mirrorSyncCmdOpts struct {
+	full bool
+	only []string
+}
+
+var mirrorSyncCmdFlags mirrorSyncCmdOpts
+
+const mirrorSchema = `
+CREATE TABLE IF NOT EXISTS sync_state (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS projects (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	permalink TEXT,
+	description TEXT,
+	archived BOOLEAN,
+	public BOOLEAN,
+	open_states TEXT,
+	closed_states TEXT,
+	default_assigned_user_id INTEGER,
+	default_milestone_id INTEGER,
+	open_tickets_count INTEGER,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY,
+	name TEXT,
+	job TEXT,
+	website TEXT,
+	avatar_url TEXT
+);
+CREATE TABLE IF NOT EXISTS memberships (
+	id INTEGER,
+	project_id INTEGER NOT NULL REFERENCES projects(id),
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	PRIMARY KEY (project_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS milestones (
+	id INTEGER PRIMARY KEY,
+	project_id INTEGER NOT NULL REFERENCES projects(id),
+	title TEXT,
+	goals TEXT,
+	position INTEGER,
+	tickets_count INTEGER,
+	open_tickets_count INTEGER,
+	due_on TIMESTAMP,
+	completed_at TIMESTAMP,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS tickets (
+	project_id INTEGER NOT NULL REFERENCES projects(id),
+	number INTEGER NOT NULL,
+	title TEXT,
+	state TEXT,
+	closed BOOLEAN,
+	assigned_user_id INTEGER,
+	creator_id INTEGER,
+	user_id INTEGER,
+	milestone_id INTEGER,
+	importance INTEGER,
+	priority INTEGER,
+	tag TEXT,
+	body TEXT,
+	permalink TEXT,
+	url TEXT,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP,
+	PRIMARY KEY (project_id, number)
+);
+CREATE TABLE IF NOT EXISTS ticket_versions (
+	project_id INTEGER NOT NULL,
+	number INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	user_id INTEGER,
+	user_name TEXT,
+	title TEXT,
+	state TEXT,
+	closed BOOLEAN,
+	assigned_user_id INTEGER,
+	milestone_id INTEGER,
+	tag TEXT,
+	body TEXT,
+	previous_state TEXT,
+	previous_title TEXT,
+	previous_assigned_user_id INTEGER,
+	previous_milestone_id INTEGER,
+	previous_tag TEXT,
+	created_at TIMESTAMP,
+	PRIMARY KEY (project_id, number, version),
+	FOREIGN KEY (project_id, number) REFERENCES tickets(project_id, number)
+);
+CREATE TABLE IF NOT EXISTS ticket_tags (
+	project_id INTEGER NOT NULL,
+	number INTEGER NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (project_id, number, tag),
+	FOREIGN KEY (project_id, number) REFERENCES tickets(project_id, number)
+);
+CREATE TABLE IF NOT EXISTS changesets (
+	project_id INTEGER NOT NULL REFERENCES projects(id),
+	revision TEXT NOT NULL,
+	title TEXT,
+	body TEXT,
+	committer TEXT,
+	user_id INTEGER,
+	ticket_id INTEGER,
+	changed_at TIMESTAMP,
+	PRIMARY KEY (project_id, revision)
+);
+CREATE TABLE IF NOT EXISTS changeset_changes (
+	project_id INTEGER NOT NULL,
+	revision TEXT NOT NULL,
+	operation TEXT,
+	path TEXT,
+	FOREIGN KEY (project_id, revision) REFERENCES changesets(project_id, revision)
+);
+CREATE TABLE IF NOT EXISTS messages (
+	id INTEGER PRIMARY KEY,
+	project_id INTEGER NOT NULL REFERENCES projects(id),
+	milestone_id INTEGER,
+	title TEXT,
+	body TEXT,
+	user_id INTEGER,
+	user_name TEXT,
+	comments_count INTEGER,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS comments (
+	id INTEGER PRIMARY KEY,
+	message_id INTEGER NOT NULL REFERENCES messages(id),
+	project_id INTEGER NOT NULL REFERENCES projects(id),
+	title TEXT,
+	body TEXT,
+	user_id INTEGER,
+	user_name TEXT,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS tickets_state ON tickets (project_id, state);
+CREATE INDEX IF NOT EXISTS ticket_versions_created_at ON ticket_versions (created_at);
+CREATE INDEX IF NOT EXISTS changesets_changed_at ON changesets (changed_at);
+`
+
+// mirrorCmd represents the mirror command
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Maintain a local SQLite mirror of a Lighthouse account",
+	Long: `Maintain a local SQLite mirror of a Lighthouse account
+
+'lh mirror sync DB' copies projects, memberships, milestones,
+tickets, ticket versions, tags, changesets, messages, comments and
+users into the SQLite database DB, creating it if necessary.  After
+the first sync, only tickets updated since the previous sync are
+fetched.  Projects and tickets deleted from Lighthouse are deleted
+from the mirror on every sync, deleted changesets only by a full sync
+(--full), since only it lists every changeset.
+
+'lh mirror query DB SQL' runs SQL against the database without making
+any API requests, for example:
+
+  lh mirror query lh.sqlite "SELECT state, COUNT(*) FROM tickets GROUP BY state"
+
+`,
+}
+
+// mirrorSyncCmd represents the mirror sync command
+var mirrorSyncCmd = &cobra.Command{
+	Use:   "sync DB",
+	Short: "Update a local SQLite mirror of the account",
+	Long: `Update a local SQLite mirror of the account
+
+If sync fails due to issuing too many API requests, consider using -r
+and -b to rate limit API requests.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := mirrorSyncCmdFlags
+		if len(args) != 1 {
+			FatalUsage(cmd, "must supply database filename")
+		}
+		only := map[int]bool{}
+		for _, projectStr := range flags.only {
+			id, err := ProjectID(projectStr)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			only[id] = true
+		}
+		db, err := openMirror(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		defer db.Close()
+		m := &mirror{
+			db:    db,
+			full:  flags.full,
+			only:  only,
+			users: map[int]bool{},
+		}
+		err = m.sync()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+// mirrorQueryCmd represents the mirror query command
+var mirrorQueryCmd = &cobra.Command{
+	Use:   "query DB SQL",
+	Short: "Run an SQL query against a local SQLite mirror",
+	// no API requests are made, don't require an account or
+	// credentials
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			FatalUsage(cmd, "must supply database filename and SQL query")
+		}
+		if _, err := os.Stat(args[0]); err != nil {
+			FatalUsage(cmd, err)
+		}
+		db, err := openMirrorReadOnly(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		defer db.Close()
+		rows, err := queryMirror(db, args[1])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Render(rows)
+	},
+}
+
+func openMirror(filename string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(mirrorSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// openMirrorReadOnly opens the database filename for querying only,
+// so neither the schema nor a query can change it.
+func openMirrorReadOnly(filename string) (*sql.DB, error) {
+	// escape the characters which are special in a file: URI
+	path := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(filename)
+	return sql.Open("sqlite3", "file:"+path+"?mode=ro")
+}
+
+// queryMirror runs query and returns each row as a map of column
+// name to value.
+func queryMirror(db *sql.DB, query string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return nil, err
+		}
+		row := map[string]interface{}{}
+		for i, column := range columns {
+			if buf, ok := values[i].([]byte); ok {
+				values[i] = string(buf)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+type mirror struct {
+	db    *sql.DB
+	full  bool
+	only  map[int]bool
+	users map[int]bool
+}
+
+func (m *mirror) logf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", v...)
+}
+
+// syncedAt returns when key was last synced, or false if it hasn't
+// been or this is a full sync.
+func (m *mirror) syncedAt(tx *sql.Tx, key string) (time.Time, bool, error) {
+	if m.full {
+		return time.Time{}, false, nil
+	}
+	var value string
+	err := tx.QueryRow(`SELECT value FROM sync_state WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("sync_state %s: %v", key, err)
+	}
+	return t, true, nil
+}
+
+// mirrorProjectTables are the tables holding a project's rows, in the
+// order they're deleted.
+var mirrorProjectTables = []string{
+	"ticket_tags", "ticket_versions", "tickets", "changeset_changes", "changesets",
+	"comments", "messages", "milestones", "memberships", "projects",
+}
+
+// deleteProjects deletes the projects which are no longer in the
+// account, and all of their rows.
+func (m *mirror) deleteProjects(ps projects.Projects) error {
+	listed := map[int]bool{}
+	for _, project := range ps {
+		listed[project.ID] = true
+	}
+
+	ids, err := queryInts(m.db, `SELECT id FROM projects`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if listed[id] {
+			continue
+		}
+		m.logf("project %d: deleted", id)
+		for _, table := range mirrorProjectTables {
+			column := "project_id"
+			if table == "projects" {
+				column = "id"
+			}
+			_, err = tx.Exec(`DELETE FROM `+table+` WHERE `+column+` = ?`, id)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`DELETE FROM sync_state WHERE key = ?`, "project:"+strconv.Itoa(id))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// queryInts returns the single integer column of each row returned by
+// query.
+func queryInts(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ns := []int{}
+	for rows.Next() {
+		var n int
+		err = rows.Scan(&n)
+		if err != nil {
+			return nil, err
+		}
+		ns = append(ns, n)
+	}
+	return ns, rows.Err()
+}
+
+func (m *mirror) sync() error {
+	p := projects.NewService(service)
+	ps, err := p.List()
+	if err != nil {
+		return err
+	}
+
+	err = m.deleteProjects(ps)
+	if err != nil {
+		return err
+	}
+
+	for _, project := range ps {
+		if len(m.only) > 0 && !m.only[project.ID] {
+			continue
+		}
+		err = m.syncProject(p, project)
+		if err != nil {
+			return fmt.Errorf("project %q: %v", project.Name, err)
+		}
+	}
+
+	return m.syncUsers()
+}
+
+func (m *mirror) syncProject(p *projects.Service, project *projects.Project) error {
+	started := time.Now()
+
+	m.logf("syncing project %q", project.Name)
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m.users[project.DefaultAssignedUserID] = true
+	_, err = tx.Exec(`INSERT OR REPLACE INTO projects (id, name, permalink, description, archived, public,
+		open_states, closed_states, default_assigned_user_id, default_milestone_id, open_tickets_count, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		project.ID, project.Name, project.Permalink, project.Description, project.Archived, project.Public,
+		strings.Join(project.OpenStatesList, ","), strings.Join(project.ClosedStatesList, ","),
+		nullID(project.DefaultAssignedUserID), nullID(project.DefaultMilestoneID), project.OpenTicketsCount,
+		nullTime(project.CreatedAt), nullTimeString(project.UpdatedAt))
+	if err != nil {
+		return err
+	}
+
+	// memberships, milestones and messages are small enough to
+	// replace on every sync
+	memberships, err := p.MembershipsByID(project.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM memberships WHERE project_id = ?`, project.ID)
+	if err != nil {
+		return err
+	}
+	for _, membership := range memberships {
+		m.users[membership.UserID] = true
+		_, err = tx.Exec(`INSERT OR REPLACE INTO memberships (id, project_id, user_id) VALUES (?, ?, ?)`,
+			membership.ID, project.ID, membership.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	ms, err := milestones.NewService(service, project.ID).ListAll(nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM milestones WHERE project_id = ?`, project.ID)
+	if err != nil {
+		return err
+	}
+	for _, milestone := range ms {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO milestones (id, project_id, title, goals, position, tickets_count,
+			open_tickets_count, due_on, completed_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			milestone.ID, project.ID, milestone.Title, milestone.Goals, milestone.Position, milestone.TicketsCount,
+			milestone.OpenTicketsCount, nullTime(milestone.DueOn), nullTime(milestone.CompletedAt),
+			nullTime(milestone.CreatedAt), nullTime(milestone.UpdatedAt))
+		if err != nil {
+			return err
+		}
+	}
+
+	mgs, err := messages.NewService(service, project.ID).List()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`DELETE FROM comments WHERE project_id = ?`,
+		`DELETE FROM messages WHERE project_id = ?`,
+	} {
+		_, err = tx.Exec(stmt, project.ID)
+		if err != nil {
+			return err
+		}
+	}
+	for _, message := range mgs {
+		m.users[message.UserID] = true
+		_, err = tx.Exec(`INSERT OR REPLACE INTO messages (id, project_id, milestone_id, title, body, user_id,
+			user_name, comments_count, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			message.ID, project.ID, nullID(message.MilestoneID), message.Title, message.Body, nullID(message.UserID),
+			message.UserName, message.CommentsCount, nullTime(message.CreatedAt), nullTime(message.UpdatedAt))
+		if err != nil {
+			return err
+		}
+		for _, comment := range message.Comments {
+			m.users[comment.UserID] = true
+			_, err = tx.Exec(`INSERT OR REPLACE INTO comments (id, message_id, project_id, title, body, user_id,
+				user_name, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				comment.ID, message.ID, project.ID, comment.Title, comment.Body, nullID(comment.UserID),
+				comment.UserName, nullTime(comment.CreatedAt), nullTime(comment.UpdatedAt))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = m.syncChangesets(tx, project)
+	if err != nil {
+		return err
+	}
+
+	err = m.syncTickets(tx, project)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO sync_state (key, value) VALUES (?, ?)`,
+		"project:"+strconv.Itoa(project.ID), started.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// syncChangesets fetches changesets newest first, stopping at the
+// first page containing no new changesets unless doing a full sync.
+// Only a full sync lists every changeset, so changesets deleted from
+// Lighthouse are only deleted by a full sync.
+func (m *mirror) syncChangesets(tx *sql.Tx, project *projects.Project) error {
+	c := changesets.NewService(service, project.ID)
+	opts := &changesets.ListOptions{}
+	listed := map[string]bool{}
+	for opts.Page = 1; ; opts.Page++ {
+		cs, err := c.List(opts)
+		if err != nil {
+			return err
+		}
+		if len(cs) == 0 {
+			break
+		}
+		added := 0
+		for _, changeset := range cs {
+			listed[changeset.Revision] = true
+			m.users[changeset.UserID] = true
+			res, err := tx.Exec(`INSERT OR IGNORE INTO changesets (project_id, revision, title, body, committer,
+				user_id, ticket_id, changed_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				project.ID, changeset.Revision, changeset.Title, changeset.Body, changeset.Committer,
+				nullID(changeset.UserID), nullID(changeset.TicketID), nullTime(changeset.ChangedAt))
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				continue
+			}
+			added++
+			for _, change := range changeset.Changes {
+				_, err = tx.Exec(`INSERT INTO changeset_changes (project_id, revision, operation, path)
+					VALUES (?, ?, ?, ?)`,
+					project.ID, changeset.Revision, change.Operation, change.Path)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		m.logf("project %q: %d new changesets", project.Name, added)
+		if added == 0 && !m.full {
+			return nil
+		}
+	}
+
+	if !m.full {
+		return nil
+	}
+
+	rows, err := tx.Query(`SELECT revision FROM changesets WHERE project_id = ?`, project.ID)
+	if err != nil {
+		return err
+	}
+	deleted := []string{}
+	for rows.Next() {
+		var revision string
+		err = rows.Scan(&revision)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if !listed[revision] {
+			deleted = append(deleted, revision)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, revision := range deleted {
+		m.logf("project %q: changeset [%s] deleted", project.Name, revision)
+		for _, stmt := range []string{
+			`DELETE FROM changeset_changes WHERE project_id = ? AND revision = ?`,
+			`DELETE FROM changesets WHERE project_id = ? AND revision = ?`,
+		} {
+			_, err = tx.Exec(stmt, project.ID, revision)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncTickets fetches every ticket updated since the previous sync of
+// project, or every ticket on the first or a full sync, then deletes
+// the tickets which are no longer in the project.
+func (m *mirror) syncTickets(tx *sql.Tx, project *projects.Project) error {
+	t := tickets.NewService(service, project.ID)
+	opts := &tickets.ListOptions{
+		Query: "all",
+		Limit: tickets.MaxLimit,
+	}
+	since, incremental, err := m.syncedAt(tx, "project:"+strconv.Itoa(project.ID))
+	if err != nil {
+		return err
+	}
+	if incremental {
+		// search by day, go back one extra day so time zone
+		// differences can't cause tickets to be missed
+		opts.Query = fmt.Sprintf(`updated:"since %s" sort:updated`, since.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+
+	listed := map[int]bool{}
+	for opts.Page = 1; ; opts.Page++ {
+		ts, err := t.List(opts)
+		if err != nil {
+			return err
+		}
+		if len(ts) == 0 {
+			break
+		}
+		for _, ticket := range ts {
+			listed[ticket.Number] = true
+			// full ticket metadata only returned by
+			// fetching ticket directly
+			ticket, err = t.GetByNumber(ticket.Number)
+			if err != nil {
+				return err
+			}
+			m.logf("project %q: ticket #%d", project.Name, ticket.Number)
+			err = m.syncTicket(tx, project, ticket)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if incremental {
+		// only the updated tickets were listed, list the
+		// numbers of all of them to find the deleted ones
+		listed, err = listTicketNumbers(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	numbers, err := queryInts(tx, `SELECT number FROM tickets WHERE project_id = ?`, project.ID)
+	if err != nil {
+		return err
+	}
+	for _, number := range numbers {
+		if listed[number] {
+			continue
+		}
+		m.logf("project %q: ticket #%d deleted", project.Name, number)
+		for _, stmt := range []string{
+			`DELETE FROM ticket_tags WHERE project_id = ? AND number = ?`,
+			`DELETE FROM ticket_versions WHERE project_id = ? AND number = ?`,
+			`DELETE FROM tickets WHERE project_id = ? AND number = ?`,
+		} {
+			_, err = tx.Exec(stmt, project.ID, number)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// listTicketNumbers returns the numbers of all of the tickets in t's
+// project.
+func listTicketNumbers(t *tickets.Service) (map[int]bool, error) {
+	numbers := map[int]bool{}
+	opts := &tickets.ListOptions{
+		Query: "all",
+		Limit: tickets.MaxLimit,
+	}
+	for opts.Page = 1; ; opts.Page++ {
+		ts, err := t.List(opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(ts) == 0 {
+			return numbers, nil
+		}
+		for _, ticket := range ts {
+			numbers[ticket.Number] = true
+		}
+	}
+}
+
+func (m *mirror) syncTicket(tx *sql.Tx, project *projects.Project, ticket *tickets.Ticket) error {
+	m.users[ticket.AssignedUserID] = true
+	m.users[ticket.CreatorID] = true
+	m.users[ticket.UserID] = true
+
+	body := ticket.OriginalBody
+	if len(body) == 0 {
+		body = ticket.Body
+	}
+	_, err := tx.Exec(`INSERT OR REPLACE INTO tickets (project_id, number, title, state, closed, assigned_user_id,
+		creator_id, user_id, milestone_id, importance, priority, tag, body, permalink, url, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		project.ID, ticket.Number, ticket.Title, ticket.State, ticket.Closed, nullID(ticket.AssignedUserID),
+		nullID(ticket.CreatorID), nullID(ticket.UserID), nullID(ticket.MilestoneID), ticket.Importance,
+		ticket.Priority, ticket.Tag, body, ticket.Permalink, ticket.URL, nullTime(ticket.CreatedAt),
+		nullTime(ticket.UpdatedAt))
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range []string{
+		`DELETE FROM ticket_versions WHERE project_id = ? AND number = ?`,
+		`DELETE FROM ticket_tags WHERE project_id = ? AND number = ?`,
+	} {
+		_, err = tx.Exec(stmt, project.ID, ticket.Number)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, version := range ticket.Versions {
+		m.users[version.UserID] = true
+		d := version.DiffableAttributes
+		if d == nil {
+			d = &tickets.DiffableAttributes{}
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO ticket_versions (project_id, number, version, user_id, user_name,
+			title, state, closed, assigned_user_id, milestone_id, tag, body, previous_state, previous_title,
+			previous_assigned_user_id, previous_milestone_id, previous_tag, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			project.ID, ticket.Number, version.Version, nullID(version.UserID), version.UserName,
+			version.Title, version.State, version.Closed, nullID(version.AssignedUserID), nullID(version.MilestoneID),
+			version.Tag, version.Body, nullString(d.State), nullString(d.Title), nullID(d.AssignedUser),
+			nullID(d.Milestone), nullString(d.Tag), nullTime(version.CreatedAt))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range ticketTags(ticket) {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO ticket_tags (project_id, number, tag) VALUES (?, ?, ?)`,
+			project.ID, ticket.Number, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncUsers fetches every user seen during the sync which isn't
+// already in the database, or every user seen on a full sync.
+// Lighthouse refuses to show some users, such as those who have left
+// the account, so users which can't be fetched due to a 401, 403 or
+// 404 are reported and skipped.
+func (m *mirror) syncUsers() error {
+	u := users.NewService(service)
+	for id := range m.users {
+		if id <= 0 {
+			continue
+		}
+		if !m.full {
+			var n int
+			err := m.db.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ?`, id).Scan(&n)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				continue
+			}
+		}
+		user, err := u.GetByID(id)
+		if eur, ok := err.(*lighthouse.ErrUnexpectedResponse); ok {
+			switch eur.Resp.StatusCode {
+			case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+				m.logf("user %d: skipped, %v", id, err)
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("user %d: %v", id, err)
+		}
+		m.logf("user %q", user.Name)
+		_, err = m.db.Exec(`INSERT OR REPLACE INTO users (id, name, job, website, avatar_url) VALUES (?, ?, ?, ?, ?)`,
+			user.ID, user.Name, user.Job, user.Website, user.AvatarURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ticketTags returns the ticket's tags, parsing Tag if the ticket
+// has no Tags.  Multi-word tags are double-quoted in Tag.
+func ticketTags(t *tickets.Ticket) []string {
+	tags := []string{}
+	for _, tr := range t.Tags {
+		if tr != nil && tr.Tag != nil {
+			tags = append(tags, tr.Tag.Name)
+		}
+	}
+	if len(tags) > 0 {
+		return tags
+	}
+	return splitQuoted(t.Tag)
+}
+
+// splitQuoted splits s on whitespace, keeping double-quoted values
+// together and removing the quotes, as in a ticket's tags or a ticket
+// search.
+func splitQuoted(s string) []string {
+	fields := []string{}
+	quoted := false
+	cur := &strings.Builder{}
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case (r == ' ' || r == '\t') && !quoted:
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+func nullID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func nullString(s string) interface{} {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+func nullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// nullTimeString is nullTime for a time which is only available as a
+// string, such as a project's updated_at.
+func nullTimeString(s string) interface{} {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nullString(s)
+	}
+	return nullTime(&t)
+}
+
+func init() {
+	RootCmd.AddCommand(mirrorCmd)
+	mirrorCmd.AddCommand(mirrorSyncCmd)
+	mirrorCmd.AddCommand(mirrorQueryCmd)
+	mirrorSyncCmd.Flags().BoolVar(&mirrorSyncCmdFlags.full, "full", false, "Fetch everything, not just tickets updated since the previous sync")
+	mirrorSyncCmd.Flags().StringSliceVar(&mirrorSyncCmdFlags.only, "only", nil, "Only sync the given comma-separated Lighthouse projects")
+}
@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/nwidger/jsoncolor"
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/profiles"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/nwidger/lighthouse/users"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// outputFormats are the valid values of --output.
+var outputFormats = []string{"json", "yaml", "csv", "table", "template"}
+
+// outputColumns are the JSON fields printed by the csv and table
+// output formats for each resource.  Resources not listed here use
+// all of their top-level non-object fields.
+var outputColumns = map[reflect.Type][]string{
+	reflect.TypeOf(tickets.Ticket{}):        {"number", "state", "assigned_user_name", "milestone_title", "title"},
+	reflect.TypeOf(tickets.TicketVersion{}): {"version", "state", "user_name", "created_at", "title"},
+	reflect.TypeOf(milestones.Milestone{}):  {"id", "title", "due_on", "open_tickets_count", "tickets_count"},
+	reflect.TypeOf(projects.Project{}):      {"id", "name", "open_tickets_count", "public", "archived"},
+	reflect.TypeOf(projects.Membership{}):   {"id", "user_id", "account"},
+	reflect.TypeOf(bins.Bin{}):              {"id", "name", "tickets_count", "shared", "query"},
+	reflect.TypeOf(messages.Message{}):      {"id", "title", "user_name", "comments_count", "created_at"},
+	reflect.TypeOf(changesets.Changeset{}):  {"revision", "committer", "changed_at", "ticket_id", "title"},
+	reflect.TypeOf(users.User{}):            {"id", "name", "job", "website"},
+	reflect.TypeOf(users.Membership{}):      {"id", "user_id", "account"},
+	reflect.TypeOf(profiles.User{}):         {"id", "name", "job", "website"},
+}
+
+// Output returns the output format selected by --output, LH_OUTPUT or
+// the config file.  If only --template is given, the template format
+// is implied.
+func Output() string {
+	output := strings.ToLower(viper.GetString("output"))
+	if len(output) == 0 {
+		output = "json"
+		if len(viper.GetString("template")) > 0 {
+			output = "template"
+		}
+	}
+	return output
+}
+
+// OutputSet returns whether an output format was chosen with
+// --output, --template, LH_OUTPUT or the config file, for commands
+// which print plain text by default.
+func OutputSet() bool {
+	return len(viper.GetString("output")) > 0 || len(viper.GetString("template")) > 0
+}
+
+// Render prints v to stdout in the format selected by --output.
+func Render(v interface{}) {
+	err := render(os.Stdout, v, Output())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func render(w io.Writer, v interface{}, output string) error {
+	switch output {
+	case "json":
+		return renderJSON(w, v)
+	case "yaml":
+		return renderYAML(w, v)
+	case "csv":
+		return renderCSV(w, v)
+	case "table":
+		return renderTable(w, v)
+	case "template":
+		return renderTemplate(w, v, viper.GetString("template"))
+	}
+	return fmt.Errorf("invalid output format %q, must be one of %s", output, strings.Join(outputFormats, ", "))
+}
+
+// renderJSON prints v as indented JSON, colorized unless
+// --monochrome is given.
+func renderJSON(w io.Writer, v interface{}) error {
+	marshalIndent := jsoncolor.MarshalIndent
+	if viper.GetBool("monochrome") {
+		marshalIndent = json.MarshalIndent
+	}
+	buf, err := marshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(buf))
+	return err
+}
+
+func renderYAML(w io.Writer, v interface{}) error {
+	// round trip through JSON so field names match the JSON output
+	jv, err := jsonValue(v)
+	if err != nil {
+		return err
+	}
+	buf, err := yaml.Marshal(yamlValue(jv))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// yamlValue converts the json.Numbers in v to numbers, otherwise they
+// would be printed as quoted strings.
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = yamlValue(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = yamlValue(value)
+		}
+	}
+	return v
+}
+
+func renderTemplate(w io.Writer, v interface{}, text string) error {
+	if len(text) == 0 {
+		return fmt.Errorf("--output template requires --template")
+	}
+	tmpl, err := template.New("output").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			buf, err := json.Marshal(v)
+			return string(buf), err
+		},
+		"join": strings.Join,
+	}).Parse(text)
+	if err != nil {
+		return err
+	}
+	err = tmpl.Execute(w, v)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(text, "\n") {
+		_, err = fmt.Fprintln(w)
+	}
+	return err
+}
+
+func renderCSV(w io.Writer, v interface{}) error {
+	columns, rows, err := outputRows(v)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
+
+func renderTable(w io.Writer, v interface{}) error {
+	columns, rows, err := outputRows(v)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = strings.ToUpper(column)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		for i := range row {
+			// tabs and newlines would break the table's layout
+			row[i] = strings.Join(strings.Fields(row[i]), " ")
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// outputRows flattens v, either a single resource or a slice of
+// resources, into columns and rows of strings.
+func outputRows(v interface{}) ([]string, [][]string, error) {
+	items := []interface{}{v}
+	elem := reflect.TypeOf(v)
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		items = make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = rv.Index(i).Interface()
+		}
+		elem = elem.Elem()
+	}
+	for elem != nil && elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	maps := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		jv, err := jsonValue(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		m, ok := jv.(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{"value": jv}
+		}
+		maps = append(maps, m)
+	}
+
+	columns := outputColumns[elem]
+	if columns == nil {
+		columns = defaultColumns(maps)
+	}
+
+	rows := make([][]string, 0, len(maps))
+	for _, m := range maps {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = outputValue(m[column])
+		}
+		rows = append(rows, row)
+	}
+
+	return columns, rows, nil
+}
+
+// defaultColumns returns the sorted names of all fields which are not
+// objects or arrays.
+func defaultColumns(maps []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	columns := []string{}
+	for _, m := range maps {
+		for name, value := range m {
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				continue
+			}
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func outputValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(buf)
+}
+
+// jsonValue returns v as decoded from its JSON encoding, keeping
+// numbers as json.Number so large IDs aren't printed in exponent
+// form.
+func jsonValue(v interface{}) (interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var jv interface{}
+	err = dec.Decode(&jv)
+	if err != nil {
+		return nil, err
+	}
+	return jv, nil
+}
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,8 +9,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/nwidger/jsoncolor"
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/credentials"
 	"github.com/nwidger/lighthouse/milestones"
 	"github.com/nwidger/lighthouse/projects"
 	"github.com/nwidger/lighthouse/users"
@@ -42,7 +41,8 @@ you'd prefer to authenticate with an email/password, please specify it
 via -e, --email, the LH_EMAIL environment variable, -p, --password,
 the LH_PASSWORD environment variable or the config file.  If the
 specified password has the form '@FILE', the password is instead read
-from FILE.
+from FILE.  Tokens may instead be kept in a credential store, see 'lh
+auth --help'.
 
 Many subcommands work on resources that are Lighthouse
 project-specific.  These commands require the project ID or name to be
@@ -55,43 +55,80 @@ Windows systems, the default config file is
 %USERPROFILE%\.lh.yaml if necessary.  On all systems, the default can
 be overridden with --config.
 
+The config file may define several named contexts, each with its own
+account, credentials, project and rate limit settings.  Select a
+context with --context, the LH_CONTEXT environment variable or
+current-context in the config file.  See 'lh config --help'.
+
 `,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		account, token, email, password, interval, burstSize := viper.GetString("account"), viper.GetString("token"),
-			viper.GetString("email"), viper.GetString("password"),
-			viper.GetDuration("rate-limit-interval"), viper.GetInt("rate-limit-burst-size")
-		if len(account) == 0 {
-			FatalUsage(cmd, "Please specify Lighthouse account name via -a, --account, LH_ACCOUNT or config file")
-		}
-		lt := &lighthouse.Transport{
-			TokenAsBasicAuth: true,
+		// completions set up the service themselves, only if
+		// they need it, see completion.go
+		if cmd.Name() == cobra.ShellCompRequestCmd {
+			return
 		}
-		client := &http.Client{
-			Transport: lt,
+		s, err := configService()
+		if err != nil {
+			FatalUsage(cmd, err)
 		}
-		if len(token) > 0 {
-			lt.Token = token
-		} else if len(email) > 0 && len(password) > 0 {
-			pw := password
-			if strings.HasPrefix(password, "@") && len(password) > 1 {
-				buf, err := ioutil.ReadFile(password[1:])
-				if err != nil {
-					FatalUsage(cmd, err)
-				}
-				pw = strings.TrimSpace(string(buf))
+		service = s
+	},
+}
+
+// configService returns a service using the account and credentials
+// given by flags, environment variables or the config file.
+func configService() (*lighthouse.Service, error) {
+	if contextErr != nil {
+		return nil, contextErr
+	}
+	account, token, email, password := viper.GetString("account"), viper.GetString("token"),
+		viper.GetString("email"), viper.GetString("password")
+	if len(account) == 0 {
+		return nil, fmt.Errorf("Please specify Lighthouse account name via -a, --account, LH_ACCOUNT or config file")
+	}
+	lt := &lighthouse.Transport{
+		TokenAsBasicAuth: true,
+	}
+	if len(token) > 0 {
+		lt.Token = token
+	} else if len(email) > 0 && len(password) > 0 {
+		pw := password
+		if strings.HasPrefix(password, "@") && len(password) > 1 {
+			buf, err := ioutil.ReadFile(password[1:])
+			if err != nil {
+				return nil, err
 			}
-			lt.Email = email
-			lt.Password = pw
-		} else {
-			FatalUsage(cmd, "Please specify token or email & password")
+			pw = strings.TrimSpace(string(buf))
 		}
-		if interval != time.Duration(0) {
-			lt.RateLimitInterval = interval
-			lt.RateLimitBurstSize = burstSize
+		lt.Email = email
+		lt.Password = pw
+	} else if len(viper.GetString("credential-store")) > 0 {
+		t, err := StoredToken(account, "")
+		if err == credentials.ErrNotFound {
+			return nil, fmt.Errorf("No token stored for %s, please run 'lh auth login'", account)
+		} else if err != nil {
+			return nil, err
 		}
-		service = lighthouse.NewService(account, client)
-		service.RateLimitRetryRequests = true
-	},
+		lt.Token = t
+	} else {
+		return nil, fmt.Errorf("Please specify token or email & password, or run 'lh auth login'")
+	}
+	return newService(account, lt), nil
+}
+
+// newService returns a service for account using lt, rate limited
+// according to --rate-limit-interval and --rate-limit-burst-size.
+func newService(account string, lt *lighthouse.Transport) *lighthouse.Service {
+	interval, burstSize := viper.GetDuration("rate-limit-interval"), viper.GetInt("rate-limit-burst-size")
+	if interval != time.Duration(0) {
+		lt.RateLimitInterval = interval
+		lt.RateLimitBurstSize = burstSize
+	}
+	s := lighthouse.NewService(account, &http.Client{
+		Transport: lt,
+	})
+	s.RateLimitRetryRequests = true
+	return s
 }
 
 // Execute adds all child commands to the root command sets flags appropriately.
@@ -106,51 +143,50 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.lh.yaml)")
+	RootCmd.PersistentFlags().String("context", "", "Config file context to use (default is current-context)")
 	RootCmd.PersistentFlags().StringP("account", "a", "", "Lighthouse account name")
 	RootCmd.PersistentFlags().StringP("token", "t", "", "Lighthouse API token")
 	RootCmd.PersistentFlags().String("email", "", "Lighthouse email (cannot be used with --token)")
 	RootCmd.PersistentFlags().String("password", "", "Lighthouse password (cannot be used with --token)")
+	RootCmd.PersistentFlags().String("credential-store", "", "Credential store for API tokens: keyring, gpg, age or helper")
 	RootCmd.PersistentFlags().StringP("project", "p", "", "Lighthouse project ID or name")
 	RootCmd.PersistentFlags().BoolP("monochrome", "M", false, "Monochrome (don't colorize JSON)")
+	RootCmd.PersistentFlags().StringP("output", "o", "", "Output format: json, yaml, csv, table or template (default json)")
+	RootCmd.PersistentFlags().String("template", "", "Go text/template used to print output (implies --output template)")
 	RootCmd.PersistentFlags().DurationP("rate-limit-interval", "r", lighthouse.DefaultRateLimitInterval, "Interval used to rate limit API requests (use 0 to disable rate limiting)")
 	RootCmd.PersistentFlags().IntP("rate-limit-burst-size", "b", lighthouse.DefaultRateLimitBurstSize, "Burst size used to rate limit API requests (must be used with --rate-limit-interval)")
+	viper.BindPFlag("context", RootCmd.PersistentFlags().Lookup("context"))
 	viper.BindPFlag("account", RootCmd.PersistentFlags().Lookup("account"))
 	viper.BindPFlag("token", RootCmd.PersistentFlags().Lookup("token"))
 	viper.BindPFlag("email", RootCmd.PersistentFlags().Lookup("email"))
 	viper.BindPFlag("password", RootCmd.PersistentFlags().Lookup("password"))
+	viper.BindPFlag("credential-store", RootCmd.PersistentFlags().Lookup("credential-store"))
 	viper.BindPFlag("project", RootCmd.PersistentFlags().Lookup("project"))
 	viper.BindPFlag("monochrome", RootCmd.PersistentFlags().Lookup("monochrome"))
+	viper.BindPFlag("output", RootCmd.PersistentFlags().Lookup("output"))
+	viper.BindPFlag("template", RootCmd.PersistentFlags().Lookup("template"))
 	viper.BindPFlag("rate-limit-interval", RootCmd.PersistentFlags().Lookup("rate-limit-interval"))
 	viper.BindPFlag("rate-limit-burst-size", RootCmd.PersistentFlags().Lookup("rate-limit-burst-size"))
+	RootCmd.RegisterFlagCompletionFunc("project", completeProjects)
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	if cfgFile != "" { // enable ability to specify config file via flag
 		viper.SetConfigFile(cfgFile)
+	} else {
+		viper.SetConfigName(".lh")   // name of config file (without extension)
+		viper.AddConfigPath("$HOME") // adding home directory as first search path
 	}
-
-	viper.SetConfigName(".lh")   // name of config file (without extension)
-	viper.AddConfigPath("$HOME") // adding home directory as first search path
-	viper.SetEnvPrefix("lh")     // will be uppercased automatically
-	viper.AutomaticEnv()         // read in environment variables that match
+	viper.SetEnvPrefix("lh") // will be uppercased automatically
+	viper.AutomaticEnv()     // read in environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		// fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
-}
 
-func JSON(v interface{}) {
-	marshalIndent := jsoncolor.MarshalIndent
-	if viper.GetBool("monochrome") {
-		marshalIndent = json.MarshalIndent
-	}
-	buf, err := marshalIndent(v, "", "  ")
-	if err != nil {
-		log.Fatal(err)
-	}
-	fmt.Println(string(buf))
+	initContext()
 }
 
 func Account() string {
@@ -203,6 +239,9 @@ func ProjectID(projectStr string) (int, error) {
 
 func FatalUsage(cmd *cobra.Command, v ...interface{}) {
 	fmt.Println(v...)
+	if pendingDraft != nil {
+		fmt.Printf("Draft saved to %s\n", pendingDraft.path)
+	}
 	fmt.Println()
 	cmd.Usage()
 	os.Exit(1)
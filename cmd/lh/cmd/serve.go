@@ -0,0 +1,590 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type serveCmdOpts struct {
+	addr string
+}
+
+var serveCmdFlags serveCmdOpts
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve ARCHIVE",
+	Short: "Serve an export archive as a read-only Lighthouse API",
+	Long: `Serve an export archive as a read-only Lighthouse API
+
+Serves the contents of an archive written by 'lh export' using the
+same REST paths and JSON responses as the Lighthouse API, so existing
+programs built on this library can keep reading the data by pointing
+lighthouse.Service.BasePath at the server:
+
+  s := lighthouse.NewService("", http.DefaultClient)
+  s.BasePath = "http://localhost:8080"
+
+Projects, memberships, tickets, milestones, bins, messages,
+changesets, users, the account profile, the account plan, ticket
+attachments and user avatars are served.  Ticket searches using the q
+parameter support the state:, responsible:, assigned:, reported_by:,
+milestone:, tagged:, created:, updated: and sort: keywords and plain
+text.  Requests other than GET are rejected.  No API requests are
+made.
+
+`,
+	// no API requests are made, don't require an account or
+	// credentials
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := serveCmdFlags
+		if len(args) != 1 {
+			FatalUsage(cmd, "must supply archive filename")
+		}
+		a, err := readArchive(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		log.Printf("serving %s on http://%s", args[0], flags.addr)
+		log.Fatal(http.ListenAndServe(flags.addr, &archiveServer{archive: a}))
+	},
+}
+
+// archiveServer serves an archive using the Lighthouse API's paths
+// and response envelopes.
+type archiveServer struct {
+	archive *archive
+}
+
+const (
+	serveMilestonesPerPage = 30
+	serveChangesetsPerPage = 30
+)
+
+func (as *archiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "read-only archive", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path.Clean(r.URL.Path), "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "plan.xml":
+		as.plan(w)
+	case len(parts) == 1 && parts[0] == "profile.json":
+		if as.archive.profile == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeServeJSON(w, map[string]interface{}{"user": as.archive.profile})
+	case len(parts) == 1 && parts[0] == "projects.json":
+		ps := []interface{}{}
+		for _, p := range as.archive.projects {
+			ps = append(ps, map[string]interface{}{"project": p.Project})
+		}
+		writeServeJSON(w, map[string]interface{}{"projects": ps})
+	case len(parts) >= 2 && parts[0] == "projects":
+		as.project(w, r, parts[1:])
+	case len(parts) >= 2 && parts[0] == "users":
+		as.user(w, r, parts[1:])
+	case len(parts) == 5 && parts[0] == "attachments":
+		as.attachment(w, r, parts[1:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeServeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.Encode(v)
+}
+
+// baseURL returns the URL clients used to reach the server, used to
+// rewrite attachment and avatar URLs to point at the server.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (as *archiveServer) plan(w http.ResponseWriter) {
+	if as.archive.plan == nil {
+		http.Error(w, "no plan in archive", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	enc := xml.NewEncoder(w)
+	enc.Encode(&struct {
+		XMLName xml.Name `xml:"hash"`
+		*lighthouse.Plan
+	}{Plan: as.archive.plan})
+}
+
+// serveID parses s with the given suffix removed.
+func serveID(s, suffix string) (int, bool) {
+	if !strings.HasSuffix(s, suffix) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+	return id, err == nil
+}
+
+func servePage(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// paginate returns the bounds of the given page of n items.
+func paginate(n, page, perPage int) (int, int) {
+	start := (page - 1) * perPage
+	if start > n {
+		start = n
+	}
+	end := start + perPage
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+func (as *archiveServer) project(w http.ResponseWriter, r *http.Request, parts []string) {
+	idStr := strings.TrimSuffix(parts[0], ".json")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	p := as.archive.project(id)
+	if p == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 1 {
+		if !strings.HasSuffix(parts[0], ".json") {
+			http.NotFound(w, r)
+			return
+		}
+		writeServeJSON(w, map[string]interface{}{"project": p.Project})
+		return
+	}
+
+	resource, rest := parts[1], parts[2:]
+	switch {
+	case resource == "memberships.json" && len(rest) == 0:
+		ms := []interface{}{}
+		for _, m := range p.memberships {
+			ms = append(ms, map[string]interface{}{"membership": m})
+		}
+		writeServeJSON(w, map[string]interface{}{"memberships": ms})
+	case resource == "tickets.json" && len(rest) == 0:
+		as.tickets(w, r, p)
+	case resource == "tickets" && len(rest) == 1:
+		number, ok := serveID(rest[0], ".json")
+		t := p.ticket(number)
+		if !ok || t == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeServeJSON(w, map[string]interface{}{"ticket": serveTicket(r, p, t, true)})
+	case resource == "milestones.json" && len(rest) == 0:
+		start, end := paginate(len(p.milestones), servePage(r), serveMilestonesPerPage)
+		ms := []interface{}{}
+		for _, m := range p.milestones[start:end] {
+			ms = append(ms, map[string]interface{}{"milestone": m})
+		}
+		writeServeJSON(w, map[string]interface{}{"milestones": ms})
+	case resource == "milestones" && len(rest) == 1:
+		id, ok := serveID(rest[0], ".json")
+		m := p.milestone(id)
+		if !ok || m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeServeJSON(w, map[string]interface{}{"milestone": m})
+	case resource == "bins.json" && len(rest) == 0:
+		bs := []interface{}{}
+		for _, b := range p.bins {
+			bs = append(bs, map[string]interface{}{"ticket_bin": b})
+		}
+		writeServeJSON(w, map[string]interface{}{"ticket_bins": bs})
+	case resource == "bins" && len(rest) == 1:
+		id, ok := serveID(rest[0], ".json")
+		for _, b := range p.bins {
+			if ok && b.ID == id {
+				writeServeJSON(w, map[string]interface{}{"ticket_bin": b})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case resource == "messages.json" && len(rest) == 0:
+		ms := []interface{}{}
+		for _, m := range p.messages {
+			ms = append(ms, map[string]interface{}{"message": m})
+		}
+		writeServeJSON(w, map[string]interface{}{"messages": ms})
+	case resource == "messages" && len(rest) == 1:
+		id, ok := serveID(rest[0], ".json")
+		for _, m := range p.messages {
+			if ok && m.ID == id {
+				writeServeJSON(w, map[string]interface{}{"message": m})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case resource == "changesets.json" && len(rest) == 0:
+		// newest first, like Lighthouse
+		start, end := paginate(len(p.changesets), servePage(r), serveChangesetsPerPage)
+		cs := []interface{}{}
+		for i := len(p.changesets) - 1 - start; i > len(p.changesets)-1-end; i-- {
+			cs = append(cs, map[string]interface{}{"changeset": p.changesets[i]})
+		}
+		writeServeJSON(w, map[string]interface{}{"changesets": cs})
+	case resource == "changesets" && len(rest) == 1:
+		revision := strings.TrimSuffix(rest[0], ".json")
+		for _, c := range p.changesets {
+			if c.Revision == revision {
+				writeServeJSON(w, map[string]interface{}{"changeset": c})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (as *archiveServer) tickets(w http.ResponseWriter, r *http.Request, p *archiveProject) {
+	values := r.URL.Query()
+
+	limit, err := strconv.Atoi(values.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = tickets.DefaultLimit
+	}
+	if limit > tickets.MaxLimit {
+		limit = tickets.MaxLimit
+	}
+
+	q, err := parseTicketQuery(values.Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	matched := q.filter(as.archive, p)
+
+	start, end := paginate(len(matched), servePage(r), limit)
+	ts := []interface{}{}
+	for _, t := range matched[start:end] {
+		ts = append(ts, map[string]interface{}{"ticket": serveTicket(r, p, t, false)})
+	}
+	writeServeJSON(w, map[string]interface{}{"tickets": ts})
+}
+
+// serveTicket returns a copy of t with attachment URLs pointing at
+// the server.  As with Lighthouse, versions are only included when
+// fetching a single ticket.
+func serveTicket(r *http.Request, p *archiveProject, t *archiveTicket, versions bool) *tickets.Ticket {
+	ticket := *t.Ticket
+	if !versions {
+		ticket.Versions = nil
+	}
+	ticket.Attachments = make([]*tickets.AttachmentResponse, 0, len(t.Attachments))
+	for _, ar := range t.Attachments {
+		if ar.Attachment == nil {
+			continue
+		}
+		a := *ar.Attachment
+		a.URL = fmt.Sprintf("%s/attachments/%d/%d/%d/%s", baseURL(r), p.ID, t.Number, a.ID, a.Filename)
+		ticket.Attachments = append(ticket.Attachments, &tickets.AttachmentResponse{Attachment: &a})
+	}
+	return &ticket
+}
+
+func (as *archiveServer) attachment(w http.ResponseWriter, r *http.Request, parts []string) {
+	projectID, err1 := strconv.Atoi(parts[0])
+	number, err2 := strconv.Atoi(parts[1])
+	id, err3 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		http.NotFound(w, r)
+		return
+	}
+	p := as.archive.project(projectID)
+	if p == nil {
+		http.NotFound(w, r)
+		return
+	}
+	t := p.ticket(number)
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+	for _, a := range t.attachments {
+		if a.ID == id {
+			ctype := a.ContentType
+			if len(ctype) == 0 {
+				ctype = "application/octet-stream"
+			}
+			w.Header().Set("Content-Type", ctype)
+			w.Write(a.data)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (as *archiveServer) user(w http.ResponseWriter, r *http.Request, parts []string) {
+	idStr := strings.TrimSuffix(parts[0], ".json")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	u := as.archive.user(id)
+	if u == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && strings.HasSuffix(parts[0], ".json"):
+		user := *u.User
+		if u.avatar != nil {
+			user.AvatarURL = fmt.Sprintf("%s/users/%d/%s", baseURL(r), u.ID, u.avatar.filename)
+		}
+		writeServeJSON(w, map[string]interface{}{"user": &user})
+	case len(parts) == 2 && parts[1] == "memberships.json":
+		ms := []interface{}{}
+		for _, m := range u.memberships {
+			ms = append(ms, map[string]interface{}{"membership": m})
+		}
+		writeServeJSON(w, map[string]interface{}{"memberships": ms})
+	case len(parts) == 2 && u.avatar != nil && parts[1] == u.avatar.filename:
+		ctype := mime.TypeByExtension(filepath.Ext(u.avatar.filename))
+		if len(ctype) == 0 {
+			ctype = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Write(u.avatar.data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ticketQuery is a parsed Lighthouse ticket search, see
+// http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets.
+type ticketQuery struct {
+	keywords []*queryKeyword
+	text     []string
+	sort     string
+}
+
+type queryKeyword struct {
+	key, value string
+}
+
+func parseTicketQuery(s string) (*ticketQuery, error) {
+	q := &ticketQuery{
+		sort: "updated",
+	}
+	for _, field := range splitQuoted(s) {
+		idx := strings.Index(field, ":")
+		if idx == -1 {
+			if strings.ToLower(field) != "all" {
+				q.text = append(q.text, strings.ToLower(field))
+			}
+			continue
+		}
+		key, value := strings.ToLower(field[:idx]), field[idx+1:]
+		switch key {
+		case "sort":
+			q.sort = strings.ToLower(value)
+		case "state", "responsible", "assigned", "reported_by", "milestone", "tagged", "created", "updated":
+			q.keywords = append(q.keywords, &queryKeyword{key: key, value: value})
+		default:
+			return nil, fmt.Errorf("unsupported search keyword %q", key)
+		}
+	}
+	return q, nil
+}
+
+func (q *ticketQuery) filter(a *archive, p *archiveProject) []*archiveTicket {
+	matched := []*archiveTicket{}
+	for _, t := range p.tickets {
+		if q.match(a, p, t) {
+			matched = append(matched, t)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		ti, tj := matched[i], matched[j]
+		switch q.sort {
+		case "number":
+			return ti.Number < tj.Number
+		case "created":
+			return timeAfter(ti.CreatedAt, tj.CreatedAt)
+		case "priority", "importance":
+			return ti.Priority < tj.Priority
+		case "state":
+			return ti.State < tj.State
+		case "title":
+			return strings.ToLower(ti.Title) < strings.ToLower(tj.Title)
+		default:
+			return timeAfter(ti.UpdatedAt, tj.UpdatedAt)
+		}
+	})
+
+	return matched
+}
+
+func timeAfter(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a != nil
+	}
+	return a.After(*b)
+}
+
+func (q *ticketQuery) match(a *archive, p *archiveProject, t *archiveTicket) bool {
+	for _, kw := range q.keywords {
+		if !kw.match(a, p, t) {
+			return false
+		}
+	}
+	if len(q.text) > 0 {
+		text := strings.ToLower(t.Title + "\n" + t.Body + "\n" + t.OriginalBody)
+		for _, word := range q.text {
+			if !strings.Contains(text, word) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (kw *queryKeyword) match(a *archive, p *archiveProject, t *archiveTicket) bool {
+	// comma-separated values match any of the values
+	for _, value := range strings.Split(kw.value, ",") {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if kw.matchValue(a, p, t, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (kw *queryKeyword) matchValue(a *archive, p *archiveProject, t *archiveTicket, value string) bool {
+	switch kw.key {
+	case "state":
+		switch value {
+		case "open":
+			return !t.Closed
+		case "closed":
+			return t.Closed
+		}
+		return strings.ToLower(t.State) == value
+	case "responsible", "assigned":
+		return queryUserMatch(a, t.AssignedUserID, t.AssignedUserName, value)
+	case "reported_by":
+		return queryUserMatch(a, t.CreatorID, t.CreatorName, value)
+	case "milestone":
+		if value == "none" {
+			return t.MilestoneID == 0
+		}
+		if m := p.milestone(t.MilestoneID); m != nil {
+			return strings.ToLower(m.Title) == value
+		}
+		return strings.ToLower(t.MilestoneTitle) == value
+	case "tagged":
+		for _, tag := range ticketTags(t.Ticket) {
+			if strings.ToLower(tag) == value {
+				return true
+			}
+		}
+		return false
+	case "created":
+		return queryTimeMatch(t.CreatedAt, value)
+	case "updated":
+		return queryTimeMatch(t.UpdatedAt, value)
+	}
+	return false
+}
+
+// queryUserMatch matches a user by ID, full name, first name or "me",
+// which is the user whose profile was exported.
+func queryUserMatch(a *archive, id int, name, value string) bool {
+	if value == "me" {
+		return a.profile != nil && a.profile.ID == id && id != 0
+	}
+	if value == "none" {
+		return id == 0
+	}
+	if strconv.Itoa(id) == value {
+		return true
+	}
+	if len(name) == 0 {
+		if u := a.user(id); u != nil {
+			name = u.Name
+		}
+	}
+	fullName := strings.ToLower(name)
+	firstName := fullName
+	if idx := strings.Index(fullName, " "); idx != -1 {
+		firstName = fullName[:idx]
+	}
+	return len(fullName) > 0 && (fullName == value || firstName == value)
+}
+
+// queryTimeMatch matches values of the form "since DATE", "before
+// DATE", "today", "yesterday" or "DATE" where DATE is YYYY-MM-DD.
+func queryTimeMatch(t *time.Time, value string) bool {
+	if t == nil {
+		return false
+	}
+	day := func(s string) (time.Time, bool) {
+		d, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(s), time.Local)
+		return d, err == nil
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	switch {
+	case value == "today":
+		return !t.Before(today)
+	case value == "yesterday":
+		return !t.Before(today.AddDate(0, 0, -1)) && t.Before(today)
+	case strings.HasPrefix(value, "since "):
+		d, ok := day(strings.TrimPrefix(value, "since "))
+		return ok && !t.Before(d)
+	case strings.HasPrefix(value, "before "):
+		d, ok := day(strings.TrimPrefix(value, "before "))
+		return ok && t.Before(d)
+	default:
+		d, ok := day(value)
+		return ok && !t.Before(d) && t.Before(d.AddDate(0, 0, 1))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serveCmdFlags.addr, "addr", "localhost:8080", "Address to listen on")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// resumeState is embedded in the state files of commands which create
+// many resources, such as 'lh import', so that re-running a command
+// which failed part way resumes where it stopped rather than creating
+// duplicates.  Account and ProjectID are where the resources were
+// created, a state file can't be resumed anywhere else.
+type resumeState struct {
+	Account   string `json:"account,omitempty"`
+	ProjectID int    `json:"project_id,omitempty"`
+}
+
+// scope checks that the resources recorded in the state file filename
+// were created in account and projectID, recording them if the state
+// is new.
+func (rs *resumeState) scope(filename, account string, projectID int) error {
+	if len(rs.Account) == 0 {
+		rs.Account, rs.ProjectID = account, projectID
+		return nil
+	}
+	if rs.Account != account || rs.ProjectID != projectID {
+		where := "account " + rs.Account
+		if rs.ProjectID != 0 {
+			where = fmt.Sprintf("project %d in %s", rs.ProjectID, where)
+		}
+		return fmt.Errorf("%s records resources created in %s, use --state-file to start a new state file", filename, where)
+	}
+	return nil
+}
+
+// readState reads the state file filename into st, leaving st as is
+// if the file doesn't exist.
+func readState(filename string, st interface{}) error {
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(buf, st)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// writeState replaces the state file filename with st.  The state is
+// written to a temporary file first so an interrupted write can't lose
+// what was already recorded.
+func writeState(filename string, st interface{}) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	tmp := filename + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// resumeError returns err with a reminder that the resources created
+// so far, what, are recorded in the state file filename.
+func resumeError(err error, what, filename string) error {
+	return fmt.Errorf("%v\n%s are recorded in %s, re-run to resume", err, what, filename)
+}
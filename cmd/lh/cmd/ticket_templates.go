@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ticketFields are the fields of a ticket which can be given by a
+// ticket template or a row of 'lh create tickets --from'.
+type ticketFields struct {
+	Title     string `yaml:"title"`
+	Body      string `yaml:"body"`
+	State     string `yaml:"state"`
+	Assigned  string `yaml:"assigned"`
+	Milestone string `yaml:"milestone"`
+	Tags      string `yaml:"tags"`
+}
+
+// ticketFieldKeys are the names of ticketFields' fields in config
+// files, template front matter and CSV headers.
+var ticketFieldKeys = []string{"title", "state", "assigned", "milestone", "tags", "body"}
+
+// field returns a pointer to the field named key.
+func (tf *ticketFields) field(key string) *string {
+	switch key {
+	case "title":
+		return &tf.Title
+	case "body":
+		return &tf.Body
+	case "state":
+		return &tf.State
+	case "assigned":
+		return &tf.Assigned
+	case "milestone":
+		return &tf.Milestone
+	case "tags":
+		return &tf.Tags
+	}
+	return nil
+}
+
+// merge sets tf's empty fields to the values of defaults.
+func (tf *ticketFields) merge(defaults *ticketFields) {
+	for _, key := range ticketFieldKeys {
+		if f := tf.field(key); len(*f) == 0 {
+			*f = *defaults.field(key)
+		}
+	}
+}
+
+// expand returns tf with each field executed as a Go text/template
+// with vars as its data, e.g. "Release {{.version}}".  Using a
+// variable which isn't in vars is an error.
+func (tf *ticketFields) expand(vars map[string]string) (*ticketFields, error) {
+	expanded := &ticketFields{}
+	for _, key := range ticketFieldKeys {
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(*tf.field(key))
+		if err != nil {
+			return nil, err
+		}
+		buf := &bytes.Buffer{}
+		err = tmpl.Execute(buf, vars)
+		if err != nil {
+			return nil, err
+		}
+		*expanded.field(key) = buf.String()
+	}
+	return expanded, nil
+}
+
+// parseVars parses --var KEY=VALUE flags.
+func parseVars(vars []string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, v := range vars {
+		idx := strings.Index(v, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid variable %q, must be KEY=VALUE", v)
+		}
+		m[v[:idx]] = v[idx+1:]
+	}
+	return m, nil
+}
+
+// ticketTemplateDir returns the directory holding ticket template
+// files, set by ticket-template-dir in the config file.
+func ticketTemplateDir() string {
+	if dir := viper.GetString("ticket-template-dir"); len(dir) > 0 {
+		return expandHome(dir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".lh", "templates")
+}
+
+// ticketTemplate returns the ticket template called name.  Templates
+// are defined under ticket-templates in the config file:
+//
+//	ticket-templates:
+//	  release-checklist:
+//	    title: Release {{.version}} checklist
+//	    milestone: "{{.version}}"
+//	    tags: release
+//	    body: |
+//	      - [ ] Update changelog
+//
+// or as NAME.md files in the ticket template directory, written like
+// an --edit draft with the fields as front matter above the body.
+func ticketTemplate(name string) (*ticketFields, error) {
+	for key, value := range viper.GetStringMap("ticket-templates") {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("ticket template %q in config file must be a map", name)
+		}
+		tf := &ticketFields{}
+		for k, v := range settings {
+			f := tf.field(strings.ToLower(k))
+			if f == nil {
+				return nil, fmt.Errorf("ticket template %q: unknown field %q, must be one of %s", name, k, strings.Join(ticketFieldKeys, ", "))
+			}
+			*f = fmt.Sprint(v)
+		}
+		return tf, nil
+	}
+
+	filename := filepath.Join(ticketTemplateDir(), name+".md")
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		names := ticketTemplateNames()
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no such ticket template %q, none are defined", name)
+		}
+		return nil, fmt.Errorf("no such ticket template %q, must be one of %s", name, strings.Join(names, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := newDraft(name, []string{"title", "state", "assigned", "milestone", "tags"}, nil, "")
+	err = d.parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	tf := &ticketFields{Body: d.Body}
+	for key, value := range d.Fields {
+		*tf.field(key) = value
+	}
+	return tf, nil
+}
+
+// ticketTemplateNames returns the names of all ticket templates.
+func ticketTemplateNames() []string {
+	seen := map[string]bool{}
+	for key := range viper.GetStringMap("ticket-templates") {
+		seen[key] = true
+	}
+	if dir := ticketTemplateDir(); len(dir) > 0 {
+		filenames, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+		for _, filename := range filenames {
+			seen[strings.TrimSuffix(filepath.Base(filename), ".md")] = true
+		}
+	}
+	names := []string{}
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func completeTicketTemplates(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return filterCompletions(ticketTemplateNames(), toComplete)
+}
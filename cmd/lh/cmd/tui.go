@@ -0,0 +1,812 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/nwidger/lighthouse/users"
+	"github.com/spf13/cobra"
+)
+
+type tuiCmdOpts struct {
+	query string
+}
+
+var tuiCmdFlags tuiCmdOpts
+
+// tuiCmd represents the tui command
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse and triage tickets in a terminal UI (requires -p)",
+	Long: `Browse and triage tickets in a terminal UI (requires -p)
+
+Opens a full-screen interface with the project's ticket bins in a
+sidebar, the tickets of the selected bin and the selected ticket's
+details and history.  The first sidebar entry lists the tickets
+matching --query, which can be changed with '/'.
+
+Tickets are changed with single keys, which prompt for the new value
+at the bottom of the screen.  Tab completes states, user names and
+milestone titles.  Changes are shown immediately and sent to
+Lighthouse in the background.  If a change fails, it is undone and
+the error is shown.
+
+  tab/shift-tab  switch pane          s  change state
+  j/k, up/down   move                 a  change assignee
+  g/G            first/last           m  change milestone
+  enter          open bin or ticket   t  change tags
+  /              search tickets       c  add a comment
+  r              reload               e  add a comment in $EDITOR
+  ?              help                 q  quit
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := tuiCmdFlags
+		projectID := Project()
+		screen, err := tcell.NewScreen()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = screen.Init()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = newTUI(screen, projectID, flags.query).run()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+// tuiFetchDelay is how long the selection must stay on a ticket before
+// its history is fetched, so moving through the list doesn't request
+// every ticket along the way.
+const tuiFetchDelay = 300 * time.Millisecond
+
+type tuiPane int
+
+const (
+	tuiBins tuiPane = iota
+	tuiList
+	tuiDetail
+)
+
+// tuiBin is a sidebar entry, either a ticket bin or a search.
+type tuiBin struct {
+	name  string
+	query string
+}
+
+// tuiPrompt reads a value on the bottom line of the screen.
+type tuiPrompt struct {
+	label      string
+	text       []rune
+	candidates []string
+	// matches are the candidates matching text when tab was first
+	// pressed, match is the one last completed.
+	matches []string
+	match   int
+	done    func(string)
+}
+
+// tui is the state of 'lh tui'.  It is only accessed by the event
+// loop in run, requests made in the background hand their results
+// back to the event loop through results.
+type tui struct {
+	screen    tcell.Screen
+	events    chan tcell.Event
+	results   chan func()
+	projectID int
+	tickets   *tickets.Service
+
+	project    *projects.Project
+	members    projects.Memberships
+	milestones milestones.Milestones
+
+	bins      []*tuiBin
+	bin       int
+	binCursor int
+
+	list tickets.Tickets
+	page int
+	more bool
+	// gen is incremented whenever the list is reloaded so results
+	// for a previous list can be discarded.
+	gen      int
+	selected int
+	// history records the tickets in list which were fetched
+	// individually and so include their versions.
+	history  map[int]bool
+	fetching map[int]bool
+	// pending counts the updates of each ticket which haven't
+	// finished yet.
+	pending map[int]int
+
+	focus      tuiPane
+	binTop     int
+	listTop    int
+	listHeight int
+	detailTop  int
+	prompt     *tuiPrompt
+	help       bool
+	status     string
+	loading    int
+	quit       bool
+	err        error
+}
+
+func newTUI(screen tcell.Screen, projectID int, query string) *tui {
+	name := query
+	if len(name) == 0 {
+		name = "All tickets"
+	}
+	return &tui{
+		screen:    screen,
+		events:    make(chan tcell.Event, 16),
+		results:   make(chan func(), 16),
+		projectID: projectID,
+		tickets:   tickets.NewService(service, projectID),
+		bins:      []*tuiBin{{name: name, query: query}},
+		history:   map[int]bool{},
+		fetching:  map[int]bool{},
+		pending:   map[int]int{},
+		focus:     tuiList,
+	}
+}
+
+// tuiPoll forwards screen's events to events until screen is
+// finalized.
+func tuiPoll(screen tcell.Screen, events chan<- tcell.Event) {
+	for {
+		ev := screen.PollEvent()
+		if ev == nil {
+			return
+		}
+		events <- ev
+	}
+}
+
+// run is the event loop, it returns once the user quits.
+func (t *tui) run() error {
+	defer func() {
+		if t.screen != nil {
+			t.screen.Fini()
+		}
+	}()
+	go tuiPoll(t.screen, t.events)
+
+	t.loadProject()
+	t.loadBins()
+	t.loadTickets(1)
+
+	for !t.quit {
+		t.draw()
+		select {
+		case ev := <-t.events:
+			switch ev := ev.(type) {
+			case *tcell.EventKey:
+				t.key(ev)
+			case *tcell.EventResize:
+				t.screen.Sync()
+			}
+		case f := <-t.results:
+			f()
+		}
+	}
+
+	return t.err
+}
+
+// background calls f in a new goroutine, then calls done with f's
+// error from the event loop.
+func (t *tui) background(f func() error, done func(error)) {
+	t.loading++
+	go func() {
+		err := f()
+		t.results <- func() {
+			t.loading--
+			done(err)
+		}
+	}()
+}
+
+// fail shows err on the status line.
+func (t *tui) fail(err error) {
+	t.status = "Error: " + err.Error()
+}
+
+// suspend restores the terminal while f runs, e.g. to run the user's
+// editor, then takes it over again.
+func (t *tui) suspend(f func() error) error {
+	t.screen.Fini()
+	t.screen = nil
+	ferr := f()
+	screen, err := tcell.NewScreen()
+	if err == nil {
+		err = screen.Init()
+	}
+	if err != nil {
+		t.err, t.quit = err, true
+		return err
+	}
+	t.screen = screen
+	go tuiPoll(screen, t.events)
+	return ferr
+}
+
+func (t *tui) loadProject() {
+	var (
+		p   *projects.Project
+		ms  projects.Memberships
+		mls milestones.Milestones
+	)
+	t.background(func() error {
+		var err error
+		ps := projects.NewService(service)
+		p, err = ps.GetByID(t.projectID)
+		if err != nil {
+			return err
+		}
+		ms, err = ps.MembershipsByID(t.projectID)
+		if err != nil {
+			return err
+		}
+		mls, err = milestones.NewService(service, t.projectID).ListAll(nil)
+		return err
+	}, func(err error) {
+		if err != nil {
+			t.fail(err)
+			return
+		}
+		t.project, t.members, t.milestones = p, ms, mls
+	})
+}
+
+func (t *tui) loadBins() {
+	var bs bins.Bins
+	t.background(func() error {
+		var err error
+		bs, err = bins.NewService(service, t.projectID).List()
+		return err
+	}, func(err error) {
+		if err != nil {
+			t.fail(err)
+			return
+		}
+		t.bins = t.bins[:1]
+		for _, b := range bs {
+			t.bins = append(t.bins, &tuiBin{name: b.Name, query: b.Query})
+		}
+		if t.bin >= len(t.bins) {
+			t.bin = 0
+		}
+		if t.binCursor >= len(t.bins) {
+			t.binCursor = t.bin
+		}
+	})
+}
+
+// loadTickets lists a page of the selected bin's tickets.  The first
+// page replaces the list, later pages are appended to it.
+func (t *tui) loadTickets(page int) {
+	if page == 1 {
+		t.gen++
+		t.list, t.selected, t.listTop = nil, 0, 0
+		t.history = map[int]bool{}
+	}
+	t.more = false
+	gen, query := t.gen, t.bins[t.bin].query
+	var ts tickets.Tickets
+	t.background(func() error {
+		var err error
+		ts, err = t.tickets.List(&tickets.ListOptions{
+			Query: query,
+			Limit: tickets.MaxLimit,
+			Page:  page,
+		})
+		return err
+	}, func(err error) {
+		if gen != t.gen {
+			return
+		}
+		if err != nil {
+			t.fail(err)
+			return
+		}
+		t.list = append(t.list, ts...)
+		t.page = page
+		t.more = len(ts) == tickets.MaxLimit
+		if page == 1 {
+			t.showTicket()
+		}
+	})
+}
+
+// ticket returns the selected ticket, if any.
+func (t *tui) ticket() *tickets.Ticket {
+	if t.selected < len(t.list) {
+		return t.list[t.selected]
+	}
+	return nil
+}
+
+// current returns the listed ticket with the same number as tkt,
+// which replaces tkt if it was fetched again while the user was being
+// prompted.
+func (t *tui) current(tkt *tickets.Ticket) *tickets.Ticket {
+	for _, l := range t.list {
+		if l.Number == tkt.Number {
+			return l
+		}
+	}
+	return tkt
+}
+
+// showTicket fetches the selected ticket's history once the selection
+// has stayed on it for tuiFetchDelay.
+func (t *tui) showTicket() {
+	t.detailTop = 0
+	tkt := t.ticket()
+	if tkt == nil || t.history[tkt.Number] {
+		return
+	}
+	number := tkt.Number
+	time.AfterFunc(tuiFetchDelay, func() {
+		t.results <- func() {
+			if tkt := t.ticket(); tkt != nil && tkt.Number == number {
+				t.fetchTicket(number)
+			}
+		}
+	})
+}
+
+// fetchTicket gets ticket number with its versions and replaces the
+// listed ticket with it.
+func (t *tui) fetchTicket(number int) {
+	if t.history[number] || t.fetching[number] || t.pending[number] > 0 {
+		return
+	}
+	t.fetching[number] = true
+	gen := t.gen
+	var tkt *tickets.Ticket
+	t.background(func() error {
+		var err error
+		tkt, err = t.tickets.GetByNumber(number)
+		return err
+	}, func(err error) {
+		delete(t.fetching, number)
+		if gen != t.gen {
+			return
+		}
+		if err != nil {
+			t.fail(err)
+			return
+		}
+		// replacing the ticket would undo optimistic changes,
+		// it is fetched again once they are finished
+		if t.pending[number] > 0 {
+			return
+		}
+		t.history[number] = true
+		for i := range t.list {
+			if t.list[i].Number == number {
+				t.list[i] = tkt
+			}
+		}
+	})
+}
+
+// update applies change to tkt straight away and then sends the
+// changed ticket to Lighthouse in the background.  If the request
+// fails, the change is undone.
+func (t *tui) update(tkt *tickets.Ticket, change func(*tickets.Ticket)) {
+	tkt = t.current(tkt)
+	before := *tkt
+	change(tkt)
+	t.send(tkt, "", func(err error) {
+		if err != nil {
+			*tkt = before
+		}
+	})
+}
+
+// comment adds body to tkt's history straight away and then sends it
+// to Lighthouse in the background.  If the request fails, the comment
+// is removed again, though a comment written in the editor is kept in
+// its draft d.
+func (t *tui) comment(tkt *tickets.Ticket, body string, d *draft) {
+	tkt = t.current(tkt)
+	n := len(tkt.Versions)
+	now := time.Now()
+	tkt.Versions = append(tkt.Versions[:n:n], &tickets.TicketVersion{
+		Body:      body,
+		CreatedAt: &now,
+	})
+	t.send(tkt, body, func(err error) {
+		if err != nil {
+			tkt.Versions = tkt.Versions[:n]
+			if d != nil {
+				t.status += ", draft saved to " + d.path
+			}
+			return
+		}
+		d.done()
+	})
+}
+
+// send updates tkt in the background, adding body as a comment if it
+// isn't empty.  done is called with the result, after which the ticket
+// is fetched again once none of its updates are pending.
+func (t *tui) send(tkt *tickets.Ticket, body string, done func(error)) {
+	number := tkt.Number
+	req := *tkt
+	req.Body = body
+	req.Versions = nil
+	t.pending[number]++
+	t.background(func() error {
+		return t.tickets.Update(&req)
+	}, func(err error) {
+		t.pending[number]--
+		if err != nil {
+			t.fail(fmt.Errorf("updating #%d: %v", number, err))
+		}
+		done(err)
+		if t.pending[number] == 0 {
+			delete(t.pending, number)
+			delete(t.history, number)
+			t.fetchTicket(number)
+		}
+	})
+}
+
+func (t *tui) ask(label, initial string, candidates []string, done func(string)) {
+	t.prompt = &tuiPrompt{
+		label:      label,
+		text:       []rune(initial),
+		candidates: candidates,
+		done:       done,
+	}
+}
+
+func (t *tui) setState(tkt *tickets.Ticket) {
+	var states []string
+	if t.project != nil {
+		states = append(states, t.project.OpenStatesList...)
+		states = append(states, t.project.ClosedStatesList...)
+	}
+	t.ask("State", tkt.State, states, func(state string) {
+		if len(state) == 0 || state == tkt.State {
+			return
+		}
+		t.update(tkt, func(tkt *tickets.Ticket) {
+			tkt.State = state
+			if t.project != nil {
+				tkt.Closed = false
+				for _, closed := range t.project.ClosedStatesList {
+					if strings.EqualFold(closed, state) {
+						tkt.Closed = true
+					}
+				}
+			}
+		})
+	})
+}
+
+func (t *tui) setAssigned(tkt *tickets.Ticket) {
+	names := []string{"none"}
+	for _, m := range t.members {
+		if m.User != nil {
+			names = append(names, m.User.Name)
+		}
+	}
+	assign := func(id int, name string) {
+		t.update(tkt, func(tkt *tickets.Ticket) {
+			tkt.AssignedUserID, tkt.AssignedUserName = id, name
+		})
+	}
+	t.ask("Assign to", tkt.AssignedUserName, names, func(name string) {
+		switch {
+		case len(name) == 0 || name == tkt.AssignedUserName:
+			return
+		case strings.EqualFold(name, "none"):
+			assign(0, "")
+			return
+		}
+		for _, m := range t.members {
+			if m.User != nil && strings.EqualFold(m.User.Name, name) {
+				assign(m.User.ID, m.User.Name)
+				return
+			}
+		}
+		// not a project member, or the members haven't been
+		// loaded yet
+		var u *users.User
+		t.background(func() error {
+			var err error
+			u, err = users.NewService(service).Get(name)
+			return err
+		}, func(err error) {
+			if err != nil {
+				t.fail(err)
+				return
+			}
+			assign(u.ID, u.Name)
+		})
+	})
+}
+
+func (t *tui) setMilestone(tkt *tickets.Ticket) {
+	titles := []string{"none"}
+	for _, m := range t.milestones {
+		titles = append(titles, m.Title)
+	}
+	set := func(id int, title string) {
+		t.update(tkt, func(tkt *tickets.Ticket) {
+			tkt.MilestoneID, tkt.MilestoneTitle = id, title
+		})
+	}
+	t.ask("Milestone", tkt.MilestoneTitle, titles, func(title string) {
+		switch {
+		case len(title) == 0 || title == tkt.MilestoneTitle:
+			return
+		case strings.EqualFold(title, "none"):
+			set(0, "")
+			return
+		}
+		for _, m := range t.milestones {
+			if strings.EqualFold(m.Title, title) {
+				set(m.ID, m.Title)
+				return
+			}
+		}
+		var m *milestones.Milestone
+		t.background(func() error {
+			var err error
+			m, err = milestones.NewService(service, t.projectID).Get(title)
+			return err
+		}, func(err error) {
+			if err != nil {
+				t.fail(err)
+				return
+			}
+			set(m.ID, m.Title)
+		})
+	})
+}
+
+func (t *tui) setTags(tkt *tickets.Ticket) {
+	t.ask("Tags", tkt.Tag, nil, func(tags string) {
+		if tags == tkt.Tag {
+			return
+		}
+		t.update(tkt, func(tkt *tickets.Ticket) {
+			tkt.Tag = tags
+		})
+	})
+}
+
+func (t *tui) addComment(tkt *tickets.Ticket) {
+	t.ask("Comment", "", nil, func(body string) {
+		if len(body) > 0 {
+			t.comment(tkt, body, nil)
+		}
+	})
+}
+
+func (t *tui) editComment(tkt *tickets.Ticket) {
+	d := newDraft(fmt.Sprintf("ticket-%d-%d-comment", t.projectID, tkt.Number), nil, nil, "")
+	err := t.suspend(d.edit)
+	if err != nil {
+		if t.screen != nil {
+			t.fail(err)
+		}
+		return
+	}
+	if len(d.Body) > 0 {
+		t.comment(tkt, d.Body, d)
+	}
+}
+
+func (t *tui) search() {
+	t.ask("Search", t.bins[0].query, nil, func(query string) {
+		name := query
+		if len(name) == 0 {
+			name = "All tickets"
+		}
+		t.bins[0] = &tuiBin{name: name, query: query}
+		t.bin, t.binCursor, t.focus = 0, 0, tuiList
+		t.loadTickets(1)
+	})
+}
+
+func (t *tui) reload() {
+	t.loadProject()
+	t.loadBins()
+	t.loadTickets(1)
+}
+
+// move moves the focused pane's selection by n rows.
+func (t *tui) move(n int) {
+	switch t.focus {
+	case tuiBins:
+		t.binCursor = clamp(t.binCursor+n, 0, len(t.bins)-1)
+	case tuiList:
+		if len(t.list) == 0 {
+			return
+		}
+		if t.selected+n >= len(t.list) && t.more {
+			t.loadTickets(t.page + 1)
+		}
+		selected := clamp(t.selected+n, 0, len(t.list)-1)
+		if selected != t.selected {
+			t.selected = selected
+			t.showTicket()
+		}
+	case tuiDetail:
+		// the bottom is clamped when drawing
+		t.detailTop += n
+		if t.detailTop < 0 {
+			t.detailTop = 0
+		}
+	}
+}
+
+func (t *tui) enter() {
+	switch t.focus {
+	case tuiBins:
+		t.bin, t.focus = t.binCursor, tuiList
+		t.loadTickets(1)
+	case tuiList:
+		if tkt := t.ticket(); tkt != nil {
+			t.focus = tuiDetail
+			t.fetchTicket(tkt.Number)
+		}
+	}
+}
+
+func (t *tui) key(ev *tcell.EventKey) {
+	if t.prompt != nil {
+		t.promptKey(ev)
+		return
+	}
+	if t.help {
+		t.help = false
+		return
+	}
+	t.status = ""
+
+	page := t.listHeight
+	if page < 1 {
+		page = 1
+	}
+	const all = 1 << 30
+
+	switch ev.Key() {
+	case tcell.KeyCtrlC:
+		t.quit = true
+	case tcell.KeyTab:
+		t.focus = (t.focus + 1) % 3
+	case tcell.KeyBacktab:
+		t.focus = (t.focus + 2) % 3
+	case tcell.KeyUp:
+		t.move(-1)
+	case tcell.KeyDown:
+		t.move(1)
+	case tcell.KeyPgUp:
+		t.move(-page)
+	case tcell.KeyPgDn:
+		t.move(page)
+	case tcell.KeyHome:
+		t.move(-all)
+	case tcell.KeyEnd:
+		t.move(all)
+	case tcell.KeyEnter:
+		t.enter()
+	case tcell.KeyEscape:
+		if t.focus == tuiDetail {
+			t.focus = tuiList
+		}
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			t.quit = true
+		case 'j':
+			t.move(1)
+		case 'k':
+			t.move(-1)
+		case 'g':
+			t.move(-all)
+		case 'G':
+			t.move(all)
+		case 'h':
+			if t.focus > tuiBins {
+				t.focus--
+			}
+		case 'l':
+			if t.focus < tuiDetail {
+				t.focus++
+			}
+		case '/':
+			t.search()
+		case 'r':
+			t.reload()
+		case '?':
+			t.help = true
+		}
+
+		tkt := t.ticket()
+		if tkt == nil || t.focus == tuiBins {
+			return
+		}
+		switch ev.Rune() {
+		case 's':
+			t.setState(tkt)
+		case 'a':
+			t.setAssigned(tkt)
+		case 'm':
+			t.setMilestone(tkt)
+		case 't':
+			t.setTags(tkt)
+		case 'c':
+			t.addComment(tkt)
+		case 'e':
+			t.editComment(tkt)
+		}
+	}
+}
+
+func (t *tui) promptKey(ev *tcell.EventKey) {
+	p := t.prompt
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		t.prompt = nil
+	case tcell.KeyEnter:
+		t.prompt = nil
+		p.done(strings.TrimSpace(string(p.text)))
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(p.text) > 0 {
+			p.text = p.text[:len(p.text)-1]
+		}
+		p.matches = nil
+	case tcell.KeyCtrlU:
+		p.text, p.matches = nil, nil
+	case tcell.KeyTab:
+		if p.matches == nil {
+			prefix := strings.ToLower(string(p.text))
+			p.matches, p.match = []string{}, -1
+			for _, c := range p.candidates {
+				if strings.HasPrefix(strings.ToLower(c), prefix) {
+					p.matches = append(p.matches, c)
+				}
+			}
+		}
+		if len(p.matches) > 0 {
+			p.match = (p.match + 1) % len(p.matches)
+			p.text = []rune(p.matches[p.match])
+		}
+	case tcell.KeyRune:
+		p.text = append(p.text, ev.Rune())
+		p.matches = nil
+	}
+}
+
+func clamp(n, min, max int) int {
+	if n > max {
+		n = max
+	}
+	if n < min {
+		n = min
+	}
+	return n
+}
+
+func init() {
+	RootCmd.AddCommand(tuiCmd)
+	tuiCmd.Flags().StringVar(&tuiCmdFlags.query, "query", "state:open", "Search query of the first sidebar entry")
+}
@@ -0,0 +1,413 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell"
+	"github.com/mattn/go-runewidth"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+var (
+	tuiStyle         = tcell.StyleDefault
+	tuiBoldStyle     = tcell.StyleDefault.Bold(true)
+	tuiDimStyle      = tcell.StyleDefault.Dim(true)
+	tuiSelectedStyle = tcell.StyleDefault.Reverse(true)
+	tuiCursorStyle   = tcell.StyleDefault.Underline(true)
+)
+
+var tuiHelp = []string{
+	"tab/shift-tab  switch pane",
+	"h/l            previous/next pane",
+	"j/k, up/down   move",
+	"pgup/pgdn      move a page",
+	"g/G            first/last",
+	"enter          open bin or ticket",
+	"esc            back to ticket list",
+	"/              search tickets",
+	"r              reload",
+	"",
+	"s              change state",
+	"a              change assignee",
+	"m              change milestone",
+	"t              change tags",
+	"c              add a comment",
+	"e              add a comment in $EDITOR",
+	"",
+	"?              toggle help",
+	"q              quit",
+}
+
+// tuiLine is a line of text in the ticket detail pane.
+type tuiLine struct {
+	style tcell.Style
+	text  string
+}
+
+func (t *tui) draw() {
+	if t.screen == nil {
+		return
+	}
+	t.screen.Clear()
+	w, h := t.screen.Size()
+	if w < 40 || h < 10 {
+		t.print(0, 0, w, tuiStyle, "Terminal too small")
+		t.screen.Show()
+		return
+	}
+
+	sideW := clamp(w/5, 16, 30)
+	bodyH := h - 2
+	listH := clamp((bodyH-1)*2/5, 3, bodyH-4)
+	x := sideW + 1
+
+	t.drawHeader(w)
+	t.drawBins(0, 1, sideW, bodyH)
+	for y := 1; y <= bodyH; y++ {
+		t.screen.SetContent(sideW, y, tcell.RuneVLine, nil, tuiDimStyle)
+	}
+	t.drawList(x, 1, w-x, listH)
+	for i := x; i < w; i++ {
+		t.screen.SetContent(i, 1+listH, tcell.RuneHLine, nil, tuiDimStyle)
+	}
+	t.screen.SetContent(sideW, 1+listH, tcell.RuneLTee, nil, tuiDimStyle)
+	t.drawDetail(x, 2+listH, w-x, bodyH-listH-1)
+	t.drawStatus(h-1, w)
+	if t.help {
+		t.drawHelp(w, h)
+	}
+
+	t.screen.Show()
+}
+
+// print draws s at x, y, clipped to width columns, and returns the
+// number of columns used.
+func (t *tui) print(x, y, width int, style tcell.Style, s string) int {
+	col := 0
+	for _, r := range s {
+		if r == '\t' {
+			r = ' '
+		}
+		rw := runewidth.RuneWidth(r)
+		if rw == 0 {
+			continue
+		}
+		if col+rw > width {
+			break
+		}
+		t.screen.SetContent(x+col, y, r, nil, style)
+		col += rw
+	}
+	return col
+}
+
+// fill draws width spaces at x, y.
+func (t *tui) fill(x, y, width int, style tcell.Style) {
+	for i := 0; i < width; i++ {
+		t.screen.SetContent(x+i, y, ' ', nil, style)
+	}
+}
+
+// scroll adjusts top so that row selected is visible in a pane of
+// height rows.
+func scroll(top *int, selected, height int) {
+	if selected < *top {
+		*top = selected
+	}
+	if selected >= *top+height {
+		*top = selected - height + 1
+	}
+	if *top < 0 {
+		*top = 0
+	}
+}
+
+// column truncates or pads s to width columns.
+func column(s string, width int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if runewidth.StringWidth(s) > width {
+		s = runewidth.Truncate(s, width, "…")
+	}
+	return runewidth.FillRight(s, width)
+}
+
+func (t *tui) drawHeader(w int) {
+	t.fill(0, 0, w, tuiSelectedStyle)
+	header := "lh tui"
+	if t.project != nil {
+		header += "  " + t.project.Name
+	}
+	if t.bin < len(t.bins) {
+		header += "  ›  " + t.bins[t.bin].name
+	}
+	header += fmt.Sprintf("  (%d tickets", len(t.list))
+	if t.more {
+		header += ", more"
+	}
+	header += ")"
+	t.print(1, 0, w-2, tuiSelectedStyle, header)
+}
+
+func (t *tui) drawBins(x, y, w, h int) {
+	scroll(&t.binTop, t.binCursor, h)
+	for i := t.binTop; i < len(t.bins) && i-t.binTop < h; i++ {
+		style := tuiStyle
+		if i == t.bin {
+			style = tuiBoldStyle
+		}
+		if i == t.binCursor {
+			if t.focus == tuiBins {
+				style = tuiSelectedStyle
+			} else if i != t.bin {
+				style = tuiCursorStyle
+			}
+		}
+		t.fill(x, y+i-t.binTop, w, style)
+		t.print(x+1, y+i-t.binTop, w-2, style, t.bins[i].name)
+	}
+}
+
+func (t *tui) drawList(x, y, w, h int) {
+	t.listHeight = h - 1
+	t.print(x+1, y, w-2, tuiBoldStyle, column("#", 7)+column("STATE", 11)+column("ASSIGNED", 15)+"TITLE")
+	y, h = y+1, h-1
+
+	if len(t.list) == 0 {
+		msg := "No tickets"
+		if t.loading > 0 {
+			msg = "Loading…"
+		}
+		t.print(x+1, y, w-2, tuiDimStyle, msg)
+		return
+	}
+
+	scroll(&t.listTop, t.selected, h)
+	for i := t.listTop; i < len(t.list) && i-t.listTop < h; i++ {
+		tkt := t.list[i]
+		style := tuiStyle
+		if i == t.selected {
+			style = tuiCursorStyle
+			if t.focus == tuiList {
+				style = tuiSelectedStyle
+			}
+		}
+		number := "#" + strconv.Itoa(tkt.Number)
+		if t.pending[tkt.Number] > 0 {
+			// marks tickets with changes still being sent
+			number += "*"
+		}
+		row := column(number, 7) + column(tkt.State, 11) + column(tkt.AssignedUserName, 15) + tkt.Title
+		t.fill(x, y+i-t.listTop, w, style)
+		t.print(x+1, y+i-t.listTop, w-2, style, row)
+	}
+}
+
+func (t *tui) drawDetail(x, y, w, h int) {
+	tkt := t.ticket()
+	if tkt == nil {
+		return
+	}
+	lines := t.detailLines(tkt, w-2)
+	if t.detailTop > len(lines)-h {
+		t.detailTop = len(lines) - h
+	}
+	if t.detailTop < 0 {
+		t.detailTop = 0
+	}
+	for i := t.detailTop; i < len(lines) && i-t.detailTop < h; i++ {
+		t.print(x+1, y+i-t.detailTop, w-2, lines[i].style, lines[i].text)
+	}
+	if t.focus == tuiDetail && len(lines) > h {
+		t.print(x+w-5, y+h-1, 4, tuiDimStyle, fmt.Sprintf("%3d%%", 100*(t.detailTop+h)/len(lines)))
+	}
+}
+
+// detailLines returns the lines of tkt's detail pane, wrapped to
+// width columns.
+func (t *tui) detailLines(tkt *tickets.Ticket, width int) []tuiLine {
+	lines := []tuiLine{}
+	add := func(style tcell.Style, text string) {
+		for _, line := range wrap(text, width) {
+			lines = append(lines, tuiLine{style, line})
+		}
+	}
+
+	add(tuiBoldStyle, fmt.Sprintf("#%d %s", tkt.Number, tkt.Title))
+	add(tuiStyle, fmt.Sprintf("State: %s   Assigned: %s   Milestone: %s",
+		tkt.State, orNone(tkt.AssignedUserName), orNone(tkt.MilestoneTitle)))
+	add(tuiStyle, "Tags: "+orNone(tkt.Tag))
+	add(tuiDimStyle, fmt.Sprintf("Reported by %s %s, updated %s",
+		tkt.CreatorName, tuiTime(tkt.CreatedAt), tuiTime(tkt.UpdatedAt)))
+	add(tuiStyle, "")
+
+	body := tkt.OriginalBody
+	if len(body) == 0 {
+		body = tkt.Body
+	}
+	add(tuiStyle, body)
+	add(tuiStyle, "")
+
+	if !t.history[tkt.Number] && len(tkt.Versions) == 0 {
+		if t.pending[tkt.Number] == 0 {
+			add(tuiDimStyle, "Loading history…")
+		}
+		return lines
+	}
+	add(tuiBoldStyle, "History")
+	for i, v := range tkt.Versions {
+		if i == 0 {
+			// the first version is the ticket as reported
+			continue
+		}
+		who := v.UserName
+		if len(who) == 0 {
+			who = "(sending)"
+		}
+		add(tuiBoldStyle, fmt.Sprintf("%s  %s", tuiTime(v.CreatedAt), who))
+		if d := v.DiffableAttributes; d != nil {
+			if len(d.State) > 0 {
+				add(tuiStyle, fmt.Sprintf("  state: %s → %s", d.State, v.State))
+			}
+			if len(d.Title) > 0 {
+				add(tuiStyle, fmt.Sprintf("  title: %s → %s", d.Title, v.Title))
+			}
+			if d.AssignedUser != 0 {
+				add(tuiStyle, fmt.Sprintf("  assigned: %s → %s", t.userName(d.AssignedUser), t.userName(v.AssignedUserID)))
+			}
+			if d.Milestone != 0 {
+				add(tuiStyle, fmt.Sprintf("  milestone: %s → %s", t.milestoneTitle(d.Milestone), t.milestoneTitle(v.MilestoneID)))
+			}
+			if len(d.Tag) > 0 {
+				add(tuiStyle, fmt.Sprintf("  tags: %s → %s", d.Tag, orNone(v.Tag)))
+			}
+		}
+		if len(strings.TrimSpace(v.Body)) > 0 {
+			for _, line := range wrap(v.Body, width-2) {
+				lines = append(lines, tuiLine{tuiStyle, "  " + line})
+			}
+		}
+		add(tuiStyle, "")
+	}
+	return lines
+}
+
+func (t *tui) userName(id int) string {
+	if id == 0 {
+		return "none"
+	}
+	for _, m := range t.members {
+		if m.User != nil && m.User.ID == id {
+			return m.User.Name
+		}
+	}
+	return "user " + strconv.Itoa(id)
+}
+
+func (t *tui) milestoneTitle(id int) string {
+	if id == 0 {
+		return "none"
+	}
+	for _, m := range t.milestones {
+		if m.ID == id {
+			return m.Title
+		}
+	}
+	return "milestone " + strconv.Itoa(id)
+}
+
+func orNone(s string) string {
+	if len(s) == 0 {
+		return "none"
+	}
+	return s
+}
+
+func tuiTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// wrap splits s into lines of at most width columns, breaking lines
+// between words where possible.  Spacing within lines is kept so
+// indented text stays indented.
+func wrap(s string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\t", "    ", -1)
+	lines := []string{}
+	for _, para := range strings.Split(s, "\n") {
+		line, col, first := "", 0, true
+		for _, word := range strings.Split(para, " ") {
+			ww := runewidth.StringWidth(word)
+			if !first && col+1+ww > width {
+				lines = append(lines, line)
+				line, col, first = "", 0, true
+			}
+			for ww > width {
+				part := runewidth.Truncate(word, width, "")
+				if len(part) == 0 {
+					// a single rune wider than width
+					_, size := utf8.DecodeRuneInString(word)
+					part = word[:size]
+				}
+				lines = append(lines, part)
+				word = word[len(part):]
+				ww = runewidth.StringWidth(word)
+			}
+			if !first {
+				line += " "
+				col++
+			}
+			line += word
+			col += ww
+			first = false
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return lines
+}
+
+func (t *tui) drawStatus(y, w int) {
+	t.screen.HideCursor()
+	if p := t.prompt; p != nil {
+		col := t.print(0, y, w, tuiBoldStyle, p.label+": ")
+		col += t.print(col, y, w-col, tuiStyle, string(p.text))
+		t.screen.ShowCursor(col, y)
+		return
+	}
+	if len(t.status) > 0 {
+		t.print(0, y, w, tuiBoldStyle, t.status)
+		return
+	}
+	hints := "q quit  ? help  / search  s state  a assign  m milestone  t tags  c comment"
+	if t.loading > 0 {
+		hints = "Loading…  " + hints
+	}
+	t.print(0, y, w, tuiDimStyle, hints)
+}
+
+func (t *tui) drawHelp(w, h int) {
+	bw, bh := 46, len(tuiHelp)+2
+	x, y := (w-bw)/2, (h-bh)/2
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+	for i := 0; i < bh; i++ {
+		t.fill(x, y+i, bw, tuiSelectedStyle)
+	}
+	t.print(x+2, y, bw-4, tuiSelectedStyle.Bold(true), "Keys")
+	for i, line := range tuiHelp {
+		t.print(x+2, y+1+i, bw-4, tuiSelectedStyle, line)
+	}
+}
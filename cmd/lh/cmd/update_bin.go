@@ -16,8 +16,9 @@ var updateBinsCmdFlags updateBinsCmdOpts
 
 // binCmd represents the bin command
 var updateBinCmd = &cobra.Command{
-	Use:   "bin [id-or-name]",
-	Short: "Update a bin (requires -p)",
+	Use:               "bin [id-or-name]",
+	Short:             "Update a bin (requires -p)",
+	ValidArgsFunction: firstArg(completeBins),
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 		flags := updateBinsCmdFlags
@@ -50,7 +51,7 @@ var updateBinCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(bin)
+		Render(bin)
 	},
 }
 
@@ -1,21 +1,26 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/nwidger/lighthouse/messages"
 	"github.com/spf13/cobra"
 )
 
 type updateMessagesCmdOpts struct {
-	title string
-	body  string
+	title   string
+	body    string
+	comment string
+	edit    bool
 }
 
 var updateMessagesCmdFlags updateMessagesCmdOpts
 
 // messageCmd represents the message command
 var updateMessageCmd = &cobra.Command{
-	Use:   "message [id-or-title]",
-	Short: "Update a message (requires -p)",
+	Use:               "message [id-or-title]",
+	Short:             "Update a message (requires -p)",
+	ValidArgsFunction: firstArg(completeMessages),
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 		flags := updateMessagesCmdFlags
@@ -28,21 +33,45 @@ var updateMessageCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		if len(flags.title) > 0 {
-			message.Title = flags.title
+		var d *draft
+		if flags.edit {
+			d = newDraft(fmt.Sprintf("message-%d-%d-comment", projectID, message.ID),
+				[]string{"title"}, map[string]string{"title": message.Title}, flags.comment)
+			err = d.edit()
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			if title := d.changed("title", message.Title); len(title) > 0 {
+				flags.title = title
+			}
+			flags.comment = d.Body
 		}
-		if len(flags.body) > 0 {
-			message.Body = flags.body
+		if len(flags.title) > 0 || len(flags.body) > 0 {
+			if len(flags.title) > 0 {
+				message.Title = flags.title
+			}
+			if len(flags.body) > 0 {
+				message.Body = flags.body
+			}
+			err = m.Update(message)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
 		}
-		err = m.Update(message)
-		if err != nil {
-			FatalUsage(cmd, err)
+		if len(flags.comment) > 0 {
+			_, err = m.CreateCommentByID(message.ID, &messages.Comment{
+				Body: flags.comment,
+			})
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
 		}
+		d.done()
 		message, err = m.GetByID(message.ID)
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(message)
+		Render(message)
 	},
 }
 
@@ -50,4 +79,6 @@ func init() {
 	updateCmd.AddCommand(updateMessageCmd)
 	updateMessageCmd.Flags().StringVar(&updateMessagesCmdFlags.title, "title", "", "Change message title")
 	updateMessageCmd.Flags().StringVar(&updateMessagesCmdFlags.body, "body", "", "Change message body")
+	updateMessageCmd.Flags().StringVar(&updateMessagesCmdFlags.comment, "comment", "", "Add a message comment")
+	updateMessageCmd.Flags().BoolVar(&updateMessagesCmdFlags.edit, "edit", false, "Write the comment and changes in $EDITOR")
 }
@@ -19,8 +19,9 @@ var updateMilestonesCmdFlags updateMilestonesCmdOpts
 
 // milestoneCmd represents the milestone command
 var updateMilestoneCmd = &cobra.Command{
-	Use:   "milestone [id-or-title]",
-	Short: "Update a milestone (requires -p)",
+	Use:               "milestone [id-or-title]",
+	Short:             "Update a milestone (requires -p)",
+	ValidArgsFunction: firstArg(completeMilestones),
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 		flags := updateMilestonesCmdFlags
@@ -66,7 +67,7 @@ var updateMilestoneCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(milestone)
+		Render(milestone)
 	},
 }
 
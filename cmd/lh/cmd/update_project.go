@@ -53,7 +53,7 @@ var updateProjectCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(project)
+		Render(project)
 	},
 }
 
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -16,14 +17,16 @@ type updateTicketsCmdOpts struct {
 	milestone  string
 	tags       string
 	attachment string
+	edit       bool
 }
 
 var updateTicketsCmdFlags updateTicketsCmdOpts
 
 // ticketCmd represents the ticket command
 var updateTicketCmd = &cobra.Command{
-	Use:   "ticket [number]",
-	Short: "Update a ticket (requires -p)",
+	Use:               "ticket [number]",
+	Short:             "Update a ticket (requires -p)",
+	ValidArgsFunction: firstArg(completeTickets),
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 		flags := updateTicketsCmdFlags
@@ -36,6 +39,38 @@ var updateTicketCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
+		var d *draft
+		if flags.edit {
+			initial := map[string]string{
+				"title":     tkt.Title,
+				"state":     tkt.State,
+				"assigned":  tkt.AssignedUserName,
+				"milestone": tkt.MilestoneTitle,
+				"tags":      tkt.Tag,
+			}
+			fields := map[string]string{}
+			for key, value := range initial {
+				fields[key] = value
+			}
+			d = newDraft(fmt.Sprintf("ticket-%d-%d-comment", projectID, tkt.Number),
+				[]string{"title", "state", "assigned", "milestone", "tags"}, fields, flags.comment)
+			err = d.edit()
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			for key, flag := range map[string]*string{
+				"title":     &flags.title,
+				"state":     &flags.state,
+				"assigned":  &flags.assigned,
+				"milestone": &flags.milestone,
+				"tags":      &flags.tags,
+			} {
+				if v := d.changed(key, initial[key]); len(v) > 0 {
+					*flag = v
+				}
+			}
+			flags.comment = d.Body
+		}
 		if len(flags.attachment) > 0 {
 			f, err := os.Open(flags.attachment)
 			if err != nil {
@@ -75,11 +110,12 @@ var updateTicketCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
+		d.done()
 		tkt, err = t.GetByNumber(tkt.Number)
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(tkt)
+		Render(tkt)
 	},
 }
 
@@ -92,4 +128,7 @@ func init() {
 	updateTicketCmd.Flags().StringVar(&updateTicketsCmdFlags.milestone, "milestone", "", "Assign ticket to a milestone")
 	updateTicketCmd.Flags().StringVar(&updateTicketsCmdFlags.tags, "tags", "", "Comma-separated tags")
 	updateTicketCmd.Flags().StringVar(&updateTicketsCmdFlags.attachment, "attachment", "", "Add file as attachment to ticket")
+	updateTicketCmd.Flags().BoolVar(&updateTicketsCmdFlags.edit, "edit", false, "Write the comment and changes in $EDITOR")
+	updateTicketCmd.RegisterFlagCompletionFunc("assigned", completeUsers)
+	updateTicketCmd.RegisterFlagCompletionFunc("milestone", completeMilestones)
 }
@@ -1,8 +1,15 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/nwidger/lighthouse"
 	"github.com/nwidger/lighthouse/tickets"
 	"github.com/spf13/cobra"
 )
@@ -12,14 +19,38 @@ type updateTicketssCmdOpts struct {
 	query          string
 	command        string
 	migrationToken string
+	yes            bool
 }
 
 var updateTicketssCmdFlags updateTicketssCmdOpts
 
+// migrationKeywords matches the command keywords which move tickets
+// to another project or account.
+var migrationKeywords = regexp.MustCompile(`(^|\s)(project|account):`)
+
 // ticketCmd represents the ticket command
 var updateTicketsCmd = &cobra.Command{
 	Use:   "tickets",
 	Short: "Bulk update tickets (requires -p)",
+	Long: `Bulk update tickets (requires -p)
+
+Applies the keywords given by --command, e.g. 'state:resolved
+responsible:alice tagged:triaged', to every ticket matching --query,
+or to every ticket with --all.  The matching tickets are listed first
+and you are asked to confirm the change, unless --yes is given.  Once
+the tickets have been updated, they are listed again to show their
+new states.
+
+Tickets can be moved to another project with the 'project' keyword or
+to another account with the 'account' keyword.  Both require
+--migration-token, an API token with access to the destination.
+
+See http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets
+for the query syntax and
+https://lighthouse.tenderapp.com/kb/ticket-workflow/how-do-i-update-tickets-with-keywords
+for the command keywords.
+
+`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 		flags := updateTicketssCmdFlags
@@ -36,23 +67,138 @@ var updateTicketsCmd = &cobra.Command{
 			}
 			opts.Query = "all"
 		}
-		if len(flags.query) == 0 {
+		if len(opts.Query) == 0 {
 			FatalUsage(cmd, fmt.Errorf("must supply query"))
 		}
-		if len(flags.command) == 0 {
+		if len(opts.Command) == 0 {
 			FatalUsage(cmd, fmt.Errorf("must supply command"))
 		}
+		if migrationKeywords.MatchString(opts.Command) && len(opts.MigrationToken) == 0 {
+			FatalUsage(cmd, fmt.Errorf("must supply --migration-token to move tickets to another project or account"))
+		}
+
+		before, err := t.ListAll(&tickets.ListOptions{
+			Query: opts.Query,
+			Limit: tickets.MaxLimit,
+		})
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		if len(before) == 0 {
+			fmt.Fprintf(os.Stderr, "No tickets match %q\n", opts.Query)
+			Render(before)
+			return
+		}
+		printTicketSummary(before)
+
+		if !flags.yes {
+			ok, err := confirm(fmt.Sprintf("Apply %q to %d tickets?", opts.Command, len(before)))
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			if !ok {
+				fmt.Fprintln(os.Stderr, "Aborted, no tickets were changed")
+				os.Exit(1)
+			}
+		}
+
 		err = t.BulkEdit(opts)
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
+
+		after, err := bulkEditResults(t, opts.Query, before)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Render(after)
 	},
 }
 
+// bulkEditCmd is 'lh bulk-edit', an alias of 'lh update tickets'
+// sharing its flags.
+var bulkEditCmd = &cobra.Command{
+	Use:   "bulk-edit",
+	Short: "Bulk update tickets, same as 'update tickets' (requires -p)",
+	Long:  updateTicketsCmd.Long,
+	Run:   updateTicketsCmd.Run,
+}
+
+// printTicketSummary prints one line per ticket to stderr, leaving
+// stdout for the command's output.
+func printTicketSummary(ts tickets.Tickets) {
+	tw := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	for _, tkt := range ts {
+		fmt.Fprintf(tw, "#%d\t%s\t%s\t%s\n", tkt.Number, tkt.State, tkt.AssignedUserName, tkt.Title)
+	}
+	tw.Flush()
+}
+
+// confirm asks a yes or no question on stderr and reads the answer
+// from stdin.  Anything other than y or yes is no.
+func confirm(question string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return false, fmt.Errorf("no answer read from stdin, use --yes to skip confirmation")
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// bulkEditResults returns the tickets in before as they are after a
+// bulk edit.  The query is listed again, then tickets which no longer
+// match it are fetched individually.  Tickets which were moved to
+// another project are reported on stderr.
+func bulkEditResults(t *tickets.Service, query string, before tickets.Tickets) (tickets.Tickets, error) {
+	matching, err := t.ListAll(&tickets.ListOptions{
+		Query: query,
+		Limit: tickets.MaxLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	byNumber := map[int]*tickets.Ticket{}
+	for _, tkt := range matching {
+		byNumber[tkt.Number] = tkt
+	}
+
+	after := tickets.Tickets{}
+	for _, tkt := range before {
+		if updated, ok := byNumber[tkt.Number]; ok {
+			after = append(after, updated)
+			continue
+		}
+		updated, err := t.GetByNumber(tkt.Number)
+		if eur, ok := err.(*lighthouse.ErrUnexpectedResponse); ok && eur.Resp.StatusCode == http.StatusNotFound {
+			fmt.Fprintf(os.Stderr, "#%d was moved out of the project\n", tkt.Number)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		after = append(after, updated)
+	}
+
+	return after, nil
+}
+
+// updateTicketsFlags adds the flags of 'lh update tickets' to cmd.
+func updateTicketsFlags(cmd *cobra.Command) {
+	fs := cmd.Flags()
+	fs.BoolVar(&updateTicketssCmdFlags.all, "all", false, "Bulk update all tickets (cannot be used with --query)")
+	fs.StringVar(&updateTicketssCmdFlags.query, "query", "", "Search query, see http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets (required unless using --all)")
+	fs.StringVar(&updateTicketssCmdFlags.command, "command", "", "Command keywords, see https://lighthouse.tenderapp.com/kb/ticket-workflow/how-do-i-update-tickets-with-keywords (required)")
+	fs.StringVar(&updateTicketssCmdFlags.migrationToken, "migration-token", "", "If 'project' or 'account' keywords are used in --command, this must be an Lighthouse API token with access to the new project")
+	fs.BoolVar(&updateTicketssCmdFlags.yes, "yes", false, "Don't ask for confirmation")
+}
+
 func init() {
 	updateCmd.AddCommand(updateTicketsCmd)
-	updateTicketsCmd.Flags().BoolVar(&updateTicketssCmdFlags.all, "all", false, "Bulk update all tickets (cannot be used with --query)")
-	updateTicketsCmd.Flags().StringVar(&updateTicketssCmdFlags.query, "query", "", "Search query, see http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets (required)")
-	updateTicketsCmd.Flags().StringVar(&updateTicketssCmdFlags.command, "command", "", "Command keywords, see https://lighthouse.tenderapp.com/kb/ticket-workflow/how-do-i-update-tickets-with-keywords (required unless using --all)")
-	updateTicketsCmd.Flags().StringVar(&updateTicketssCmdFlags.migrationToken, "migration-token", "", "If 'project' or 'account' keywords are used in --command, this must be an Lighthouse API token with access to the new project")
+	updateTicketsFlags(updateTicketsCmd)
+	RootCmd.AddCommand(bulkEditCmd)
+	updateTicketsFlags(bulkEditCmd)
 }
@@ -15,8 +15,9 @@ var updateUserCmdFlags updateUserCmdOpts
 
 // updateUserCmd represents the user command
 var updateUserCmd = &cobra.Command{
-	Use:   "user [id-or-name]",
-	Short: "Update information about a Lighthouse user",
+	Use:               "user [id-or-name]",
+	Short:             "Update information about a Lighthouse user",
+	ValidArgsFunction: firstArg(completeUsers),
 	Run: func(cmd *cobra.Command, args []string) {
 		flags := updateUserCmdFlags
 		u := users.NewService(service)
@@ -44,7 +45,7 @@ var updateUserCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(user)
+		Render(user)
 	},
 }
 
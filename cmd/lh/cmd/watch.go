@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type watchCmdOpts struct {
+	interval time.Duration
+	hook     string
+}
+
+var watchCmdFlags watchCmdOpts
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch Lighthouse resources for changes",
+	Long: `Watch Lighthouse resources for changes
+
+Polls a bin, ticket or milestone every --interval and compares its
+tickets with the previous poll, emitting an event when a ticket is
+added, changes state, is reassigned or is commented on, or no longer
+matches.  The first poll only records the tickets' current states.
+
+Events are printed to stdout as text, one per line, or each in the
+format given by --output or --template, e.g. --output json.  With
+--hook, each event is instead passed as JSON on stdin to the given
+shell command, with LH_EVENT and LH_TICKET set to the event's type
+and ticket number:
+
+  lh watch bin Urgent --hook 'notify-send "$LH_EVENT #$LH_TICKET"'
+
+The event types are new-ticket, state-changed, reassigned,
+comment-added and ticket-removed.  Each poll makes at least one API
+request, so --interval cannot be shorter than --rate-limit-interval.
+
+`,
+}
+
+// watchEvent is a change to a watched ticket.
+type watchEvent struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Watch  string    `json:"watch"`
+	Number int       `json:"number"`
+	Title  string    `json:"title"`
+	URL    string    `json:"url"`
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to,omitempty"`
+	User   string    `json:"user,omitempty"`
+	Body   string    `json:"body,omitempty"`
+}
+
+func (e *watchEvent) String() string {
+	s := fmt.Sprintf("%s %s #%d", e.Time.Format("2006-01-02 15:04:05"), e.Type, e.Number)
+	switch e.Type {
+	case "state-changed", "reassigned":
+		s += fmt.Sprintf(" %s -> %s", orNone(e.From), orNone(e.To))
+	case "comment-added":
+		s += " by " + orNone(e.User)
+	}
+	return s + ": " + e.Title
+}
+
+// ticketWatcher reports changes to the tickets returned by list.
+type ticketWatcher struct {
+	t *tickets.Service
+	// what describes the watched resource, e.g. 'bin Urgent'.
+	what string
+	list func() (tickets.Tickets, error)
+	emit func(e *watchEvent)
+
+	// snapshot holds the tickets returned by the previous poll
+	// by number, nil before the first poll.
+	snapshot map[int]*tickets.Ticket
+}
+
+// watch polls every interval until an error occurs on the first poll.
+// Later errors are reported on stderr and the next poll tries again.
+func (w *ticketWatcher) watch(interval time.Duration) error {
+	err := w.poll()
+	if err != nil {
+		return err
+	}
+	for {
+		time.Sleep(interval)
+		err = w.poll()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "watch %s: %v\n", w.what, err)
+		}
+	}
+}
+
+func (w *ticketWatcher) poll() error {
+	ts, err := w.list()
+	if err != nil {
+		return err
+	}
+	current := map[int]*tickets.Ticket{}
+	for _, tkt := range ts {
+		current[tkt.Number] = tkt
+	}
+	if w.snapshot == nil {
+		w.snapshot = current
+		return nil
+	}
+
+	for _, tkt := range ts {
+		old, ok := w.snapshot[tkt.Number]
+		if !ok {
+			w.event("new-ticket", tkt, nil)
+			continue
+		}
+		err = w.diff(old, tkt)
+		if err != nil {
+			return err
+		}
+	}
+
+	removed := []int{}
+	for number := range w.snapshot {
+		if _, ok := current[number]; !ok {
+			removed = append(removed, number)
+		}
+	}
+	sort.Ints(removed)
+	for _, number := range removed {
+		old := w.snapshot[number]
+		// fetch tickets which no longer match so that the change
+		// which removed them, such as being resolved, is reported.
+		tkt, err := w.t.GetByNumber(number)
+		if eur, ok := err.(*lighthouse.ErrUnexpectedResponse); ok && eur.Resp.StatusCode == http.StatusNotFound {
+			w.event("ticket-removed", old, nil)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = w.diff(old, tkt)
+		if err != nil {
+			return err
+		}
+		w.event("ticket-removed", tkt, nil)
+	}
+
+	w.snapshot = current
+	return nil
+}
+
+// diff emits events for the changes from old to tkt.
+func (w *ticketWatcher) diff(old, tkt *tickets.Ticket) error {
+	if old.State != tkt.State {
+		w.event("state-changed", tkt, func(e *watchEvent) {
+			e.From, e.To = old.State, tkt.State
+		})
+	}
+	if old.AssignedUserID != tkt.AssignedUserID {
+		w.event("reassigned", tkt, func(e *watchEvent) {
+			e.From, e.To = old.AssignedUserName, tkt.AssignedUserName
+		})
+	}
+
+	if tkt.Version == old.Version && timeEqual(tkt.UpdatedAt, old.UpdatedAt) {
+		return nil
+	}
+	// ticket lists don't include versions
+	if len(tkt.Versions) == 0 {
+		full, err := w.t.GetByNumber(tkt.Number)
+		if err != nil {
+			return err
+		}
+		tkt.Versions = full.Versions
+	}
+	for _, v := range tkt.Versions {
+		if v.Version <= old.Version || len(strings.TrimSpace(v.Body)) == 0 {
+			continue
+		}
+		w.event("comment-added", tkt, func(e *watchEvent) {
+			e.User, e.Body = v.UserName, v.Body
+		})
+	}
+	return nil
+}
+
+func (w *ticketWatcher) event(typ string, tkt *tickets.Ticket, f func(e *watchEvent)) {
+	e := &watchEvent{
+		Type:   typ,
+		Time:   time.Now(),
+		Watch:  w.what,
+		Number: tkt.Number,
+		Title:  tkt.Title,
+		URL:    tkt.URL,
+	}
+	if f != nil {
+		f(e)
+	}
+	w.emit(e)
+}
+
+func timeEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// newTicketWatcher returns a watcher emitting events according to
+// the watch command's flags.
+func newTicketWatcher(t *tickets.Service, what string, list func() (tickets.Tickets, error)) (*ticketWatcher, error) {
+	flags := watchCmdFlags
+	if limit := viper.GetDuration("rate-limit-interval"); flags.interval < limit {
+		return nil, fmt.Errorf("--interval must be at least the rate limit interval %v", limit)
+	}
+
+	w := &ticketWatcher{t: t, what: what, list: list}
+	switch {
+	case len(flags.hook) > 0:
+		w.emit = func(e *watchEvent) {
+			err := runWatchHook(flags.hook, e)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "hook failed for %s #%d: %v\n", e.Type, e.Number, err)
+			}
+		}
+	case OutputSet():
+		output := Output()
+		// check the output format and template before the
+		// first poll rather than on the first event
+		err := render(ioutil.Discard, &watchEvent{}, output)
+		if err != nil {
+			return nil, err
+		}
+		w.emit = func(e *watchEvent) {
+			err := render(os.Stdout, e, output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s #%d: %v\n", e.Type, e.Number, err)
+			}
+		}
+	default:
+		w.emit = func(e *watchEvent) {
+			fmt.Println(e)
+		}
+	}
+	return w, nil
+}
+
+// runWatchHook runs hook with the shell, passing e as JSON on stdin.
+func runWatchHook(hook string, e *watchEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", hook)
+	} else {
+		cmd = exec.Command("sh", "-c", hook)
+	}
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), "LH_EVENT="+e.Type, "LH_TICKET="+strconv.Itoa(e.Number))
+	return cmd.Run()
+}
+
+func init() {
+	RootCmd.AddCommand(watchCmd)
+	watchCmd.PersistentFlags().DurationVar(&watchCmdFlags.interval, "interval", time.Minute, "Interval between polls")
+	watchCmd.PersistentFlags().StringVar(&watchCmdFlags.hook, "hook", "", "Shell command run for each event with the event as JSON on stdin")
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+// watchBinCmd represents the watch bin command
+var watchBinCmd = &cobra.Command{
+	Use:               "bin [id-or-name]",
+	Short:             "Watch the tickets in a bin (requires -p)",
+	ValidArgsFunction: firstArg(completeBins),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectID := Project()
+		if len(args) == 0 {
+			FatalUsage(cmd, "must supply bin ID or name")
+		}
+		bin, err := bins.NewService(service, projectID).Get(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		t := tickets.NewService(service, projectID)
+		w, err := newTicketWatcher(t, "bin "+bin.Name, func() (tickets.Tickets, error) {
+			return t.ListAll(&tickets.ListOptions{
+				Query: bin.Query,
+				Limit: tickets.MaxLimit,
+			})
+		})
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = w.watch(watchCmdFlags.interval)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+func init() {
+	watchCmd.AddCommand(watchBinCmd)
+}
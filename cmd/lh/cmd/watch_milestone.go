@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"strconv"
+
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+// watchMilestoneCmd represents the watch milestone command
+var watchMilestoneCmd = &cobra.Command{
+	Use:               "milestone [id-or-title]",
+	Short:             "Watch the tickets in a milestone (requires -p)",
+	ValidArgsFunction: firstArg(completeMilestones),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectID := Project()
+		if len(args) == 0 {
+			FatalUsage(cmd, "must supply milestone ID or title")
+		}
+		m, err := milestones.NewService(service, projectID).Get(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		t := tickets.NewService(service, projectID)
+		w, err := newTicketWatcher(t, "milestone "+m.Title, func() (tickets.Tickets, error) {
+			return t.ListAll(&tickets.ListOptions{
+				Query: "milestone:" + strconv.Quote(m.Title),
+				Limit: tickets.MaxLimit,
+			})
+		})
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = w.watch(watchCmdFlags.interval)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+func init() {
+	watchCmd.AddCommand(watchMilestoneCmd)
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+// watchTicketCmd represents the watch ticket command
+var watchTicketCmd = &cobra.Command{
+	Use:               "ticket [number]",
+	Short:             "Watch a ticket (requires -p)",
+	ValidArgsFunction: firstArg(completeTickets),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectID := Project()
+		if len(args) == 0 {
+			FatalUsage(cmd, "must supply ticket number")
+		}
+		t := tickets.NewService(service, projectID)
+		tkt, err := t.Get(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		w, err := newTicketWatcher(t, "ticket "+strconv.Itoa(tkt.Number), func() (tickets.Tickets, error) {
+			tkt, err := t.GetByNumber(tkt.Number)
+			if eur, ok := err.(*lighthouse.ErrUnexpectedResponse); ok && eur.Resp.StatusCode == http.StatusNotFound {
+				return tickets.Tickets{}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return tickets.Tickets{tkt}, nil
+		})
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = w.watch(watchCmdFlags.interval)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+func init() {
+	watchCmd.AddCommand(watchTicketCmd)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/nwidger/lighthouse/credentials"
+	"github.com/nwidger/lighthouse/hooks"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// config is the lhwebhook configuration file.
+type config struct {
+	// Listen is the address to listen on, overridden by -listen.
+	Listen string `yaml:"listen"`
+	// Spool is the directory changesets are queued in before
+	// they're posted.
+	Spool string `yaml:"spool"`
+	// Secret is the webhook secret of repositories which don't set
+	// their own.
+	Secret string `yaml:"secret"`
+
+	Repositories []*repositoryConfig `yaml:"repositories"`
+
+	// Tokens maps commit author emails, or names if they have no
+	// email, to Lighthouse API tokens.
+	Tokens map[string]string `yaml:"tokens"`
+	// Credentials optionally configures a credential store which
+	// is checked before Tokens.
+	Credentials *credentials.Config `yaml:"credentials"`
+}
+
+// repositoryConfig maps a repository on the forge to a Lighthouse
+// project.
+type repositoryConfig struct {
+	// Name is the repository's full name, e.g. owner/name or
+	// group/subgroup/name.
+	Name    string `yaml:"name"`
+	Secret  string `yaml:"secret"`
+	Account string `yaml:"account"`
+	Project int    `yaml:"project"`
+}
+
+func readConfig(path string) (*config, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{}
+	err = yaml.UnmarshalStrict(buf, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if len(cfg.Spool) == 0 {
+		cfg.Spool = "lhwebhook-spool"
+	}
+
+	// repositories are looked up by their lowercased name
+	seen := map[string]bool{}
+	for i, rc := range cfg.Repositories {
+		switch {
+		case len(rc.Name) == 0:
+			return nil, fmt.Errorf("%s: repository %d: name is required", path, i+1)
+		case seen[strings.ToLower(rc.Name)]:
+			return nil, fmt.Errorf("%s: repository %s: listed more than once", path, rc.Name)
+		case len(rc.Account) == 0 || rc.Project == 0:
+			return nil, fmt.Errorf("%s: repository %s: account and project are required", path, rc.Name)
+		case len(rc.Secret) == 0 && len(cfg.Secret) == 0:
+			return nil, fmt.Errorf("%s: repository %s: secret is required", path, rc.Name)
+		}
+		if len(rc.Secret) == 0 {
+			rc.Secret = cfg.Secret
+		}
+		seen[strings.ToLower(rc.Name)] = true
+	}
+
+	return cfg, nil
+}
+
+// hooksConfig returns the configuration used to post rc's changesets.
+func (cfg *config) hooksConfig(rc *repositoryConfig, store credentials.Store) *hooks.Config {
+	return &hooks.Config{
+		Account:   rc.Account,
+		ProjectID: rc.Project,
+		Store:     store,
+		Keys: func(user string) (string, error) {
+			token, ok := cfg.Tokens[user]
+			if !ok {
+				return "", hooks.ErrNoToken
+			}
+			return token, nil
+		},
+		User: func(c *hooks.Commit) string {
+			if len(c.Email) > 0 {
+				return c.Email
+			}
+			return c.Author
+		},
+	}
+}
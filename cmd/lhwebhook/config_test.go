@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name: "valid",
+			config: `secret: s3cret
+repositories:
+  - {name: org/repo, account: acme, project: 1}
+  - {name: org/other, account: acme, project: 2, secret: other}
+`,
+		},
+		{
+			name: "duplicate",
+			config: `secret: s3cret
+repositories:
+  - {name: org/repo, account: acme, project: 1}
+  - {name: org/repo, account: acme, project: 2}
+`,
+			err: "listed more than once",
+		},
+		{
+			name: "duplicate differing in case",
+			config: `secret: s3cret
+repositories:
+  - {name: Org/Repo, account: acme, project: 1}
+  - {name: org/repo, account: acme, project: 2}
+`,
+			err: "listed more than once",
+		},
+		{
+			name: "missing secret",
+			config: `repositories:
+  - {name: org/repo, account: acme, project: 1}
+`,
+			err: "secret is required",
+		},
+		{
+			name: "missing project",
+			config: `secret: s3cret
+repositories:
+  - {name: org/repo, account: acme}
+`,
+			err: "account and project are required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "lhwebhook.yaml")
+			err := ioutil.WriteFile(path, []byte(tt.config), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = readConfig(path)
+			switch {
+			case len(tt.err) == 0 && err != nil:
+				t.Errorf("readConfig() = %v, want nil", err)
+			case len(tt.err) > 0 && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("readConfig() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
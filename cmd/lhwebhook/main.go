@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/credentials"
+	"github.com/nwidger/lighthouse/hooks"
+)
+
+// maxBodySize limits the size of webhook requests.
+const maxBodySize = 25 << 20
+
+// The server's timeouts, which webhook deliveries are well within.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 30 * time.Second
+)
+
+// repository posts the changesets pushed to a repository, queued in
+// its own spool so they're posted in order and kept across restarts.
+type repository struct {
+	cfg    *repositoryConfig
+	spool  *hooks.Spool
+	poster *hooks.Poster
+	ledger *hooks.Ledger
+	wake   chan struct{}
+}
+
+func newRepository(cfg *config, rc *repositoryConfig, store credentials.Store) (*repository, error) {
+	dir := filepath.Join(cfg.Spool, url.PathEscape(rc.Name))
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger, err := hooks.ReadLedger(filepath.Join(dir, "posted"))
+	if err != nil {
+		return nil, err
+	}
+
+	logf := func(format string, v ...interface{}) {
+		log.Printf(rc.Name+": "+format, v...)
+	}
+
+	hcfg := cfg.hooksConfig(rc, store)
+	hcfg.RateLimitInterval = lighthouse.DefaultRateLimitInterval
+	poster := hooks.NewPoster(hcfg)
+	poster.Logf = logf
+
+	return &repository{
+		cfg:    rc,
+		spool:  &hooks.Spool{Dir: dir, Logf: logf},
+		poster: poster,
+		ledger: ledger,
+		wake:   make(chan struct{}, 1),
+	}, nil
+}
+
+// run drains the spool each time changesets are queued.
+func (r *repository) run() {
+	for range r.wake {
+		err := r.spool.Drain(r.deliver)
+		if err != nil {
+			log.Printf("%s: %s", r.cfg.Name, err)
+		}
+	}
+}
+
+// notify wakes run, unless it's already due to drain the spool.
+func (r *repository) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver posts c unless it was already posted, for example because
+// the same commit was pushed to another branch.
+func (r *repository) deliver(c *hooks.Changeset) error {
+	if err := r.poster.As(c.Commit); err != nil {
+		return hooks.Permanent(err)
+	}
+
+	existing, posted, err := r.ledger.AlreadyPosted(r.poster.Changesets(), c)
+	if err != nil {
+		log.Printf("%s: unable to check whether %s was already posted: %s", r.cfg.Name, c.Revision, err)
+	}
+	if posted {
+		if existing != nil {
+			if lerr := r.ledger.Record(c.Revision, c.Ref); lerr != nil {
+				log.Printf("%s: %s", r.cfg.Name, lerr)
+			}
+		}
+		return nil
+	}
+
+	err = r.poster.Post(c)
+	if err != nil {
+		return err
+	}
+
+	if lerr := r.ledger.Record(c.Revision, c.Ref); lerr != nil {
+		log.Printf("%s: %s", r.cfg.Name, lerr)
+	}
+	return nil
+}
+
+// server receives push webhooks and queues their changesets.
+type server struct {
+	// repositories are keyed by lowercased name.
+	repositories map[string]*repository
+	// unknownSecret is a random secret requests for unknown
+	// repositories are verified with, so they're rejected the same
+	// way as bad signatures and don't reveal which repositories
+	// are configured.
+	unknownSecret string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f, event, err := detectForge(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !f.isPush(event) {
+		fmt.Fprintf(w, "ignoring %s event\n", event)
+		return
+	}
+
+	p, err := parsePushEvent(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := p.repositoryName()
+	repo, ok := s.repositories[strings.ToLower(name)]
+	secret := s.unknownSecret
+	if ok {
+		secret = repo.cfg.Secret
+	}
+	err = f.verify(r, body, secret)
+	if !ok && err == nil {
+		err = fmt.Errorf("unknown repository")
+	}
+	if err != nil {
+		log.Printf("%s: rejected %s push from %s: %s", name, f, r.RemoteAddr, err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if total, truncated := p.truncated(f); truncated {
+		pushed := "more than " + fmt.Sprint(len(p.Commits))
+		if total > 0 {
+			pushed = fmt.Sprint(total)
+		}
+		log.Printf("%s: push to %s had %s commits but only included %d, no changesets are created for the rest",
+			name, p.Ref, pushed, len(p.Commits))
+	}
+
+	cc := p.changesets()
+	if len(cc) > 0 {
+		err = repo.spool.Enqueue(cc...)
+		if err != nil {
+			log.Printf("%s: %s", name, err)
+			http.Error(w, "unable to queue changesets", http.StatusInternalServerError)
+			return
+		}
+		repo.notify()
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "queued %d changesets\n", len(cc))
+}
+
+func main() {
+	configPath := flag.String("config", "lhwebhook.yaml", "configuration file")
+	listen := flag.String("listen", "", "address to listen on (default from configuration file, or :8080)")
+	replay := flag.Bool("replay", false, "queue dead changesets again before starting")
+	flag.Parse()
+
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var store credentials.Store
+	if cfg.Credentials != nil {
+		store, err = credentials.New(cfg.Credentials)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	unknownSecret := make([]byte, 32)
+	_, err = rand.Read(unknownSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := &server{
+		repositories:  map[string]*repository{},
+		unknownSecret: hex.EncodeToString(unknownSecret),
+	}
+	for _, rc := range cfg.Repositories {
+		repo, err := newRepository(cfg, rc, store)
+		if err != nil {
+			log.Fatalf("%s: %s", rc.Name, err)
+		}
+		s.repositories[strings.ToLower(rc.Name)] = repo
+		// this is the only process draining the spool, so a
+		// lock can only have been left by a crash
+		repo.spool.Unlock()
+		if *replay {
+			n, err := repo.spool.Replay()
+			if err != nil {
+				log.Fatalf("%s: %s", rc.Name, err)
+			}
+			log.Printf("%s: queued %d dead changesets again", rc.Name, n)
+		}
+		go repo.run()
+		// post anything left queued by the last run
+		repo.notify()
+	}
+
+	addr := *listen
+	if len(addr) == 0 {
+		addr = cfg.Listen
+	}
+	if len(addr) == 0 {
+		addr = ":8080"
+	}
+
+	hs := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+	}
+
+	log.Printf("listening on %s", addr)
+	log.Fatal(hs.ListenAndServe())
+}
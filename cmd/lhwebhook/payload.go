@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/hooks"
+)
+
+var errBadSignature = errors.New("invalid or missing signature")
+
+// forge identifies the format of a webhook request.
+type forge string
+
+const (
+	github forge = "github"
+	gitlab forge = "gitlab"
+	gitea  forge = "gitea"
+)
+
+// detectForge returns the forge which sent r and the event it's
+// for.  Gitea also sends GitHub's headers, so it's checked first.
+func detectForge(r *http.Request) (forge, string, error) {
+	if event := r.Header.Get("X-Gitea-Event"); len(event) > 0 {
+		return gitea, event, nil
+	}
+	if event := r.Header.Get("X-Gitlab-Event"); len(event) > 0 {
+		return gitlab, event, nil
+	}
+	if event := r.Header.Get("X-GitHub-Event"); len(event) > 0 {
+		return github, event, nil
+	}
+	return "", "", errors.New("unknown webhook sender")
+}
+
+// isPush returns whether event is a push to a branch or tag.
+func (f forge) isPush(event string) bool {
+	switch f {
+	case gitlab:
+		return event == "Push Hook"
+	default:
+		return event == "push"
+	}
+}
+
+// verify checks the signature of body in r with secret.  GitHub and
+// Gitea sign the body with HMAC, GitLab sends the secret itself.
+func (f forge) verify(r *http.Request, body []byte, secret string) error {
+	var sig string
+	var newHash func() hash.Hash
+
+	switch f {
+	case gitea:
+		sig, newHash = r.Header.Get("X-Gitea-Signature"), sha256.New
+	case gitlab:
+		token := r.Header.Get("X-Gitlab-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return errBadSignature
+		}
+		return nil
+	case github:
+		if sig = r.Header.Get("X-Hub-Signature-256"); len(sig) > 0 {
+			sig, newHash = strings.TrimPrefix(sig, "sha256="), sha256.New
+		} else {
+			sig, newHash = strings.TrimPrefix(r.Header.Get("X-Hub-Signature"), "sha1="), sha1.New
+		}
+	}
+
+	want, err := hex.DecodeString(sig)
+	if err != nil || len(want) == 0 {
+		return errBadSignature
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), want) {
+		return errBadSignature
+	}
+	return nil
+}
+
+// pushEvent is a push event in the common subset of the GitHub, GitLab
+// and Gitea formats.
+type pushEvent struct {
+	Ref    string `json:"ref"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+
+	// GitHub and Gitea
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	// GitLab
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+
+	Commits []*pushCommit `json:"commits"`
+	// GitLab and Gitea send the number of pushed commits, which
+	// may be more than are included in Commits.
+	TotalCommitsCount int `json:"total_commits_count"`
+	TotalCommits      int `json:"total_commits"`
+}
+
+// githubMaxCommits is the number of commits included in a GitHub push
+// event, which doesn't say how many were pushed.
+const githubMaxCommits = 20
+
+type pushCommit struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+	URL       string    `json:"url"`
+	Author    struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Username string `json:"username"`
+	} `json:"author"`
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+func parsePushEvent(body []byte) (*pushEvent, error) {
+	p := &pushEvent{}
+	err := json.Unmarshal(body, p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// repositoryName returns the full name of the pushed repository.
+func (p *pushEvent) repositoryName() string {
+	if len(p.Repository.FullName) > 0 {
+		return p.Repository.FullName
+	}
+	return p.Project.PathWithNamespace
+}
+
+// truncated returns whether the push included more commits than are
+// in p.Commits and, if known, how many.  GitHub doesn't send the total,
+// so a push of exactly githubMaxCommits commits is reported as
+// possibly truncated with a total of 0.
+func (p *pushEvent) truncated(f forge) (int, bool) {
+	total := p.TotalCommitsCount
+	if p.TotalCommits > total {
+		total = p.TotalCommits
+	}
+	if total > len(p.Commits) {
+		return total, true
+	}
+	if f == github && len(p.Commits) >= githubMaxCommits {
+		return 0, true
+	}
+	return 0, false
+}
+
+// isZero returns whether rev is the all zeros revision forges send
+// for a ref which didn't exist before or after the push.
+func isZero(rev string) bool {
+	return len(rev) > 0 && strings.Count(rev, "0") == len(rev)
+}
+
+// changesets returns a changeset for each commit pushed to a branch,
+// oldest first.  Pushes of tags and deleted branches have none.
+func (p *pushEvent) changesets() []*hooks.Changeset {
+	if !strings.HasPrefix(p.Ref, "refs/heads/") || isZero(p.After) {
+		return nil
+	}
+	branch := strings.TrimPrefix(p.Ref, "refs/heads/")
+	change := "updated"
+	if isZero(p.Before) {
+		change = "created"
+	}
+
+	cc := []*hooks.Changeset{}
+
+	for _, pc := range p.Commits {
+		commit := &hooks.Commit{
+			Revision: pc.ID,
+			Author:   pc.Author.Name,
+			Email:    pc.Author.Email,
+			Date:     pc.Timestamp,
+			Branch:   branch,
+			Log:      pc.Message,
+			Changes:  changesets.Changes{},
+		}
+		for _, ch := range []struct {
+			op    string
+			paths []string
+		}{
+			{"A", pc.Added},
+			{"M", pc.Modified},
+			{"D", pc.Removed},
+		} {
+			for _, path := range ch.paths {
+				commit.Changes = append(commit.Changes, &changesets.Change{
+					Operation: ch.op,
+					Path:      path,
+				})
+			}
+		}
+
+		title := fmt.Sprintf("%s committed changeset [%s] which %s branch %s", commit.Author, commit.Revision, change, branch)
+		body := fmt.Sprintf("%s branch %s:\n\n%s", strings.Title(change), branch, strings.TrimSpace(commit.Log))
+		link := ""
+		if len(pc.URL) > 0 {
+			link = fmt.Sprintf("[View commit](%s)", pc.URL)
+			body += "\n\n" + link
+		}
+
+		c := hooks.NewChangeset(commit, title, body, link)
+		cc = append(cc, c)
+	}
+
+	return cc
+}
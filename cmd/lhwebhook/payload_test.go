@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sign(newHash func() hash.Hash, secret, body string) string {
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestForgeVerify(t *testing.T) {
+	const (
+		secret = "s3cret"
+		body   = `{"ref":"refs/heads/main"}`
+	)
+
+	tests := []struct {
+		name    string
+		forge   forge
+		headers map[string]string
+		body    string
+		ok      bool
+	}{
+		{
+			name:    "github sha256",
+			forge:   github,
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sign(sha256.New, secret, body)},
+			ok:      true,
+		},
+		{
+			name:    "github sha1",
+			forge:   github,
+			headers: map[string]string{"X-Hub-Signature": "sha1=" + sign(sha1.New, secret, body)},
+			ok:      true,
+		},
+		{
+			name:  "github sha256 preferred over sha1",
+			forge: github,
+			headers: map[string]string{
+				"X-Hub-Signature-256": "sha256=" + sign(sha256.New, "wrong", body),
+				"X-Hub-Signature":     "sha1=" + sign(sha1.New, secret, body),
+			},
+		},
+		{
+			name:    "github wrong secret",
+			forge:   github,
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sign(sha256.New, "wrong", body)},
+		},
+		{
+			name:    "github modified body",
+			forge:   github,
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sign(sha256.New, secret, body)},
+			body:    `{"ref":"refs/heads/evil"}`,
+		},
+		{
+			name:    "github sha1 signature as sha256",
+			forge:   github,
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sign(sha1.New, secret, body)},
+		},
+		{
+			name:    "github not hex",
+			forge:   github,
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=zz"},
+		},
+		{
+			name:  "github missing",
+			forge: github,
+		},
+		{
+			name:    "gitea",
+			forge:   gitea,
+			headers: map[string]string{"X-Gitea-Signature": sign(sha256.New, secret, body)},
+			ok:      true,
+		},
+		{
+			name:    "gitea wrong secret",
+			forge:   gitea,
+			headers: map[string]string{"X-Gitea-Signature": sign(sha256.New, "wrong", body)},
+		},
+		{
+			name:    "gitea github header ignored",
+			forge:   gitea,
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sign(sha256.New, secret, body)},
+		},
+		{
+			name:    "gitlab",
+			forge:   gitlab,
+			headers: map[string]string{"X-Gitlab-Token": secret},
+			ok:      true,
+		},
+		{
+			name:    "gitlab wrong token",
+			forge:   gitlab,
+			headers: map[string]string{"X-Gitlab-Token": "wrong"},
+		},
+		{
+			name:  "gitlab missing",
+			forge: gitlab,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := body
+			if len(tt.body) > 0 {
+				payload = tt.body
+			}
+			r := httptest.NewRequest("POST", "/", strings.NewReader(payload))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			err := tt.forge.verify(r, []byte(payload), secret)
+			if tt.ok && err != nil {
+				t.Errorf("verify() = %v, want nil", err)
+			}
+			if !tt.ok && err != errBadSignature {
+				t.Errorf("verify() = %v, want %v", err, errBadSignature)
+			}
+		})
+	}
+}
+
+func TestPushEventTruncated(t *testing.T) {
+	commits := func(n int) []*pushCommit {
+		return make([]*pushCommit, n)
+	}
+
+	tests := []struct {
+		name      string
+		forge     forge
+		p         *pushEvent
+		total     int
+		truncated bool
+	}{
+		{"gitlab complete", gitlab, &pushEvent{Commits: commits(3), TotalCommitsCount: 3}, 0, false},
+		{"gitlab truncated", gitlab, &pushEvent{Commits: commits(20), TotalCommitsCount: 30}, 30, true},
+		{"gitea truncated", gitea, &pushEvent{Commits: commits(5), TotalCommits: 8}, 8, true},
+		{"github complete", github, &pushEvent{Commits: commits(19)}, 0, false},
+		{"github maybe truncated", github, &pushEvent{Commits: commits(githubMaxCommits)}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, truncated := tt.p.truncated(tt.forge)
+			if total != tt.total || truncated != tt.truncated {
+				t.Errorf("truncated(%s) = %d, %t, want %d, %t", tt.forge, total, truncated, tt.total, tt.truncated)
+			}
+		})
+	}
+}
@@ -5,17 +5,12 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"time"
 
-	"github.com/nwidger/lighthouse"
-	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/credentials"
+	"github.com/nwidger/lighthouse/hooks"
 )
 
 func getAccountAndProject(repoPath string) (string, int, error) {
@@ -23,130 +18,106 @@ func getAccountAndProject(repoPath string) (string, int, error) {
 	if err != nil {
 		return "", 0, err
 	}
-
-	url, err := url.Parse(strings.TrimSpace(string(buf)))
-	if err != nil {
-		return "", 0, err
-	}
-
-	idx := strings.Index(url.Host, ".lighthouseapp.com")
-	if idx == -1 {
-		return "", 0, fmt.Errorf("unable to determine account name %q", url.String())
-	}
-
-	account := url.Host[:idx]
-	if len(account) == 0 {
-		return "", 0, fmt.Errorf("empty account name %q", url.String())
-	}
-
-	idx = strings.LastIndex(url.Path, "/")
-	if idx == -1 {
-		return "", 0, fmt.Errorf("unable to determine project ID %q", url.Path)
-	}
-
-	projectStr := url.Path[idx+1:]
-	projectID, err := strconv.Atoi(projectStr)
-	if err != nil {
-		return "", 0, fmt.Errorf("unable to parse project ID %q", projectStr)
-	}
-
-	return account, projectID, nil
+	return hooks.ParseProjectURL(string(buf))
 }
 
-func getToken(repoPath, commitAuthor string) (string, error) {
-	buf, err := ioutil.ReadFile(filepath.Join(repoPath, ".lhkeys"))
+// getCredentialStore returns the credential store configured in the
+// file .lhcredentials, or nil if the file does not exist.  Each line
+// of the file is a setting name followed by its value, for example:
+//
+//	store gpg
+//	file /srv/svn/lighthouse-credentials.gpg
+//	recipient svn@example.com
+func getCredentialStore(repoPath string) (credentials.Store, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(repoPath, ".lhcredentials"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	token := ""
+	c := &credentials.Config{}
 
 	for _, line := range strings.Split(string(buf), "\n") {
-		f := strings.Fields(strings.TrimSpace(line))
-		if len(f) != 2 {
-			return "", fmt.Errorf("invalid line %q", line)
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
 		}
-
-		lineAuthor, lineToken := f[0], f[1]
-		if lineAuthor == commitAuthor {
-			token = lineToken
-			break
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		name, value := f[0], strings.TrimSpace(line[len(f[0]):])
+		switch name {
+		case "store":
+			c.Store = value
+		case "file":
+			c.File = value
+		case "recipient":
+			c.Recipients = append(c.Recipients, value)
+		case "identity":
+			c.Identity = value
+		case "helper":
+			c.Helper = value
+		default:
+			return nil, fmt.Errorf("invalid setting %q", name)
 		}
 	}
 
-	if len(token) == 0 {
-		return "", fmt.Errorf("unable to find token for %q", commitAuthor)
-	}
-
-	return token, nil
+	return credentials.New(c)
 }
 
-func runSVNLook(args ...string) string {
-	cmd := exec.Command("svnlook", args...)
-
-	output, err := cmd.Output()
-	if err != nil {
-		log.Fatal("svnlook", args, ":", err)
-	}
-
-	return string(output)
-}
+// getKeys returns a function looking up tokens in the file .lhkeys,
+// each line of which is an author followed by their token.
+func getKeys(repoPath string) func(string) (string, error) {
+	return func(commitAuthor string) (string, error) {
+		buf, err := ioutil.ReadFile(filepath.Join(repoPath, ".lhkeys"))
+		if os.IsNotExist(err) {
+			return "", hooks.ErrNoToken
+		}
+		if err != nil {
+			return "", err
+		}
 
-func createChangeset(repoPath, revision, commitAuthor string) (*changesets.Changeset, error) {
-	commitLog := runSVNLook("log", repoPath, "-r", revision)
-	commitDate := runSVNLook("date", repoPath, "-r", revision)
-	commitChanged := runSVNLook("changed", repoPath, "-r", revision)
+		for _, line := range strings.Split(string(buf), "\n") {
+			f := strings.Fields(strings.TrimSpace(line))
+			if len(f) == 0 {
+				continue
+			}
+			if len(f) != 2 {
+				return "", fmt.Errorf("invalid line %q", line)
+			}
+
+			lineAuthor, lineToken := f[0], f[1]
+			if lineAuthor == commitAuthor {
+				return lineToken, nil
+			}
+		}
 
-	ss := strings.Split(commitDate, "(")
-	if len(ss) == 0 {
-		return nil, fmt.Errorf("unable to determine commit date %q", commitDate)
-	}
-	commitTime, err := time.Parse("2006-01-02 15:04:05 -0700", strings.TrimSpace(ss[0]))
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse commit date %q", commitDate)
+		return "", hooks.ErrNoToken
 	}
+}
 
+func createChangeset(repoPath string, c *hooks.Commit) (*hooks.Changeset, error) {
 	base := strings.TrimSpace(filepath.Base(repoPath))
 	if len(base) == 0 {
 		return nil, fmt.Errorf("base of %s is empty", repoPath)
 	}
+	link := viewVCLink(base, c.Revision)
 
-	title := fmt.Sprintf("%s committed changeset [%s]", commitAuthor, revision)
+	title := fmt.Sprintf("%s committed changeset [%s]", c.Author, c.Revision)
 	body := fmt.Sprintf(`Commit log:
 
 %s
 
-[ViewVC](http://example.com/viewvc/%s?view=rev&amp;revision=%s)`, commitLog, base, revision)
-
-	c := &changesets.Changeset{
-		Title:     title,
-		Body:      body,
-		Revision:  revision,
-		ChangedAt: &commitTime,
-		Changes:   changesets.Changes{},
-	}
+%s`, c.Log, link)
 
-	for _, line := range strings.Split(commitChanged, "\n") {
-		if len(line) == 0 {
-			continue
-		}
-		idx := strings.IndexAny(line, " \t\f")
-		if idx == -1 {
-			continue
-		}
-		op, field := strings.TrimSpace(line[:idx]),
-			strings.TrimSpace(line[idx:])
-		if len(op) == 0 || len(field) == 0 {
-			continue
-		}
-		c.Changes = append(c.Changes, &changesets.Change{
-			Operation: op,
-			Path:      field,
-		})
-
-	}
+	return hooks.NewChangeset(c, title, body, link), nil
+}
 
-	return c, nil
+func viewVCLink(base, revision string) string {
+	return fmt.Sprintf("[ViewVC](http://example.com/viewvc/%s?view=rev&amp;revision=%s)", base, revision)
 }
 
 func gatherAndPost(repoPath, revision string) error {
@@ -155,34 +126,29 @@ func gatherAndPost(repoPath, revision string) error {
 		return err
 	}
 
-	commitAuthor := strings.TrimSpace(runSVNLook("author", repoPath, "-r", revision))
-
-	token, err := getToken(repoPath, commitAuthor)
+	store, err := getCredentialStore(repoPath)
 	if err != nil {
 		return err
 	}
 
-	c, err := createChangeset(repoPath, revision, commitAuthor)
+	commit, err := (&hooks.SVN{Path: repoPath}).Commit(revision)
 	if err != nil {
 		return err
 	}
 
-	client := &http.Client{
-		Transport: &lighthouse.Transport{
-			Token:            token,
-			TokenAsBasicAuth: true,
-		},
-	}
-
-	s := lighthouse.NewService(account, client)
-	cs := changesets.NewService(s, projectID)
-
-	c, err = cs.Create(c)
+	c, err := createChangeset(repoPath, commit)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	poster := hooks.NewPoster(&hooks.Config{
+		Account:   account,
+		ProjectID: projectID,
+		Store:     store,
+		Keys:      getKeys(repoPath),
+	})
+
+	return poster.Post(c)
 }
 
 func main() {
@@ -0,0 +1,117 @@
+// Package credentials provides pluggable storage for Lighthouse API
+// tokens so they don't have to be kept in plaintext config files.
+//
+// Tokens are stored per Lighthouse account and user.  The user may be
+// empty for an account's default token, as used by lh, or a name such
+// as a commit author, as used by the commit hooks.
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotFound is returned by Store.Get if no token is stored.
+var ErrNotFound = errors.New("credentials: token not found")
+
+// Store stores Lighthouse API tokens.
+type Store interface {
+	// Get returns the token for user in account, or ErrNotFound.
+	Get(account, user string) (string, error)
+	// Set stores the token for user in account, replacing any
+	// existing token.
+	Set(account, user, token string) error
+	// Delete removes the token for user in account.  Deleting a
+	// token which isn't stored is not an error.
+	Delete(account, user string) error
+}
+
+// Config selects and configures a Store.
+type Config struct {
+	// Store is one of keyring, gpg, age or helper.
+	Store string
+	// File is the encrypted file used by the gpg and age stores.
+	File string
+	// Recipients are the GPG key IDs or age recipients the file
+	// is encrypted to.  GPG defaults to the user's own key.
+	Recipients []string
+	// Identity is the age identity file used to decrypt the file.
+	Identity string
+	// Helper is the credential helper command used by the helper
+	// store, see Helper.
+	Helper string
+}
+
+// New returns the Store selected by c.
+func New(c *Config) (Store, error) {
+	switch c.Store {
+	case "keyring":
+		return NewKeyring(), nil
+	case "gpg", "age":
+		if len(c.File) == 0 {
+			return nil, fmt.Errorf("credentials: %s store requires a file", c.Store)
+		}
+		return &EncryptedFile{
+			Path:       c.File,
+			Encryption: c.Store,
+			Recipients: c.Recipients,
+			Identity:   c.Identity,
+		}, nil
+	case "helper":
+		if len(c.Helper) == 0 {
+			return nil, fmt.Errorf("credentials: helper store requires a helper command")
+		}
+		return &Helper{Command: c.Helper}, nil
+	case "":
+		return nil, fmt.Errorf("credentials: no store configured")
+	}
+	return nil, fmt.Errorf("credentials: unknown store %q, must be one of keyring, gpg, age or helper", c.Store)
+}
+
+// commandError is returned by run if a program fails.
+type commandError struct {
+	name   string
+	err    error
+	stderr string
+}
+
+func (e *commandError) Error() string {
+	if len(e.stderr) > 0 {
+		return fmt.Sprintf("%s: %v: %s", e.name, e.err, e.stderr)
+	}
+	return fmt.Sprintf("%s: %v", e.name, e.err)
+}
+
+// exitCode returns the exit code of the failed program, or -1 if it
+// couldn't be run.
+func exitCode(err error) int {
+	if ce, ok := err.(*commandError); ok {
+		if ee, ok := ce.err.(*exec.ExitError); ok {
+			return ee.ExitCode()
+		}
+	}
+	return -1
+}
+
+// run runs the named program with stdin as its input, returning its
+// output.  The program's error output is included in any error.
+func run(stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return output, &commandError{
+			name:   name,
+			err:    err,
+			stderr: strings.TrimSpace(stderr.String()),
+		}
+	}
+	return output, nil
+}
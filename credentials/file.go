@@ -0,0 +1,153 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// EncryptedFile stores tokens in a JSON file encrypted with gpg or
+// age.  The file maps account names to user names to tokens.  The gpg
+// or age program must be installed, and for gpg, gpg-agent is used to
+// unlock the secret key.
+type EncryptedFile struct {
+	// Path is the encrypted file.
+	Path string
+	// Encryption is either gpg or age.
+	Encryption string
+	// Recipients are the GPG key IDs or age recipients the file
+	// is encrypted to.  GPG defaults to the user's own key.  age
+	// requires at least one recipient.
+	Recipients []string
+	// Identity is the age identity file used to decrypt the file.
+	Identity string
+
+	mu sync.Mutex
+}
+
+type fileTokens map[string]map[string]string
+
+func (f *EncryptedFile) read() (fileTokens, error) {
+	tokens := fileTokens{}
+
+	if _, err := os.Stat(f.Path); os.IsNotExist(err) {
+		return tokens, nil
+	}
+
+	var buf []byte
+	var err error
+	switch f.Encryption {
+	case "gpg":
+		buf, err = run(nil, "gpg", "--batch", "--quiet", "--decrypt", f.Path)
+	case "age":
+		if len(f.Identity) == 0 {
+			return nil, fmt.Errorf("credentials: age requires an identity file to decrypt %s", f.Path)
+		}
+		buf, err = run(nil, "age", "--decrypt", "--identity", f.Identity, f.Path)
+	default:
+		return nil, fmt.Errorf("credentials: unknown encryption %q, must be gpg or age", f.Encryption)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(buf, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: %s: %v", f.Path, err)
+	}
+
+	return tokens, nil
+}
+
+func (f *EncryptedFile) write(tokens fileTokens) error {
+	buf, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(f.Path), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Path + ".tmp"
+	args := []string{}
+	switch f.Encryption {
+	case "gpg":
+		args = append(args, "--batch", "--quiet", "--yes", "--encrypt", "--output", tmp)
+		if len(f.Recipients) == 0 {
+			args = append(args, "--default-recipient-self")
+		}
+		for _, r := range f.Recipients {
+			args = append(args, "--recipient", r)
+		}
+	case "age":
+		if len(f.Recipients) == 0 {
+			return fmt.Errorf("credentials: age requires at least one recipient to encrypt %s", f.Path)
+		}
+		args = append(args, "--encrypt", "--output", tmp)
+		for _, r := range f.Recipients {
+			args = append(args, "--recipient", r)
+		}
+	default:
+		return fmt.Errorf("credentials: unknown encryption %q, must be gpg or age", f.Encryption)
+	}
+
+	_, err = run(buf, f.Encryption, args...)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, f.Path)
+}
+
+func (f *EncryptedFile) Get(account, user string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tokens, err := f.read()
+	if err != nil {
+		return "", err
+	}
+	token, ok := tokens[account][user]
+	if !ok || len(token) == 0 {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+func (f *EncryptedFile) Set(account, user, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tokens, err := f.read()
+	if err != nil {
+		return err
+	}
+	if tokens[account] == nil {
+		tokens[account] = map[string]string{}
+	}
+	tokens[account][user] = token
+	return f.write(tokens)
+}
+
+func (f *EncryptedFile) Delete(account, user string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tokens, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := tokens[account][user]; !ok {
+		return nil
+	}
+	delete(tokens[account], user)
+	if len(tokens[account]) == 0 {
+		delete(tokens, account)
+	}
+	return f.write(tokens)
+}
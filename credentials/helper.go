@@ -0,0 +1,92 @@
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Helper stores tokens using an external credential helper speaking
+// git's credential helper protocol, see
+// https://git-scm.com/docs/gitcredentials.  Git's own helpers such as
+// osxkeychain, libsecret, manager, store and cache can therefore be
+// used.  The helper is given protocol=https, host=ACCOUNT.lighthouseapp.com
+// and username=USER and the token is the password.
+type Helper struct {
+	// Command is interpreted as git does: if it starts with !, it
+	// is run by the shell; if it is an absolute path, it is run
+	// directly; otherwise git credential-COMMAND is run.
+	Command string
+}
+
+func (h *Helper) run(action string, attrs map[string]string) (map[string]string, error) {
+	input := &bytes.Buffer{}
+	for _, key := range []string{"protocol", "host", "username", "password"} {
+		if value, ok := attrs[key]; ok && len(value) > 0 {
+			fmt.Fprintf(input, "%s=%s\n", key, value)
+		}
+	}
+	fmt.Fprintln(input)
+
+	var output []byte
+	var err error
+	switch {
+	case strings.HasPrefix(h.Command, "!"):
+		output, err = run(input.Bytes(), "sh", "-c", h.Command[1:]+` "$@"`, h.Command[1:], action)
+	case filepath.IsAbs(h.Command):
+		fields := strings.Fields(h.Command)
+		output, err = run(input.Bytes(), fields[0], append(fields[1:], action)...)
+	default:
+		fields := strings.Fields(h.Command)
+		args := append([]string{"credential-" + fields[0]}, fields[1:]...)
+		output, err = run(input.Bytes(), "git", append(args, action)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "="); idx != -1 {
+			result[line[:idx]] = line[idx+1:]
+		}
+	}
+
+	return result, scanner.Err()
+}
+
+func helperAttributes(account, user string) map[string]string {
+	return map[string]string{
+		"protocol": "https",
+		"host":     account + ".lighthouseapp.com",
+		"username": user,
+	}
+}
+
+func (h *Helper) Get(account, user string) (string, error) {
+	result, err := h.run("get", helperAttributes(account, user))
+	if err != nil {
+		return "", err
+	}
+	token := result["password"]
+	if len(token) == 0 {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+func (h *Helper) Set(account, user, token string) error {
+	attrs := helperAttributes(account, user)
+	attrs["password"] = token
+	_, err := h.run("store", attrs)
+	return err
+}
+
+func (h *Helper) Delete(account, user string) error {
+	_, err := h.run("erase", helperAttributes(account, user))
+	return err
+}
@@ -0,0 +1,130 @@
+package credentials
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Keyring stores tokens in the operating system's keyring: the
+// Secret Service (GNOME Keyring, KWallet) via secret-tool on Linux and
+// other Unix systems, or the login keychain via security on macOS.
+type Keyring struct {
+	// Service is the service name tokens are stored under.
+	Service string
+}
+
+// NewKeyring returns a Keyring using the service name lighthouse.
+func NewKeyring() *Keyring {
+	return &Keyring{
+		Service: "lighthouse",
+	}
+}
+
+// errSecItemNotFound is the exit code of the macOS security command
+// when no matching keychain item is found.
+const errSecItemNotFound = 44
+
+// keychainAccount is the macOS keychain account name for user in
+// account.
+func keychainAccount(account, user string) string {
+	return account + "/" + user
+}
+
+func (k *Keyring) secretToolAttributes(account, user string) []string {
+	return []string{"service", k.Service, "account", account, "user", user}
+}
+
+func (k *Keyring) Get(account, user string) (string, error) {
+	var output []byte
+	var err error
+	var notFound func(err error) bool
+
+	switch runtime.GOOS {
+	case "darwin":
+		output, err = run(nil, "security", "find-generic-password",
+			"-s", k.Service, "-a", keychainAccount(account, user), "-w")
+		notFound = func(err error) bool {
+			return exitCode(err) == errSecItemNotFound
+		}
+	case "windows", "plan9":
+		return "", fmt.Errorf("credentials: keyring is not supported on %s", runtime.GOOS)
+	default:
+		output, err = run(nil, "secret-tool", append([]string{"lookup"},
+			k.secretToolAttributes(account, user)...)...)
+		notFound = func(err error) bool {
+			// secret-tool exits with 1 and no output
+			return exitCode(err) == 1
+		}
+	}
+
+	token := strings.TrimSpace(string(output))
+	if err != nil {
+		if notFound(err) && len(token) == 0 {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	if len(token) == 0 {
+		return "", ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (k *Keyring) Set(account, user, token string) error {
+	var err error
+
+	switch runtime.GOOS {
+	case "darwin":
+		// the command is read from stdin by 'security -i' so
+		// the token isn't in argv, visible to other users in ps
+		command := strings.Join([]string{"add-generic-password", "-U",
+			"-s", securityQuote(k.Service), "-a", securityQuote(keychainAccount(account, user)),
+			"-l", securityQuote(fmt.Sprintf("Lighthouse token for %s", keychainAccount(account, user))),
+			"-w", securityQuote(token)}, " ")
+		_, err = run([]byte(command+"\n"), "security", "-i")
+		if err != nil {
+			return err
+		}
+		// 'security -i' reports a failed command on stderr but
+		// may still exit with 0, so check the token was stored
+		var stored string
+		stored, err = k.Get(account, user)
+		if err == nil && stored != token {
+			err = fmt.Errorf("credentials: token was not stored in the keychain")
+		}
+	case "windows", "plan9":
+		return fmt.Errorf("credentials: keyring is not supported on %s", runtime.GOOS)
+	default:
+		label := fmt.Sprintf("Lighthouse token for %s/%s", account, user)
+		_, err = run([]byte(token), "secret-tool", append([]string{"store", "--label", label},
+			k.secretToolAttributes(account, user)...)...)
+	}
+
+	return err
+}
+
+func (k *Keyring) Delete(account, user string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		_, err := run(nil, "security", "delete-generic-password",
+			"-s", k.Service, "-a", keychainAccount(account, user))
+		if exitCode(err) == errSecItemNotFound {
+			return nil
+		}
+		return err
+	case "windows", "plan9":
+		return fmt.Errorf("credentials: keyring is not supported on %s", runtime.GOOS)
+	default:
+		_, err := run(nil, "secret-tool", append([]string{"clear"},
+			k.secretToolAttributes(account, user)...)...)
+		return err
+	}
+}
+
+// securityQuote quotes s as an argument of a command read by
+// 'security -i'.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -4,9 +4,13 @@ go 1.12
 
 require (
 	github.com/fatih/color v1.7.0 // indirect
+	github.com/gdamore/tcell v1.4.0
 	github.com/mattn/go-colorable v0.1.2 // indirect
+	github.com/mattn/go-runewidth v0.0.7
+	github.com/mattn/go-sqlite3 v1.11.0
 	github.com/nwidger/jsoncolor v0.0.0-20170215171346-75a6de4340e5
-	github.com/spf13/cobra v0.0.4
+	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.4.0
 	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
+	gopkg.in/yaml.v2 v2.2.2
 )
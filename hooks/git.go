@@ -0,0 +1,151 @@
+package hooks
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+// gitLogFormat separates commits with a record separator and their
+// fields with NULs.  The diff output follows the last NUL.
+const gitLogFormat = "--format=%x1e%H%x00%P%x00%an%x00%ae%x00%at%x00%B%x00"
+
+// numStatRE matches the lines printed by --numstat.
+var numStatRE = regexp.MustCompile(`^(\d+|-)\t(\d+|-)\t`)
+
+// Git is a git repository.
+type Git struct {
+	// Dir is the repository's directory.  If empty, the current
+	// directory is used, as when running as a git hook.
+	Dir string
+}
+
+// Run runs git with args in the repository and returns its output.
+func (g *Git) Run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.Dir
+	output, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		err = fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(ee.Stderr)))
+	}
+	return string(output), err
+}
+
+// Commits reads all of the commits with a single 'git log', plus a
+// 'git diff' for each merge.
+func (g *Git) Commits(from, to string) ([]*Commit, error) {
+	revSpec := to
+	if len(from) > 0 {
+		revSpec = from + ".." + to
+	}
+	return g.log(revSpec)
+}
+
+// Commit reads a single commit with 'git log -1'.
+func (g *Git) Commit(revision string) (*Commit, error) {
+	cc, err := g.log("-1", revision)
+	if err != nil {
+		return nil, err
+	}
+	if len(cc) == 0 {
+		return nil, fmt.Errorf("no such revision %q", revision)
+	}
+	return cc[0], nil
+}
+
+// gitDiffArgs are the options of the diff output parsed by
+// parseGitDiff.
+var gitDiffArgs = []string{"--no-renames", "--raw", "--numstat", "--stat"}
+
+func (g *Git) log(args ...string) ([]*Commit, error) {
+	args = append(append([]string{"log", "--reverse", gitLogFormat}, gitDiffArgs...), args...)
+	output, err := g.Run(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := []*Commit{}
+
+	for _, record := range strings.Split(output, "\x1e") {
+		if len(strings.TrimSpace(record)) == 0 {
+			continue
+		}
+		fields := strings.SplitN(record, "\x00", 7)
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("unable to parse git log output %q", record)
+		}
+
+		sec, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &Commit{
+			Revision: fields[0],
+			Parents:  strings.Fields(fields[1]),
+			Author:   fields[2],
+			Email:    fields[3],
+			Date:     time.Unix(sec, 0),
+			Log:      fields[5],
+			Changes:  changesets.Changes{},
+		}
+
+		// 'git log' prints no diff for merges, so diff them
+		// against their first parent like 'git diff rev^ rev'
+		diff := fields[6]
+		if len(c.Parents) > 1 {
+			args := append(append([]string{"diff"}, gitDiffArgs...), c.Parents[0], c.Revision)
+			diff, err = g.Run(args...)
+			if err != nil {
+				return nil, err
+			}
+		}
+		parseGitDiff(c, diff)
+
+		cc = append(cc, c)
+	}
+
+	return cc, nil
+}
+
+// parseGitDiff sets c's changes, stats and diffstat from diff output
+// printed with gitDiffArgs.
+func parseGitDiff(c *Commit, diff string) {
+	stat := []string{}
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case len(strings.TrimSpace(line)) == 0:
+		case strings.HasPrefix(line, ":"):
+			// ':100644 100644 7898192 422c2b7 M\tpath'
+			idx := strings.Index(line, "\t")
+			if idx == -1 {
+				continue
+			}
+			meta := strings.Fields(line[:idx])
+			c.Changes = append(c.Changes, &changesets.Change{
+				Operation: meta[len(meta)-1],
+				Path:      line[idx+1:],
+			})
+		case numStatRE.MatchString(line):
+			// '12\t4\tpath', or '-\t-\tpath' if binary
+			f := strings.SplitN(line, "\t", 3)
+			additions, _ := strconv.Atoi(f[0])
+			deletions, _ := strconv.Atoi(f[1])
+			c.Stats = append(c.Stats, &changesets.FileStat{
+				Path:      f[2],
+				Additions: additions,
+				Deletions: deletions,
+			})
+		default:
+			stat = append(stat, line)
+		}
+	}
+	if len(stat) > 0 {
+		c.DiffStat = strings.Join(stat, "\n") + "\n"
+	}
+}
@@ -0,0 +1,215 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+func TestParseGitDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		diff     string
+		changes  changesets.Changes
+		stats    changesets.FileStats
+		diffStat string
+	}{
+		{
+			name:    "empty",
+			diff:    "\n",
+			changes: changesets.Changes{},
+		},
+		{
+			name: "changes",
+			diff: "\n" +
+				":000000 100644 0000000 7898192 A\tnew.go\n" +
+				":100644 100644 7898192 422c2b7 M\tpath with spaces/main.go\n" +
+				":100644 000000 422c2b7 0000000 D\told.go\n" +
+				"3\t0\tnew.go\n" +
+				"12\t4\tpath with spaces/main.go\n" +
+				"0\t7\told.go\n" +
+				" new.go                   |  3 +++\n" +
+				" path with spaces/main.go | 16 ++++++++++++----\n" +
+				" old.go                   |  7 -------\n" +
+				" 3 files changed, 15 insertions(+), 11 deletions(-)\n",
+			changes: changesets.Changes{
+				{Operation: "A", Path: "new.go"},
+				{Operation: "M", Path: "path with spaces/main.go"},
+				{Operation: "D", Path: "old.go"},
+			},
+			stats: changesets.FileStats{
+				{Path: "new.go", Additions: 3},
+				{Path: "path with spaces/main.go", Additions: 12, Deletions: 4},
+				{Path: "old.go", Deletions: 7},
+			},
+			diffStat: " new.go                   |  3 +++\n" +
+				" path with spaces/main.go | 16 ++++++++++++----\n" +
+				" old.go                   |  7 -------\n" +
+				" 3 files changed, 15 insertions(+), 11 deletions(-)\n",
+		},
+		{
+			name: "binary",
+			diff: ":100644 100644 1111111 2222222 M\tlogo.png\n" +
+				"-\t-\tlogo.png\n" +
+				" logo.png | Bin 100 -> 200 bytes\n" +
+				" 1 file changed, 0 insertions(+), 0 deletions(-)\n",
+			changes:  changesets.Changes{{Operation: "M", Path: "logo.png"}},
+			stats:    changesets.FileStats{{Path: "logo.png"}},
+			diffStat: " logo.png | Bin 100 -> 200 bytes\n 1 file changed, 0 insertions(+), 0 deletions(-)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Commit{Changes: changesets.Changes{}}
+			parseGitDiff(c, tt.diff)
+			if !reflect.DeepEqual(c.Changes, tt.changes) {
+				t.Errorf("Changes = %s, want %s", formatChanges(c.Changes), formatChanges(tt.changes))
+			}
+			if !reflect.DeepEqual(c.Stats, tt.stats) {
+				t.Errorf("Stats = %q, want %q", formatFileStats(c.Stats), formatFileStats(tt.stats))
+			}
+			if c.DiffStat != tt.diffStat {
+				t.Errorf("DiffStat = %q, want %q", c.DiffStat, tt.diffStat)
+			}
+		})
+	}
+}
+
+func TestGitCommits(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	g := &Git{Dir: t.TempDir()}
+	git := func(args ...string) string {
+		t.Helper()
+		args = append([]string{"-c", "user.name=Alice", "-c", "user.email=alice@example.com", "-c", "commit.gpgsign=false"}, args...)
+		output, err := g.Run(args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(output)
+	}
+	write := func(name, content string) {
+		t.Helper()
+		err := ioutil.WriteFile(filepath.Join(g.Dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q", "-b", "main")
+	write("a.txt", "one\n")
+	git("add", "a.txt")
+	git("commit", "-q", "-m", "Add a")
+	root := git("rev-parse", "HEAD")
+
+	git("checkout", "-q", "-b", "feature")
+	write("b.txt", "one\ntwo\n")
+	git("add", "b.txt")
+	git("commit", "-q", "-m", "Add b [#3]")
+	feature := git("rev-parse", "HEAD")
+
+	git("checkout", "-q", "main")
+	write("a.txt", "uno\n")
+	git("commit", "-q", "-a", "-m", "Change a")
+	change := git("rev-parse", "HEAD")
+
+	git("merge", "-q", "--no-ff", "-m", "Merge feature", "feature")
+	merge := git("rev-parse", "HEAD")
+
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		parents [][]string
+		logs    []string
+		changes [][]string
+		stats   [][]string
+	}{
+		{
+			name:    "all",
+			to:      merge,
+			parents: [][]string{{}, {root}, {root}, {change, feature}},
+			logs:    []string{"Add a\n", "Add b [#3]\n", "Change a\n", "Merge feature\n"},
+			changes: [][]string{{"A a.txt"}, {"A b.txt"}, {"M a.txt"}, {"A b.txt"}},
+			stats:   [][]string{{"a.txt +1 -0"}, {"b.txt +2 -0"}, {"a.txt +1 -1"}, {"b.txt +2 -0"}},
+		},
+		{
+			name:    "range",
+			from:    change,
+			to:      merge,
+			parents: [][]string{{root}, {change, feature}},
+			logs:    []string{"Add b [#3]\n", "Merge feature\n"},
+			changes: [][]string{{"A b.txt"}, {"A b.txt"}},
+			stats:   [][]string{{"b.txt +2 -0"}, {"b.txt +2 -0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc, err := g.Commits(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cc) != len(tt.logs) {
+				t.Fatalf("got %d commits, want %d", len(cc), len(tt.logs))
+			}
+			for i, c := range cc {
+				if c.Author != "Alice" || c.Email != "alice@example.com" {
+					t.Errorf("commit %d: author %q <%s>", i, c.Author, c.Email)
+				}
+				if !reflect.DeepEqual(c.Parents, tt.parents[i]) {
+					t.Errorf("commit %d: Parents = %q, want %q", i, c.Parents, tt.parents[i])
+				}
+				if c.Log != tt.logs[i] {
+					t.Errorf("commit %d: Log = %q, want %q", i, c.Log, tt.logs[i])
+				}
+				if got := formatChanges(c.Changes); !reflect.DeepEqual(got, tt.changes[i]) {
+					t.Errorf("commit %d: Changes = %q, want %q", i, got, tt.changes[i])
+				}
+				if got := formatFileStats(c.Stats); !reflect.DeepEqual(got, tt.stats[i]) {
+					t.Errorf("commit %d: Stats = %q, want %q", i, got, tt.stats[i])
+				}
+				if len(c.DiffStat) == 0 {
+					t.Errorf("commit %d: no DiffStat", i)
+				}
+			}
+		})
+	}
+
+	c, err := g.Commit(feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Revision != feature {
+		t.Errorf("Commit(%q) = %q", feature, c.Revision)
+	}
+}
+
+// formatChanges returns changes as 'operation path' for comparisons and
+// error messages.
+func formatChanges(changes changesets.Changes) []string {
+	ss := []string{}
+	for _, ch := range changes {
+		ss = append(ss, ch.Operation+" "+ch.Path)
+	}
+	return ss
+}
+
+// formatFileStats returns stats as 'path +additions -deletions' for
+// comparisons and error messages.
+func formatFileStats(stats changesets.FileStats) []string {
+	ss := []string{}
+	for _, st := range stats {
+		ss = append(ss, st.Path+" +"+strconv.Itoa(st.Additions)+" -"+strconv.Itoa(st.Deletions))
+	}
+	return ss
+}
@@ -0,0 +1,130 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+// hgLogTemplate separates changesets with a record separator and their
+// fields with NULs, like gitLogFormat.  The changed files follow the
+// last NUL, one per line.
+const hgLogTemplate = `\x1e{node}\x00{p1node} {p2node}\x00{author|person}\x00{author|email}\x00{date|hgdate}\x00{branch}\x00{desc}\x00` +
+	`{file_adds % "A {file}\n"}{file_mods % "M {file}\n"}{file_dels % "D {file}\n"}`
+
+// Hg is a Mercurial repository.
+type Hg struct {
+	// Dir is the repository's directory.  If empty, the current
+	// directory is used, as when running as a Mercurial hook.
+	Dir string
+}
+
+// Run runs hg with args in the repository and returns its output.
+// HGPLAIN is set so the output isn't changed by the user's
+// configuration.
+func (h *Hg) Run(args ...string) (string, error) {
+	cmd := exec.Command("hg", args...)
+	cmd.Dir = h.Dir
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	output, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		err = fmt.Errorf("hg %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(ee.Stderr)))
+	}
+	return string(output), err
+}
+
+// Commits reads the changesets with a single 'hg log', then each
+// changeset's diffstat with 'hg diff --stat'.
+func (h *Hg) Commits(from, to string) ([]*Commit, error) {
+	revset := fmt.Sprintf("::%s", to)
+	if len(from) > 0 {
+		revset = fmt.Sprintf("%s::%s - %s", from, to, from)
+	}
+	return h.Log(revset)
+}
+
+// Commit reads a single changeset.
+func (h *Hg) Commit(revision string) (*Commit, error) {
+	cc, err := h.Log(revision)
+	if err != nil {
+		return nil, err
+	}
+	if len(cc) != 1 {
+		return nil, fmt.Errorf("no such revision %q", revision)
+	}
+	return cc[0], nil
+}
+
+// Log reads the changesets in revset, oldest first.
+func (h *Hg) Log(revset string) ([]*Commit, error) {
+	output, err := h.Run("log", "-r", fmt.Sprintf("sort(%s, rev)", revset), "--template", hgLogTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	cc, err := parseHgLog(output)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range cc {
+		// 'hg diff --stat' prints the same summary as git
+		c.DiffStat, err = h.Run("diff", "--stat", "-c", c.Revision)
+		if err != nil {
+			return nil, err
+		}
+		c.Stats = changesets.ParseDiffStat(c.DiffStat)
+	}
+
+	return cc, nil
+}
+
+// parseHgLog parses 'hg log' output printed with hgLogTemplate.
+func parseHgLog(output string) ([]*Commit, error) {
+	cc := []*Commit{}
+
+	for _, record := range strings.Split(output, "\x1e") {
+		if len(strings.TrimSpace(record)) == 0 {
+			continue
+		}
+		fields := strings.SplitN(record, "\x00", 8)
+		if len(fields) != 8 {
+			return nil, fmt.Errorf("unable to parse hg log output %q", record)
+		}
+
+		// '1700000000 18000', seconds and timezone offset
+		date := strings.Fields(fields[4])
+		if len(date) == 0 {
+			return nil, fmt.Errorf("unable to parse commit date %q", fields[4])
+		}
+		sec, err := strconv.ParseFloat(date[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse commit date %q", fields[4])
+		}
+
+		c := &Commit{
+			Revision: fields[0],
+			Author:   fields[2],
+			Email:    fields[3],
+			Date:     time.Unix(int64(sec), 0),
+			Branch:   fields[5],
+			Log:      fields[6],
+			Changes:  ParseChanges(fields[7]),
+		}
+		for _, parent := range strings.Fields(fields[1]) {
+			// a missing parent is the null revision, all zeros
+			if strings.Trim(parent, "0") != "" {
+				c.Parents = append(c.Parents, parent)
+			}
+		}
+
+		cc = append(cc, c)
+	}
+
+	return cc, nil
+}
@@ -0,0 +1,112 @@
+package hooks
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+func TestParseHgLog(t *testing.T) {
+	const (
+		node   = "1a2b3c4d5e6f7a8b9c0d1a2b3c4d5e6f7a8b9c0d"
+		parent = "0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e"
+		merged = "aaaabbbbccccddddeeeeffff0000111122223333"
+		null   = "0000000000000000000000000000000000000000"
+	)
+
+	tests := []struct {
+		name   string
+		output string
+		want   []*Commit
+		err    bool
+	}{
+		{
+			name:   "empty",
+			output: "",
+			want:   []*Commit{},
+		},
+		{
+			name: "changeset",
+			output: "\x1e" + node + "\x00" + parent + " " + null + "\x00Alice\x00alice@example.com\x001700000000 18000\x00default\x00Fix crash\n\nDetails [#12]\x00" +
+				"A new.go\nM main.go\nD old.go\n",
+			want: []*Commit{{
+				Revision: node,
+				Author:   "Alice",
+				Email:    "alice@example.com",
+				Date:     time.Unix(1700000000, 0),
+				Branch:   "default",
+				Parents:  []string{parent},
+				Log:      "Fix crash\n\nDetails [#12]",
+				Changes: changesets.Changes{
+					{Operation: "A", Path: "new.go"},
+					{Operation: "M", Path: "main.go"},
+					{Operation: "D", Path: "old.go"},
+				},
+			}},
+		},
+		{
+			name: "root and merge",
+			output: "\x1e" + parent + "\x00" + null + " " + null + "\x00Bob\x00\x001600000000.5 0\x00stable\x00Initial\x00" +
+				"\x1e" + node + "\x00" + parent + " " + merged + "\x00Alice\x00alice@example.com\x001700000000 -3600\x00stable\x00Merge\x00",
+			want: []*Commit{
+				{
+					Revision: parent,
+					Author:   "Bob",
+					Date:     time.Unix(1600000000, 0),
+					Branch:   "stable",
+					Log:      "Initial",
+					Changes:  changesets.Changes{},
+				},
+				{
+					Revision: node,
+					Author:   "Alice",
+					Email:    "alice@example.com",
+					Date:     time.Unix(1700000000, 0),
+					Branch:   "stable",
+					Parents:  []string{parent, merged},
+					Log:      "Merge",
+					Changes:  changesets.Changes{},
+				},
+			},
+		},
+		{
+			name:   "missing fields",
+			output: "\x1e" + node + "\x00" + parent + "\x00Alice\x00",
+			err:    true,
+		},
+		{
+			name:   "bad date",
+			output: "\x1e" + node + "\x00\x00Alice\x00\x00yesterday\x00default\x00Fix\x00",
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHgLog(tt.output)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parseHgLog() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHgLog() = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHgLog() = %+v, want %+v", formatCommits(got), formatCommits(tt.want))
+			}
+		})
+	}
+}
+
+// formatCommits returns cc's values for error messages.
+func formatCommits(cc []*Commit) []Commit {
+	vs := []Commit{}
+	for _, c := range cc {
+		vs = append(vs, *c)
+	}
+	return vs
+}
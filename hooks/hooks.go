@@ -0,0 +1,214 @@
+// Package hooks provides what the commit hooks posting changesets to
+// Lighthouse, such as gittolh, svntolh and hgtolh, have in common:
+// reading commits from a Repository, building changesets from them and
+// posting the changesets as each commit's author.
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/changesets/keywords"
+	"github.com/nwidger/lighthouse/credentials"
+)
+
+// ErrNoToken is returned by Config.Token if no token is configured
+// for a commit's author.
+var ErrNoToken = errors.New("hooks: no token found")
+
+// Config is the Lighthouse configuration of a commit hook.
+type Config struct {
+	Account   string
+	ProjectID int
+
+	// Store, if non-nil, is checked for tokens before Keys.
+	Store credentials.Store
+	// Keys, if non-nil, returns the token for user from the
+	// hook's own configuration, or ErrNoToken.
+	Keys func(user string) (string, error)
+	// User returns the name the token for a commit's author is
+	// stored under.  If nil, the commit's author is used.
+	User func(c *Commit) string
+
+	// RateLimitInterval, if set, limits requests to one per
+	// interval and retries requests rejected with 429 Too Many
+	// Requests.
+	RateLimitInterval time.Duration
+}
+
+// UserName returns the name the token for c's author is stored
+// under.
+func (cfg *Config) UserName(c *Commit) string {
+	if cfg.User != nil {
+		return cfg.User(c)
+	}
+	return c.Author
+}
+
+// Token returns the token used to post c's changeset.
+func (cfg *Config) Token(c *Commit) (string, error) {
+	user := cfg.UserName(c)
+
+	var storeErr error
+	if cfg.Store != nil {
+		token, err := cfg.Store.Get(cfg.Account, user)
+		if err == nil {
+			return token, nil
+		}
+		if err != credentials.ErrNotFound {
+			storeErr = err
+		}
+	}
+
+	if cfg.Keys != nil {
+		token, err := cfg.Keys(user)
+		if err != ErrNoToken {
+			return token, err
+		}
+	}
+
+	if storeErr != nil {
+		return "", fmt.Errorf("unable to get token for %q from credential store: %v", user, storeErr)
+	}
+	return "", fmt.Errorf("unable to find token for %q", user)
+}
+
+// ParseProjectURL returns the account and project ID from a Lighthouse
+// project URL such as https://example.lighthouseapp.com/projects/1234.
+func ParseProjectURL(projectURL string) (string, int, error) {
+	u, err := url.Parse(strings.TrimSpace(projectURL))
+	if err != nil {
+		return "", 0, err
+	}
+
+	idx := strings.Index(u.Host, ".lighthouseapp.com")
+	if idx == -1 {
+		return "", 0, fmt.Errorf("unable to determine account name %q", u.String())
+	}
+
+	account := u.Host[:idx]
+	if len(account) == 0 {
+		return "", 0, fmt.Errorf("empty account name %q", u.String())
+	}
+
+	idx = strings.LastIndex(u.Path, "/")
+	if idx == -1 {
+		return "", 0, fmt.Errorf("unable to determine project ID %q", u.Path)
+	}
+
+	projectStr := u.Path[idx+1:]
+	projectID, err := strconv.Atoi(projectStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("unable to parse project ID %q", projectStr)
+	}
+
+	return account, projectID, nil
+}
+
+// ParseChanges parses lines of an operation followed by a path, as
+// printed by 'git diff-tree --name-status' and 'svnlook changed'.
+func ParseChanges(output string) changesets.Changes {
+	changes := changesets.Changes{}
+
+	for _, line := range strings.Split(output, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		idx := strings.IndexAny(line, " \t\f")
+		if idx == -1 {
+			continue
+		}
+		op, field := strings.TrimSpace(line[:idx]),
+			strings.TrimSpace(line[idx:])
+		if len(op) == 0 || len(field) == 0 {
+			continue
+		}
+		changes = append(changes, &changesets.Change{
+			Operation: op,
+			Path:      field,
+		})
+	}
+
+	return changes
+}
+
+// ExpandFooter substitutes revision for the first %s in footer, the
+// link to a commit configured for a commit hook.
+func ExpandFooter(footer, revision string) string {
+	if strings.Contains(footer, "%s") {
+		footer = strings.Replace(footer, "%s", revision, 1)
+	}
+	return footer
+}
+
+// Changeset is a changeset to post for a commit, along with the
+// ticket references in the commit's message and the comment added to
+// the referenced tickets.
+type Changeset struct {
+	*changesets.Changeset
+
+	// Commit is the commit the changeset is posted for, whose
+	// author's token is used.
+	Commit *Commit
+	// Ref is the branch or tag the commit was pushed to, if any.
+	Ref string
+
+	References keywords.References
+	Comment    string
+}
+
+// NewChangeset returns a changeset with title and body for c.  The
+// changeset's branch, parents, stats and tickets are set from c, and
+// its branch and parents are also appended to the body, see
+// changesets.Changeset.Trailer.  The comment added to tickets
+// referenced by c's message links to the changeset by revision,
+// followed by link if given.
+func NewChangeset(c *Commit, title, body, link string) *Changeset {
+	committer := c.Email
+	if len(committer) == 0 {
+		committer = c.Author
+	}
+	date := c.Date
+
+	comment := fmt.Sprintf("(from [%s]) %s", c.Revision, strings.TrimSpace(c.Log))
+	if len(link) > 0 {
+		comment += "\n\n" + link
+	}
+
+	refs := keywords.Parse(c.Log)
+
+	cs := &changesets.Changeset{
+		Title:     title,
+		Committer: committer,
+		Revision:  c.Revision,
+		ChangedAt: &date,
+		Changes:   c.Changes,
+		Branch:    c.Branch,
+		Parents:   c.Parents,
+		Stats:     c.Stats,
+		Tickets:   refs.Numbers(),
+	}
+	if cs.Changes == nil {
+		cs.Changes = changesets.Changes{}
+	}
+	if len(refs) > 0 {
+		cs.TicketID = refs[0].Number
+	}
+	cs.Body = body
+	if trailer := cs.Trailer(); len(trailer) > 0 {
+		cs.Body = strings.TrimRight(body, "\n") + "\n\n" + trailer
+	}
+
+	return &Changeset{
+		Changeset:  cs,
+		Commit:     c,
+		Ref:        c.Branch,
+		References: refs,
+		Comment:    comment,
+	}
+}
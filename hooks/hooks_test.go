@@ -0,0 +1,21 @@
+package hooks
+
+import "testing"
+
+func TestExpandFooter(t *testing.T) {
+	tests := []struct {
+		footer string
+		want   string
+	}{
+		{"", ""},
+		{"https://git.example.com/commit/%s", "https://git.example.com/commit/1a2b3c"},
+		{"See %s or %s", "See 1a2b3c or %s"},
+		{"No revision", "No revision"},
+	}
+
+	for _, tt := range tests {
+		if got := ExpandFooter(tt.footer, "1a2b3c"); got != tt.want {
+			t.Errorf("ExpandFooter(%q) = %q, want %q", tt.footer, got, tt.want)
+		}
+	}
+}
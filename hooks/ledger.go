@@ -0,0 +1,104 @@
+package hooks
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+// Ledger records the revisions posted from a repository and the refs
+// each was posted for, one 'REVISION REF' line per post, so commits
+// which were already posted can be skipped without asking Lighthouse.
+type Ledger struct {
+	path string
+	refs map[string][]string
+}
+
+// ReadLedger reads the ledger kept in the file path, which needn't
+// exist yet.
+func ReadLedger(path string) (*Ledger, error) {
+	l := &Ledger{
+		path: path,
+		refs: map[string][]string{},
+	}
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		revision, ref := fields[0], fields[1]
+		l.refs[revision] = append(l.refs[revision], ref)
+	}
+
+	return l, scanner.Err()
+}
+
+// Path returns the ledger's file.
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Posted returns whether revision was posted at all and whether it
+// was posted for ref.
+func (l *Ledger) Posted(revision, ref string) (bool, bool) {
+	refs, ok := l.refs[revision]
+	if !ok {
+		return false, false
+	}
+	for _, r := range refs {
+		if r == ref {
+			return true, true
+		}
+	}
+	return true, false
+}
+
+// Record records that revision was posted for ref.
+func (l *Ledger) Record(revision, ref string) error {
+	l.refs[revision] = append(l.refs[revision], ref)
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s %s\n", revision, ref)
+	return err
+}
+
+// AlreadyPosted returns whether c's revision was already posted and
+// the existing changeset.  If the ledger shows it was posted for c's
+// ref, Lighthouse isn't asked and existing is nil.  A revision in the
+// ledger which was since deleted from Lighthouse is posted again.
+func (l *Ledger) AlreadyPosted(cs *changesets.Service, c *Changeset) (existing *changesets.Changeset, ok bool, err error) {
+	if _, onRef := l.Posted(c.Revision, c.Ref); onRef {
+		return nil, true, nil
+	}
+
+	existing, err = cs.Get(c.Revision)
+	if eur, isEUR := err.(*lighthouse.ErrUnexpectedResponse); isEUR && eur.Resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return existing, true, nil
+}
@@ -0,0 +1,103 @@
+package hooks
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/changesets/keywords"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+// Poster posts changesets to a Lighthouse project, each with the
+// token of its commit's author.
+type Poster struct {
+	// Logf reports problems which don't stop a changeset from
+	// being posted, such as failing to update a referenced ticket.
+	// Defaults to log.Printf.
+	Logf func(format string, v ...interface{})
+
+	config    *Config
+	transport *lighthouse.Transport
+	service   *lighthouse.Service
+	tokens    map[string]string
+}
+
+// NewPoster returns a Poster for cfg's account and project.
+func NewPoster(cfg *Config) *Poster {
+	lt := &lighthouse.Transport{
+		TokenAsBasicAuth: true,
+	}
+	s := lighthouse.NewService(cfg.Account, &http.Client{Transport: lt})
+	if cfg.RateLimitInterval > 0 {
+		lt.RateLimitInterval = cfg.RateLimitInterval
+		lt.RateLimitBurstSize = lighthouse.DefaultRateLimitBurstSize
+		s.RateLimitRetryRequests = true
+	}
+	return &Poster{
+		Logf:      log.Printf,
+		config:    cfg,
+		transport: lt,
+		service:   s,
+		tokens:    map[string]string{},
+	}
+}
+
+// Service returns the service used to make requests, e.g. to change
+// its BasePath.
+func (p *Poster) Service() *lighthouse.Service {
+	return p.service
+}
+
+// As makes further requests with the token of c's author.
+func (p *Poster) As(c *Commit) error {
+	user := p.config.UserName(c)
+	token, ok := p.tokens[user]
+	if !ok {
+		var err error
+		token, err = p.config.Token(c)
+		if err != nil {
+			return err
+		}
+		p.tokens[user] = token
+	}
+	p.transport.Token = token
+	return nil
+}
+
+// Changesets returns the project's changesets service, making
+// requests as the last user passed to As.
+func (p *Poster) Changesets() *changesets.Service {
+	return changesets.NewService(p.service, p.config.ProjectID)
+}
+
+// Tickets returns the project's tickets service, making requests as
+// the last user passed to As.
+func (p *Poster) Tickets() *tickets.Service {
+	return tickets.NewService(p.service, p.config.ProjectID)
+}
+
+// Post creates c as its commit's author, then applies the keywords of
+// c's ticket references and adds c's comment to the tickets.  An
+// error is only returned if the changeset wasn't created.
+func (p *Poster) Post(c *Changeset) error {
+	err := p.As(c.Commit)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.Changesets().Create(c.Changeset)
+	if err != nil {
+		return err
+	}
+
+	// the tickets are updated once the changeset they link to
+	// exists
+	err = keywords.Apply(p.Tickets(), c.References, c.Comment)
+	if err != nil {
+		p.Logf("%s: %s", c.Revision, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package hooks
+
+import (
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+// Commit is a commit read from a Repository.
+type Commit struct {
+	Revision string
+	Author   string
+	// Email is the author's email, empty if the repository
+	// doesn't record one.
+	Email string
+	Date  time.Time
+	// Branch is the named branch the commit was made on, empty if
+	// the repository doesn't record one.
+	Branch string
+	// Parents are the revisions of the commit's parents, empty if
+	// the repository's history is linear, as in Subversion.
+	Parents []string
+	// Log is the commit message.
+	Log string
+	// Changes are the paths changed by the commit.
+	Changes changesets.Changes
+	// DiffStat summarizes the lines changed in each path, as
+	// printed by 'git diff --stat'.
+	DiffStat string
+	// Stats are the lines added and deleted in each path.
+	Stats changesets.FileStats
+}
+
+// Repository reads commits from a version control repository.
+type Repository interface {
+	// Commits returns the commits after from up to and including
+	// to, oldest first.  If from is empty, all commits up to and
+	// including to are returned.
+	Commits(from, to string) ([]*Commit, error)
+	// Commit returns a single commit.
+	Commit(revision string) (*Commit, error)
+}
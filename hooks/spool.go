@@ -0,0 +1,421 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a spooled changeset is
+	// delivered before it's moved to the dead letter directory.
+	DefaultMaxAttempts = 10
+	// DefaultBackoff is the delay before a failed delivery is
+	// first retried.
+	DefaultBackoff = 30 * time.Second
+	// DefaultMaxBackoff is the longest delay between retries.
+	DefaultMaxBackoff = time.Hour
+)
+
+// ErrSpoolLocked is returned by Spool.Drain if the spool is already
+// being drained by another process.
+var ErrSpoolLocked = errors.New("hooks: spool is being drained by another process")
+
+// permanentError is a delivery error which retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (pe *permanentError) Error() string {
+	return pe.err.Error()
+}
+
+// Permanent marks err as a delivery error which retrying won't fix,
+// so the changeset is moved to the dead letter directory at once.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent returns whether retrying the delivery which failed with
+// err won't help, either because err was marked with Permanent or
+// because Lighthouse rejected the request with a 4xx response other
+// than 408 Request Timeout or 429 Too Many Requests.
+func IsPermanent(err error) bool {
+	switch e := err.(type) {
+	case *permanentError:
+		return true
+	case *lighthouse.ErrUnexpectedResponse:
+		code := e.Resp.StatusCode
+		return code >= 400 && code < 500 &&
+			code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+	}
+	return false
+}
+
+// SpoolEntry is a changeset waiting in a Spool.
+type SpoolEntry struct {
+	// ID names the entry's file.  Entries are delivered in ID
+	// order.
+	ID          string     `json:"-"`
+	Queued      time.Time  `json:"queued"`
+	Attempts    int        `json:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt"`
+	LastError   string     `json:"last_error,omitempty"`
+	Changeset   *Changeset `json:"changeset"`
+}
+
+// Spool is a directory of changesets waiting to be posted, so a
+// commit hook can queue its changesets and return without waiting for
+// Lighthouse.  Changesets are queued in Dir/queue, one JSON file each,
+// and moved to Dir/dead once they fail permanently or run out of
+// attempts.
+type Spool struct {
+	Dir string
+
+	// MaxAttempts defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled after
+	// each further failure up to MaxBackoff.  They default to
+	// DefaultBackoff and DefaultMaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Logf reports failed deliveries.  Defaults to log.Printf.
+	Logf func(format string, v ...interface{})
+}
+
+func (s *Spool) queueDir() string { return filepath.Join(s.Dir, "queue") }
+func (s *Spool) deadDir() string  { return filepath.Join(s.Dir, "dead") }
+func (s *Spool) tmpDir() string   { return filepath.Join(s.Dir, "tmp") }
+func (s *Spool) lockPath() string { return filepath.Join(s.Dir, "drain.lock") }
+
+func (s *Spool) logf(format string, v ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+func (s *Spool) maxAttempts() int {
+	if s.MaxAttempts > 0 {
+		return s.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+// backoff returns the delay before retrying an entry which has failed
+// attempts times.
+func (s *Spool) backoff(attempts int) time.Duration {
+	backoff, max := s.Backoff, s.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// mkdirs creates the spool's directories, readable only by the owner
+// since queued changesets may include private commit messages.
+func (s *Spool) mkdirs() error {
+	for _, dir := range []string{s.queueDir(), s.deadDir(), s.tmpDir()} {
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Enqueue queues cc to be delivered in order.
+func (s *Spool) Enqueue(cc ...*Changeset) error {
+	err := s.mkdirs()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i, c := range cc {
+		e := &SpoolEntry{
+			ID:          fmt.Sprintf("%019d-%d-%04d", now.UnixNano(), os.Getpid(), i),
+			Queued:      now,
+			NextAttempt: now,
+			Changeset:   c,
+		}
+		err = s.write(s.queueDir(), e)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write writes e to dir, replacing any existing file.
+func (s *Spool) write(dir string, e *SpoolEntry) error {
+	buf, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a drain never sees a
+	// partial entry
+	f, err := ioutil.TempFile(s.tmpDir(), e.ID)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(dir, e.ID+".json"))
+}
+
+func (s *Spool) read(dir string) ([]*SpoolEntry, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	entries := []*SpoolEntry{}
+	for _, name := range names {
+		buf, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := &SpoolEntry{}
+		err = json.Unmarshal(buf, e)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		e.ID = strings.TrimSuffix(filepath.Base(name), ".json")
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// Queued returns the entries waiting to be delivered, in order.
+func (s *Spool) Queued() ([]*SpoolEntry, error) {
+	return s.read(s.queueDir())
+}
+
+// Dead returns the entries which failed permanently or ran out of
+// attempts.
+func (s *Spool) Dead() ([]*SpoolEntry, error) {
+	return s.read(s.deadDir())
+}
+
+// Replay moves the dead entries with the given IDs, or all dead
+// entries if none are given, back to the queue with their attempts
+// reset.  It returns the number of entries moved.
+func (s *Spool) Replay(ids ...string) (int, error) {
+	err := s.mkdirs()
+	if err != nil {
+		return 0, err
+	}
+
+	dead, err := s.Dead()
+	if err != nil {
+		return 0, err
+	}
+
+	want := map[string]bool{}
+	for _, id := range ids {
+		want[strings.TrimSuffix(id, ".json")] = true
+	}
+
+	n := 0
+	for _, e := range dead {
+		if len(want) > 0 && !want[e.ID] {
+			continue
+		}
+		delete(want, e.ID)
+		e.Attempts, e.NextAttempt, e.LastError = 0, time.Now(), ""
+		err = s.write(s.queueDir(), e)
+		if err != nil {
+			return n, err
+		}
+		err = os.Remove(filepath.Join(s.deadDir(), e.ID+".json"))
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	for id := range want {
+		return n, fmt.Errorf("no dead entry %q", id)
+	}
+
+	return n, nil
+}
+
+// lock takes the drain lock.  A lock which hasn't been refreshed for
+// twice the longest backoff was left by a drain which died and is
+// taken over.
+func (s *Spool) lock() error {
+	stale := 2 * s.backoff(s.maxAttempts())
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(s.lockPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintln(f, os.Getpid())
+			return f.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		fi, err := os.Stat(s.lockPath())
+		if err != nil || time.Since(fi.ModTime()) < stale {
+			break
+		}
+		os.Remove(s.lockPath())
+	}
+	return ErrSpoolLocked
+}
+
+// touchLock shows the lock is still held.
+func (s *Spool) touchLock() {
+	now := time.Now()
+	os.Chtimes(s.lockPath(), now, now)
+}
+
+func (s *Spool) unlock() {
+	os.Remove(s.lockPath())
+}
+
+// Unlock removes a drain lock left by a process which died while
+// draining.  It's only safe to call when no other process can be
+// draining the spool, such as when the only process which drains it
+// starts.
+func (s *Spool) Unlock() {
+	s.unlock()
+}
+
+// Drain delivers the queued changesets in order until the queue is
+// empty, including any queued while draining.  A delivery which fails
+// is retried after a backoff, holding back the entries queued after
+// it, until it fails permanently, as reported by IsPermanent, or runs
+// out of attempts and is moved to the dead letter directory.  Only one
+// process drains a spool at a time; ErrSpoolLocked is returned if
+// another process is already draining it.
+func (s *Spool) Drain(deliver func(c *Changeset) error) error {
+	err := s.mkdirs()
+	if err != nil {
+		return err
+	}
+
+	for {
+		err = s.lock()
+		if err != nil {
+			return err
+		}
+		err = s.drain(deliver)
+		s.unlock()
+		if err != nil {
+			return err
+		}
+
+		// entries queued after the last check but while the
+		// lock was held would otherwise wait for the next drain
+		entries, err := s.Queued()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *Spool) drain(deliver func(c *Changeset) error) error {
+	for {
+		s.touchLock()
+
+		entries, err := s.Queued()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		var wait time.Duration
+
+		for _, e := range entries {
+			now := time.Now()
+			if now.Before(e.NextAttempt) {
+				wait = e.NextAttempt.Sub(now)
+				break
+			}
+
+			path := filepath.Join(s.queueDir(), e.ID+".json")
+
+			derr := deliver(e.Changeset)
+			if derr == nil {
+				err = os.Remove(path)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			e.Attempts++
+			e.LastError = derr.Error()
+
+			if IsPermanent(derr) || e.Attempts >= s.maxAttempts() {
+				s.logf("%s: giving up after %d attempts: %s", e.Changeset.Revision, e.Attempts, derr)
+				err = s.write(s.deadDir(), e)
+				if err == nil {
+					err = os.Remove(path)
+				}
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			wait = s.backoff(e.Attempts)
+			e.NextAttempt = now.Add(wait)
+			s.logf("%s: attempt %d failed, retrying in %s: %s", e.Changeset.Revision, e.Attempts, wait, derr)
+			err = s.write(s.queueDir(), e)
+			if err != nil {
+				return err
+			}
+			break
+		}
+
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package hooks
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+func TestSpoolBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		backoff    time.Duration
+		maxBackoff time.Duration
+		attempts   int
+		want       time.Duration
+	}{
+		{"defaults first retry", 0, 0, 1, DefaultBackoff},
+		{"defaults doubled", 0, 0, 3, 4 * DefaultBackoff},
+		{"defaults capped", 0, 0, 20, DefaultMaxBackoff},
+		{"first retry", time.Second, time.Minute, 1, time.Second},
+		{"zero attempts", time.Second, time.Minute, 0, time.Second},
+		{"doubled", time.Second, time.Minute, 4, 8 * time.Second},
+		{"capped", time.Second, time.Minute, 7, time.Minute},
+		{"backoff above max", time.Hour, time.Minute, 1, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Spool{Backoff: tt.backoff, MaxBackoff: tt.maxBackoff}
+			if got := s.backoff(tt.attempts); got != tt.want {
+				t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	response := func(code int) error {
+		return &lighthouse.ErrUnexpectedResponse{
+			ExpectedCode: http.StatusCreated,
+			Resp:         &http.Response{StatusCode: code},
+		}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"other error", errors.New("connection refused"), false},
+		{"marked", Permanent(errors.New("no token")), true},
+		{"unprocessable", response(http.StatusUnprocessableEntity), true},
+		{"not found", response(http.StatusNotFound), true},
+		{"request timeout", response(http.StatusRequestTimeout), false},
+		{"too many requests", response(http.StatusTooManyRequests), false},
+		{"server error", response(http.StatusBadGateway), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Errorf("IsPermanent(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpoolDrain(t *testing.T) {
+	errTransient := errors.New("connection refused")
+	errPermanent := Permanent(errors.New("no token"))
+
+	tests := []struct {
+		name string
+		// failures are the errors returned by successive
+		// deliveries of each revision before it succeeds
+		failures  map[string][]error
+		calls     []string
+		dead      []string
+		lastError string
+	}{
+		{
+			name:  "all delivered",
+			calls: []string{"a", "b", "c"},
+			dead:  []string{},
+		},
+		{
+			name:     "retried in order",
+			failures: map[string][]error{"b": {errTransient, errTransient}},
+			calls:    []string{"a", "b", "b", "b", "c"},
+			dead:     []string{},
+		},
+		{
+			name:      "permanent failure",
+			failures:  map[string][]error{"b": {errPermanent}},
+			calls:     []string{"a", "b", "c"},
+			dead:      []string{"b"},
+			lastError: "no token",
+		},
+		{
+			name:      "out of attempts",
+			failures:  map[string][]error{"a": {errTransient, errTransient, errTransient, errTransient}},
+			calls:     []string{"a", "a", "a", "b", "c"},
+			dead:      []string{"a"},
+			lastError: "connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Spool{
+				Dir:         t.TempDir(),
+				MaxAttempts: 3,
+				Backoff:     time.Millisecond,
+				MaxBackoff:  time.Millisecond,
+				Logf:        t.Logf,
+			}
+			for _, rev := range []string{"a", "b", "c"} {
+				err := s.Enqueue(&Changeset{Changeset: &changesets.Changeset{Revision: rev}})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			calls := []string{}
+			err := s.Drain(func(c *Changeset) error {
+				calls = append(calls, c.Revision)
+				failures := tt.failures[c.Revision]
+				if len(failures) == 0 {
+					return nil
+				}
+				tt.failures[c.Revision] = failures[1:]
+				return failures[0]
+			})
+			if err != nil {
+				t.Fatalf("Drain() = %v", err)
+			}
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("delivered %q, want %q", calls, tt.calls)
+			}
+
+			queued, err := s.Queued()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(queued) > 0 {
+				t.Errorf("%d entries still queued", len(queued))
+			}
+
+			dead, err := s.Dead()
+			if err != nil {
+				t.Fatal(err)
+			}
+			revs := []string{}
+			for _, e := range dead {
+				revs = append(revs, e.Changeset.Revision)
+				if e.LastError != tt.lastError {
+					t.Errorf("%s: LastError = %q, want %q", e.Changeset.Revision, e.LastError, tt.lastError)
+				}
+			}
+			if !reflect.DeepEqual(revs, tt.dead) {
+				t.Errorf("dead %q, want %q", revs, tt.dead)
+			}
+		})
+	}
+}
+
+func TestSpoolDrainLocked(t *testing.T) {
+	s := &Spool{Dir: t.TempDir()}
+	err := s.mkdirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Drain(func(c *Changeset) error { return nil })
+	if err != ErrSpoolLocked {
+		t.Errorf("Drain() = %v, want %v", err, ErrSpoolLocked)
+	}
+
+	s.Unlock()
+	err = s.Drain(func(c *Changeset) error { return nil })
+	if err != nil {
+		t.Errorf("Drain() after Unlock = %v, want nil", err)
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	s := &Spool{Dir: t.TempDir(), Logf: t.Logf}
+	err := s.Enqueue(&Changeset{Changeset: &changesets.Changeset{Revision: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Drain(func(c *Changeset) error { return Permanent(errors.New("no token")) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Replay("missing")
+	if err == nil {
+		t.Error("Replay(\"missing\") = nil, want error")
+	}
+
+	n, err := s.Replay()
+	if n != 1 || err != nil {
+		t.Fatalf("Replay() = %d, %v, want 1, nil", n, err)
+	}
+	queued, err := s.Queued()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0].Attempts != 0 || len(queued[0].LastError) > 0 {
+		t.Errorf("queued %+v, want one entry with no attempts", queued)
+	}
+	dead, err := s.Dead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) > 0 {
+		t.Errorf("%d entries still dead", len(dead))
+	}
+}
@@ -0,0 +1,184 @@
+package hooks
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+// SVN is a Subversion repository, read with svnlook.
+type SVN struct {
+	// Path is the repository's path on disk.
+	Path string
+}
+
+// Run runs svnlook with args and returns its output.  The repository
+// path is passed as the first argument after the subcommand.
+func (s *SVN) Run(subcommand string, args ...string) (string, error) {
+	args = append([]string{subcommand, s.Path}, args...)
+	cmd := exec.Command("svnlook", args...)
+	output, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		err = fmt.Errorf("svnlook %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(ee.Stderr)))
+	}
+	return string(output), err
+}
+
+// Commits reads each revision after from up to and including to.
+func (s *SVN) Commits(from, to string) ([]*Commit, error) {
+	first := 1
+	if len(from) > 0 {
+		n, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid revision %q", from)
+		}
+		first = n + 1
+	}
+	last, err := strconv.Atoi(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revision %q", to)
+	}
+
+	cc := []*Commit{}
+	for rev := first; rev <= last; rev++ {
+		c, err := s.Commit(strconv.Itoa(rev))
+		if err != nil {
+			return nil, err
+		}
+		cc = append(cc, c)
+	}
+	return cc, nil
+}
+
+// Commit reads revision with svnlook info, changed and diff.
+func (s *SVN) Commit(revision string) (*Commit, error) {
+	// author, date, log size and log
+	info, err := s.Run("info", "-r", revision)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitN(info, "\n", 4)
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("unable to parse svnlook info output %q", info)
+	}
+
+	commitTime, err := parseSVNDate(lines[1])
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := s.Run("changed", "-r", revision)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := s.Run("diff", "-r", revision)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Commit{
+		Revision: revision,
+		Author:   strings.TrimSpace(lines[0]),
+		Date:     commitTime,
+		Log:      lines[3],
+		Changes:  ParseChanges(changed),
+		Stats:    diffStat(diff),
+	}
+	c.DiffStat = formatDiffStat(c.Stats)
+
+	return c, nil
+}
+
+// Date returns the date of revision.
+func (s *SVN) Date(revision string) (time.Time, error) {
+	date, err := s.Run("date", "-r", revision)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseSVNDate(date)
+}
+
+// parseSVNDate parses a date printed by svnlook, such as
+// '2024-01-02 03:04:05 -0500 (Tue, 02 Jan 2024)'.
+func parseSVNDate(date string) (time.Time, error) {
+	d := strings.TrimSpace(date)
+	if idx := strings.Index(d, "("); idx != -1 {
+		d = strings.TrimSpace(d[:idx])
+	}
+	t, err := time.Parse("2006-01-02 15:04:05 -0700", d)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse commit date %q", date)
+	}
+	return t, nil
+}
+
+// diffStat counts the lines added and deleted in each file of a
+// unified diff as printed by 'svnlook diff'.
+func diffStat(diff string) changesets.FileStats {
+	stats := changesets.FileStats{}
+	var current *changesets.FileStat
+
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "Index: "):
+			current = &changesets.FileStat{Path: strings.TrimPrefix(line, "Index: ")}
+			stats = append(stats, current)
+		case current == nil:
+		case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+		case strings.HasPrefix(line, "+"):
+			current.Additions++
+		case strings.HasPrefix(line, "-"):
+			current.Deletions++
+		}
+	}
+
+	return stats
+}
+
+// formatDiffStat formats stats like 'git diff --stat'.
+func formatDiffStat(stats changesets.FileStats) string {
+	if len(stats) == 0 {
+		return ""
+	}
+
+	const maxBar = 40
+	width, most := 0, 0
+	for _, st := range stats {
+		if len(st.Path) > width {
+			width = len(st.Path)
+		}
+		if st.Additions+st.Deletions > most {
+			most = st.Additions + st.Deletions
+		}
+	}
+
+	b := &strings.Builder{}
+	additions, deletions := 0, 0
+	for _, st := range stats {
+		additions += st.Additions
+		deletions += st.Deletions
+		plus, minus := st.Additions, st.Deletions
+		if most > maxBar {
+			plus = (plus*maxBar + most - 1) / most
+			minus = (minus*maxBar + most - 1) / most
+		}
+		fmt.Fprintf(b, " %-*s | %d %s%s\n", width, st.Path, st.Additions+st.Deletions,
+			strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+
+	files := "files"
+	if len(stats) == 1 {
+		files = "file"
+	}
+	fmt.Fprintf(b, " %d %s changed, %d insertions(+), %d deletions(-)\n", len(stats), files, additions, deletions)
+
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package hooks
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+func TestParseSVNDate(t *testing.T) {
+	tests := []struct {
+		date string
+		want time.Time
+		err  bool
+	}{
+		{
+			date: "2024-01-02 03:04:05 -0500 (Tue, 02 Jan 2024)",
+			want: time.Date(2024, 1, 2, 8, 4, 5, 0, time.UTC),
+		},
+		{
+			date: "2024-01-02 03:04:05 +0000\n",
+			want: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			date: "Tue, 02 Jan 2024",
+			err:  true,
+		},
+		{
+			date: "",
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSVNDate(tt.date)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseSVNDate(%q) = %s, want error", tt.date, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseSVNDate(%q) = %s, %v, want %s", tt.date, got, err, tt.want)
+		}
+	}
+}
+
+func TestDiffStat(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want []string
+	}{
+		{
+			name: "empty",
+			diff: "",
+			want: []string{},
+		},
+		{
+			name: "modified and added",
+			diff: "Modified: trunk/main.c\n" +
+				"===================================================================\n" +
+				"Index: trunk/main.c\n" +
+				"===================================================================\n" +
+				"--- trunk/main.c\t2024-01-01 00:00:00 UTC (rev 1)\n" +
+				"+++ trunk/main.c\t2024-01-02 00:00:00 UTC (rev 2)\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				" int main() {\n" +
+				"-\treturn 1;\n" +
+				"+\treturn 0;\n" +
+				"+\t/* --- done */\n" +
+				" }\n" +
+				"\n" +
+				"Added: trunk/README\n" +
+				"===================================================================\n" +
+				"Index: trunk/README\n" +
+				"===================================================================\n" +
+				"--- trunk/README\t                        (rev 0)\n" +
+				"+++ trunk/README\t2024-01-02 00:00:00 UTC (rev 2)\n" +
+				"@@ -0,0 +1,2 @@\n" +
+				"+Hello\n" +
+				"+---\n",
+			want: []string{"trunk/main.c +2 -1", "trunk/README +2 -0"},
+		},
+		{
+			name: "lines before the first file",
+			diff: "+stray\n-stray\nIndex: a\n-x\n",
+			want: []string{"a +0 -1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatFileStats(diffStat(tt.diff))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffStat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDiffStat(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats changesets.FileStats
+		want  string
+		// scaled graphs don't parse back to the same stats
+		scaled bool
+	}{
+		{
+			name:  "empty",
+			stats: nil,
+			want:  "",
+		},
+		{
+			name:  "one file",
+			stats: changesets.FileStats{{Path: "main.c", Additions: 2, Deletions: 1}},
+			want: " main.c | 3 ++-\n" +
+				" 1 file changed, 2 insertions(+), 1 deletions(-)\n",
+		},
+		{
+			name: "scaled",
+			stats: changesets.FileStats{
+				{Path: "big.c", Additions: 60, Deletions: 20},
+				{Path: "a", Additions: 1},
+			},
+			want: " big.c | 80 ++++++++++++++++++++++++++++++----------\n" +
+				" a     | 1 +\n" +
+				" 2 files changed, 61 insertions(+), 20 deletions(-)\n",
+			scaled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatDiffStat(tt.stats)
+			if got != tt.want {
+				t.Errorf("formatDiffStat() = %q, want %q", got, tt.want)
+			}
+			if !tt.scaled {
+				parsed := changesets.ParseDiffStat(got)
+				if !reflect.DeepEqual(formatFileStats(parsed), formatFileStats(tt.stats)) {
+					t.Errorf("ParseDiffStat(formatDiffStat()) = %q, want %q", formatFileStats(parsed), formatFileStats(tt.stats))
+				}
+			}
+		})
+	}
+}